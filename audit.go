@@ -0,0 +1,73 @@
+package GFileMux
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// auditEntry is one line of the audit trail written by WithAuditSink.
+type auditEntry struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Bucket         string    `json:"bucket"`
+	FieldName      string    `json:"field_name"`
+	OriginalName   string    `json:"original_name"`
+	StorageKey     string    `json:"storage_key"`
+	Size           int64     `json:"size"`
+	ChecksumSHA256 string    `json:"checksum_sha256,omitempty"`
+	MimeType       string    `json:"mime_type"`
+	ClientIP       string    `json:"client_ip,omitempty"`
+}
+
+// auditSink serializes audit entries onto a shared writer. Files in a batch are
+// stored concurrently, so every write happens under mu.
+type auditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// record writes the audit line for a stored file.
+func (a *auditSink) record(ctx context.Context, bucket string, f File) error {
+	line, err := json.Marshal(auditEntry{
+		Timestamp:      time.Now().UTC(),
+		Bucket:         bucket,
+		FieldName:      f.FieldName,
+		OriginalName:   f.OriginalName,
+		StorageKey:     f.StorageKey,
+		Size:           f.Size,
+		ChecksumSHA256: f.ChecksumSHA256,
+		MimeType:       f.MimeType,
+		ClientIP:       clientIPFromContext(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(line)
+	return err
+}
+
+// clientIPKey is the context key under which Upload records the client IP.
+type clientIPKey struct{}
+
+// withClientIP records the IP of r's remote peer in ctx.
+func withClientIP(ctx context.Context, r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// clientIPFromContext returns the IP recorded by withClientIP, if any.
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,57 @@
+package GFileMux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGFileMux_AuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	handler := newTestHandler(t, WithStorage(&recordingStorage{}), WithAuditSink(&buf), WithChecksumValidation(true))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"a", "one.txt", []byte("one")},
+		formPart{"b", "two.txt", []byte("two")},
+	)
+	req.RemoteAddr = "203.0.113.7:51234"
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "a", "b")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit lines, got %d: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var e auditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		if e.Bucket != "bucket" || e.ClientIP != "203.0.113.7" || e.StorageKey == "" ||
+			e.ChecksumSHA256 == "" || e.Size != 3 || e.Timestamp.IsZero() {
+			t.Errorf("unexpected audit entry: %+v", e)
+		}
+	}
+}
+
+func TestGFileMux_AuditSink_SkipsFailedFiles(t *testing.T) {
+	var buf bytes.Buffer
+	handler := newTestHandler(t,
+		WithAuditSink(&buf),
+		WithFileValidatorFunc(func(f File) error { return errors.New("rejected") }),
+	)
+
+	req := buildMultipartRequest(t, "a", "one.txt", []byte("one"))
+	handler.Upload("bucket", "a")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no audit entries for failed files, got %q", buf.String())
+	}
+}
@@ -0,0 +1,26 @@
+package GFileMux
+
+import "sync/atomic"
+
+// memoryInUse is the number of request-body bytes currently admitted by
+// handlers configured with WithGlobalMemoryBudget. It is shared by every
+// GFileMux in the process.
+var memoryInUse atomic.Int64
+
+// acquireMemory reserves n bytes if doing so keeps memoryInUse within budget.
+func acquireMemory(n, budget int64) bool {
+	for {
+		cur := memoryInUse.Load()
+		if n > budget-cur { // cur+n > budget, without overflowing
+			return false
+		}
+		if memoryInUse.CompareAndSwap(cur, cur+n) {
+			return true
+		}
+	}
+}
+
+// releaseMemory returns n bytes reserved by acquireMemory.
+func releaseMemory(n int64) {
+	memoryInUse.Add(-n)
+}
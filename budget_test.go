@@ -0,0 +1,81 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// gatedStorage blocks uploads until release is closed, signalling entered first.
+type gatedStorage struct {
+	MockStorage
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (gs *gatedStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	gs.entered <- struct{}{}
+	<-gs.release
+	return gs.MockStorage.Upload(ctx, reader, options)
+}
+
+func TestGFileMux_GlobalMemoryBudget(t *testing.T) {
+	store := &gatedStorage{entered: make(chan struct{}), release: make(chan struct{})}
+	req1 := buildMultipartRequest(t, "f", "a.txt", make([]byte, 600))
+	req2 := buildMultipartRequest(t, "f", "b.txt", make([]byte, 600))
+
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithGlobalMemoryBudget(req1.ContentLength+100),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "f")(next).ServeHTTP(rr, req1)
+		done <- rr.Code
+	}()
+	<-store.entered // the first request holds its reservation
+
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "f")(next).ServeHTTP(rr, req2)
+	if rr.Code != http.StatusServiceUnavailable || !errors.Is(gotErr, ErrMemoryBudgetExhausted) {
+		t.Errorf("expected 503 with ErrMemoryBudgetExhausted, got %d: %v", rr.Code, gotErr)
+	}
+
+	close(store.release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected first request to succeed, got %d", code)
+	}
+	if n := memoryInUse.Load(); n != 0 {
+		t.Errorf("expected budget fully released, %d bytes still reserved", n)
+	}
+
+	// With the budget free again, the second request is admitted.
+	req2 = buildMultipartRequest(t, "f", "b.txt", make([]byte, 600))
+	go func() { <-store.entered }()
+	rr = httptest.NewRecorder()
+	handler.Upload("bucket", "f")(next).ServeHTTP(rr, req2)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 once the budget is released, got %d", rr.Code)
+	}
+}
+
+func TestAcquireMemory_NoOverflow(t *testing.T) {
+	if !acquireMemory(10, math.MaxInt64) {
+		t.Fatal("expected 10 bytes to fit in an unbounded budget")
+	}
+	defer releaseMemory(10)
+	// 10 + MaxInt64 would wrap negative and be admitted without the guard.
+	if acquireMemory(math.MaxInt64, math.MaxInt64) {
+		releaseMemory(math.MaxInt64)
+		t.Fatal("expected a reservation past the budget to be refused")
+	}
+}
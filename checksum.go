@@ -0,0 +1,86 @@
+package GFileMux
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ChecksumAlgorithm names the hash WithChecksumAlgorithm computes into
+// File.Checksum.
+type ChecksumAlgorithm string
+
+const (
+	// ChecksumAlgorithmNone computes no File.Checksum.
+	ChecksumAlgorithmNone ChecksumAlgorithm = ""
+	// ChecksumAlgorithmSHA256 computes a SHA-256 digest.
+	ChecksumAlgorithmSHA256 ChecksumAlgorithm = "sha256"
+	// ChecksumAlgorithmSHA512 computes a SHA-512 digest.
+	ChecksumAlgorithmSHA512 ChecksumAlgorithm = "sha512"
+)
+
+// newHash returns a hash.Hash for the algorithm.
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case ChecksumAlgorithmSHA256:
+		return sha256.New(), nil
+	case ChecksumAlgorithmSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", string(a))
+}
+
+// hashingReader feeds the bytes read from r into h as they go to storage, so
+// the file is hashed without a second read. Bytes are hashed once, in order:
+// rereading after a seek back does not hash them again, and a seek forward
+// past unread bytes leaves the hash incomplete.
+type hashingReader struct {
+	r      io.Reader
+	h      hash.Hash
+	pos    int64 // current read offset
+	hashed int64 // bytes hashed so far, a prefix of the content
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	if start := hr.hashed - hr.pos; start >= 0 && start < int64(n) {
+		hr.h.Write(p[start:n])
+		hr.hashed = hr.pos + int64(n)
+	}
+	hr.pos += int64(n)
+	return n, err
+}
+
+// sum returns the hex digest if exactly size bytes were hashed.
+func (hr *hashingReader) sum(size int64) (string, bool) {
+	if hr.hashed != size {
+		return "", false
+	}
+	return fmt.Sprintf("%x", hr.h.Sum(nil)), true
+}
+
+// hashingReadSeeker is a hashingReader over a seekable file, so backends that
+// require an io.ReadSeeker still receive one.
+type hashingReadSeeker struct {
+	*hashingReader
+	s io.Seeker
+}
+
+func (hrs hashingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := hrs.s.Seek(offset, whence)
+	if err == nil {
+		hrs.pos = pos
+	}
+	return pos, err
+}
+
+// newHashingReader wraps r, keeping it seekable when it is.
+func newHashingReader(r io.Reader, h hash.Hash) (io.Reader, *hashingReader) {
+	hr := &hashingReader{r: r, h: h}
+	if s, ok := r.(io.Seeker); ok {
+		return hashingReadSeeker{hashingReader: hr, s: s}, hr
+	}
+	return hr, hr
+}
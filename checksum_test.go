@@ -0,0 +1,107 @@
+package GFileMux
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHashingReader(t *testing.T) {
+	const content = "hello, checksum"
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	t.Run("sequential", func(t *testing.T) {
+		r, hr := newHashingReader(strings.NewReader(content), sha256.New())
+		io.ReadAll(r)
+		if got, ok := hr.sum(int64(len(content))); !ok || got != want {
+			t.Errorf("sum = %q, %v; want %q", got, ok, want)
+		}
+	})
+
+	t.Run("reread after seek back", func(t *testing.T) {
+		r, hr := newHashingReader(strings.NewReader(content), sha256.New())
+		rs, ok := r.(io.ReadSeeker)
+		if !ok {
+			t.Fatal("expected a seekable reader to stay seekable")
+		}
+		io.ReadFull(rs, make([]byte, 5))
+		rs.Seek(0, io.SeekStart)
+		io.ReadAll(rs)
+		if got, ok := hr.sum(int64(len(content))); !ok || got != want {
+			t.Errorf("sum = %q, %v; want %q", got, ok, want)
+		}
+	})
+
+	t.Run("seek past unread bytes", func(t *testing.T) {
+		r, hr := newHashingReader(strings.NewReader(content), sha256.New())
+		rs := r.(io.ReadSeeker)
+		rs.Seek(5, io.SeekStart)
+		io.ReadAll(rs)
+		if _, ok := hr.sum(int64(len(content))); ok {
+			t.Error("expected the hash to be reported incomplete")
+		}
+	})
+}
+
+// skippingStorage seeks past the first bytes of the file before reading the
+// rest, like a backend resuming an upload.
+type skippingStorage struct {
+	recordingStorage
+}
+
+func (s *skippingStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	rs := reader.(io.ReadSeeker)
+	if _, err := rs.Seek(3, io.SeekStart); err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, rs)
+	size, _ := rs.Seek(0, io.SeekEnd)
+	return &UploadedFileMetadata{Key: options.FileName, Size: size}, nil
+}
+
+func TestGFileMux_ChecksumAlgorithm(t *testing.T) {
+	content := []byte("hello, checksum")
+	sha256Hex := fmt.Sprintf("%x", sha256.Sum256(content))
+	cases := []struct {
+		name  string
+		store Storage
+		opts  []GFileMuxOption
+		want  string
+	}{
+		{"buffered", &recordingStorage{}, []GFileMuxOption{WithChecksumAlgorithm(ChecksumAlgorithmSHA256)}, sha256Hex},
+		{"streamed", &recordingStorage{}, []GFileMuxOption{WithChecksumAlgorithm(ChecksumAlgorithmSHA256), WithStreaming(true)}, sha256Hex},
+		{"sha512", &recordingStorage{}, []GFileMuxOption{WithChecksumAlgorithm(ChecksumAlgorithmSHA512)}, fmt.Sprintf("%x", sha512.Sum512(content))},
+		{"backend skips bytes", &skippingStorage{}, []GFileMuxOption{WithChecksumAlgorithm(ChecksumAlgorithmSHA256)}, sha256Hex},
+		{"disabled", &recordingStorage{}, nil, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newTestHandler(t, append([]GFileMuxOption{WithStorage(tc.store)}, tc.opts...)...)
+
+			req := buildMultipartRequest(t, "file", "a.txt", content)
+			rr := httptest.NewRecorder()
+			var files Files
+			handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				files, _ = GetUploadedFilesFromContext(r)
+			})).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+			}
+			if got := files["file"][0].Checksum; got != tc.want {
+				t.Errorf("Checksum = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNew_UnsupportedChecksumAlgorithm(t *testing.T) {
+	if _, err := New(WithStorage(&MockStorage{}), WithChecksumAlgorithm("crc7")); err == nil {
+		t.Fatal("expected New to reject an unsupported checksum algorithm")
+	}
+}
@@ -0,0 +1,420 @@
+package GFileMux
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers used by ChunkedUpload.
+const (
+	// ChunkSessionHeader carries the session ID. The response to a session's
+	// first chunk sets it; the client sends it with every later chunk.
+	ChunkSessionHeader = "Upload-Session-Id"
+
+	// ChunkFileNameHeader carries the original file name, percent-encoded,
+	// with a session's first chunk.
+	ChunkFileNameHeader = "Upload-File-Name"
+)
+
+// ByteRange is an inclusive range of byte offsets, as in a Content-Range
+// header.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ChunkSession tracks a file being uploaded in chunks by ChunkedUpload.
+type ChunkSession struct {
+	ID        string    `json:"id"`
+	Bucket    string    `json:"bucket"`
+	FileName  string    `json:"file_name"`
+	TotalSize int64     `json:"total_size"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Received lists the byte ranges stored so far, sorted and merged.
+	Received []ByteRange `json:"received"`
+}
+
+// ReceivedBytes returns the number of bytes received so far.
+func (s ChunkSession) ReceivedBytes() int64 {
+	var n int64
+	for _, r := range s.Received {
+		n += r.End - r.Start + 1
+	}
+	return n
+}
+
+// Complete reports whether every byte of the file has been received. An empty
+// file is always complete.
+func (s ChunkSession) Complete() bool {
+	if s.TotalSize == 0 {
+		return true
+	}
+	return len(s.Received) == 1 && s.Received[0].Start == 0 && s.Received[0].End == s.TotalSize-1
+}
+
+// addRange records r as received, merging it with overlapping and adjacent
+// ranges.
+func (s *ChunkSession) addRange(r ByteRange) {
+	ranges := append(slices.Clone(s.Received), r)
+	slices.SortFunc(ranges, func(a, b ByteRange) int { return cmp.Compare(a.Start, b.Start) })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start > last.End+1 {
+			merged = append(merged, r)
+			continue
+		}
+		last.End = max(last.End, r.End)
+	}
+	s.Received = merged
+}
+
+// ChunkSessionStore persists ChunkSessions between the requests of a chunked
+// upload. Implementations must be safe for concurrent use. Plug in a shared
+// store, e.g. backed by Redis, when requests may reach different instances.
+type ChunkSessionStore interface {
+	// SaveChunkSession creates or replaces the session with session.ID.
+	SaveChunkSession(ctx context.Context, session ChunkSession) error
+
+	// LoadChunkSession returns the session with id. An unknown id is reported
+	// with an error wrapping fs.ErrNotExist.
+	LoadChunkSession(ctx context.Context, id string) (ChunkSession, error)
+
+	// DeleteChunkSession removes the session with id. Deleting an unknown id
+	// is not an error.
+	DeleteChunkSession(ctx context.Context, id string) error
+}
+
+// MemoryChunkSessionStore is a ChunkSessionStore held in memory. Its sessions
+// are lost when the process exits, so it suits single-instance deployments.
+type MemoryChunkSessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]ChunkSession
+}
+
+// NewMemoryChunkSessionStore returns an empty MemoryChunkSessionStore.
+func NewMemoryChunkSessionStore() *MemoryChunkSessionStore {
+	return &MemoryChunkSessionStore{sessions: make(map[string]ChunkSession)}
+}
+
+// SaveChunkSession creates or replaces the session with session.ID.
+func (s *MemoryChunkSessionStore) SaveChunkSession(ctx context.Context, session ChunkSession) error {
+	session.Received = slices.Clone(session.Received)
+	s.mu.Lock()
+	s.sessions[session.ID] = session
+	s.mu.Unlock()
+	return nil
+}
+
+// LoadChunkSession returns the session with id.
+func (s *MemoryChunkSessionStore) LoadChunkSession(ctx context.Context, id string) (ChunkSession, error) {
+	s.mu.RLock()
+	session, ok := s.sessions[id]
+	s.mu.RUnlock()
+	if !ok {
+		return ChunkSession{}, fmt.Errorf("unknown chunk session %q: %w", id, fs.ErrNotExist)
+	}
+	session.Received = slices.Clone(session.Received)
+	return session, nil
+}
+
+// DeleteChunkSession removes the session with id.
+func (s *MemoryChunkSessionStore) DeleteChunkSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// randomID returns 32 random hex characters (128 bits).
+func randomID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// isSessionID reports whether id has the form randomID produces, so it is
+// safe to use in a file name.
+func isSessionID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return len(id) == 32 && err == nil
+}
+
+// parseContentRange parses a "bytes <start>-<end>/<total>" Content-Range
+// header. The total must be known. An empty file is sent as "bytes */0",
+// which yields an empty range, one whose End is before its Start.
+func parseContentRange(header string) (ByteRange, int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return ByteRange{}, 0, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	rng, total, ok := strings.Cut(spec, "/")
+	if ok && rng == "*" && total == "0" {
+		return ByteRange{Start: 0, End: -1}, 0, nil
+	}
+	start, end, ok2 := strings.Cut(rng, "-")
+	if !ok || !ok2 {
+		return ByteRange{}, 0, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	var r ByteRange
+	var size int64
+	var err1, err2, err3 error
+	r.Start, err1 = strconv.ParseInt(start, 10, 64)
+	r.End, err2 = strconv.ParseInt(end, 10, 64)
+	size, err3 = strconv.ParseInt(total, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || r.Start < 0 || r.End < r.Start || r.End >= size {
+		return ByteRange{}, 0, fmt.Errorf("%w: %q", ErrInvalidContentRange, header)
+	}
+	return r, size, nil
+}
+
+// chunkPath returns where the received bytes of session id are kept.
+func (gfm *GFileMux) chunkPath(id string) string {
+	dir := gfm.chunkDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gfilemux-chunk-"+id)
+}
+
+// ChunkedUpload returns middleware that receives a file in chunks, so a large
+// upload over a flaky connection can resume where it stopped. Each request
+// carries one chunk as its raw body, with a "Content-Range: bytes
+// <start>-<end>/<total>" header; an empty file is sent as a single request
+// with "Content-Range: bytes */0" and no body. The first chunk, sent without
+// ChunkSessionHeader, starts a session and names the file in
+// ChunkFileNameHeader; every response carries the session ID in
+// ChunkSessionHeader and later chunks must send it back. Chunks may arrive in
+// any order and may be resent.
+//
+// Until the file is complete, ChunkedUpload answers 202 Accepted with the
+// ChunkSession as JSON, listing the ranges received. A request with the
+// session header and no Content-Range gets the same answer with 200 OK, to
+// find where to resume. The request that completes the file runs it through
+// the same pipeline as Upload — naming, validation, checksums and the storage
+// write — under field key, then calls next with the file in the request
+// context, as Upload does. The session ends once the file is stored or
+// rejected.
+//
+// Received bytes are kept in a temporary file under WithChunkDir, so all
+// requests of a session must reach an instance that shares that directory
+// and the WithChunkSessionStore store. Abandoned sessions are not cleaned up.
+func (gfm *GFileMux) ChunkedUpload(bucket, key string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fail := func(ctx context.Context, err error) {
+				gfm.log(ctx, errorLogLevel(err), "chunked upload failed", "error", err)
+				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
+			}
+			if r.Header.Get(ChunkSessionHeader) == "" {
+				// Only new sessions are refused, so open ones can drain.
+				if err := gfm.checkAccepting(); err != nil {
+					fail(r.Context(), err)
+					return
+				}
+			}
+			if err := gfm.checkBucket(bucket); err != nil {
+				fail(r.Context(), err)
+				return
+			}
+			ctx, err := gfm.requestContext(r.Context(), r)
+			if err != nil {
+				fail(ctx, err)
+				return
+			}
+
+			session, err := gfm.receiveChunk(ctx, r, bucket, key)
+			if err != nil {
+				fail(ctx, err)
+				return
+			}
+			w.Header().Set(ChunkSessionHeader, session.ID)
+			if !session.Complete() {
+				status := http.StatusAccepted
+				if r.Header.Get("Content-Range") == "" {
+					status = http.StatusOK
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(session)
+				return
+			}
+
+			files, err := gfm.finishChunkedUpload(ctx, session, key)
+			if err != nil {
+				fail(ctx, err)
+				return
+			}
+			r = r.WithContext(addFilesToContext(r.Context(), files))
+			if gfm.writeSuccessResponse(w, r, bucket, files) {
+				return
+			}
+			gfm.serveNext(w, r, next, files)
+		})
+	}
+}
+
+// receiveChunk stores the chunk in r's body, if any, and returns the updated
+// session. A session found complete is deleted from the store, so only one
+// request finishes it.
+func (gfm *GFileMux) receiveChunk(ctx context.Context, r *http.Request, bucket, key string) (ChunkSession, error) {
+	id := r.Header.Get(ChunkSessionHeader)
+	header := r.Header.Get("Content-Range")
+	if id != "" && header == "" {
+		return gfm.loadChunkSession(ctx, id, bucket)
+	}
+	rng, total, err := parseContentRange(header)
+	if err != nil {
+		return ChunkSession{}, err
+	}
+	if maxSize := gfm.fieldMaxSize(key, gfm.requestMaxSize(r, 0)); total > maxSize {
+		return ChunkSession{}, &SizeError{Field: key, Size: total, MaxSize: maxSize}
+	}
+
+	var session ChunkSession
+	if id == "" {
+		if err := gfm.checkQuota(ctx, r, total, 1); err != nil {
+			return ChunkSession{}, err
+		}
+		if session, err = gfm.startChunkSession(ctx, r, bucket, total); err != nil {
+			return ChunkSession{}, err
+		}
+	} else if session, err = gfm.loadChunkSession(ctx, id, bucket); err != nil {
+		return ChunkSession{}, err
+	}
+	if total != session.TotalSize {
+		return ChunkSession{}, fmt.Errorf("%w: total %d does not match the session's %d", ErrInvalidContentRange, total, session.TotalSize)
+	}
+
+	if err := gfm.writeChunk(r, session.ID, rng); err != nil {
+		return ChunkSession{}, err
+	}
+
+	// Load, merge and save under a lock so concurrent chunks of one session
+	// do not lose each other's ranges.
+	gfm.chunkMu.Lock()
+	defer gfm.chunkMu.Unlock()
+	if session, err = gfm.loadChunkSession(ctx, session.ID, bucket); err != nil {
+		return ChunkSession{}, err
+	}
+	if rng.End >= rng.Start {
+		session.addRange(rng)
+	}
+	if session.Complete() {
+		err = gfm.chunkSessions.DeleteChunkSession(ctx, session.ID)
+	} else {
+		err = gfm.chunkSessions.SaveChunkSession(ctx, session)
+	}
+	if err != nil {
+		return ChunkSession{}, fmt.Errorf("could not save chunk session: %w", err)
+	}
+	return session, nil
+}
+
+// startChunkSession creates a session for a file of total bytes, along with
+// the temporary file its chunks are written to.
+func (gfm *GFileMux) startChunkSession(ctx context.Context, r *http.Request, bucket string, total int64) (ChunkSession, error) {
+	name, err := url.PathUnescape(r.Header.Get(ChunkFileNameHeader))
+	if err != nil {
+		return ChunkSession{}, &ValidationError{Message: fmt.Sprintf("invalid %s header: %v", ChunkFileNameHeader, err)}
+	}
+	id, err := randomID()
+	if err != nil {
+		return ChunkSession{}, fmt.Errorf("could not generate chunk session ID: %w", err)
+	}
+	f, err := os.OpenFile(gfm.chunkPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return ChunkSession{}, fmt.Errorf("could not create chunk file: %w", err)
+	}
+	f.Close()
+
+	session := ChunkSession{ID: id, Bucket: bucket, FileName: name, TotalSize: total, CreatedAt: time.Now()}
+	if err := gfm.chunkSessions.SaveChunkSession(ctx, session); err != nil {
+		os.Remove(gfm.chunkPath(id))
+		return ChunkSession{}, fmt.Errorf("could not save chunk session: %w", err)
+	}
+	gfm.log(ctx, slog.LevelInfo, "chunked upload started", "bucket", bucket, "session", id, "total_size", total)
+	return session, nil
+}
+
+// loadChunkSession returns the session with id for bucket, reporting unknown
+// and malformed IDs, and sessions of other buckets, as ErrChunkSessionNotFound.
+func (gfm *GFileMux) loadChunkSession(ctx context.Context, id, bucket string) (ChunkSession, error) {
+	if !isSessionID(id) {
+		return ChunkSession{}, fmt.Errorf("%w: %q", ErrChunkSessionNotFound, id)
+	}
+	session, err := gfm.chunkSessions.LoadChunkSession(ctx, id)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && session.Bucket != bucket) {
+		return ChunkSession{}, fmt.Errorf("%w: %q", ErrChunkSessionNotFound, id)
+	}
+	if err != nil {
+		return ChunkSession{}, fmt.Errorf("could not load chunk session: %w", err)
+	}
+	return session, nil
+}
+
+// writeChunk copies r's body, which must hold exactly the bytes of rng, into
+// the session's temporary file at rng.Start.
+func (gfm *GFileMux) writeChunk(r *http.Request, id string, rng ByteRange) error {
+	want := rng.End - rng.Start + 1
+	f, err := os.OpenFile(gfm.chunkPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("could not open chunk file: %w", err)
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(f, rng.Start), io.LimitReader(r.Body, want))
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		return fmt.Errorf("could not write chunk file: %w", closeErr)
+	}
+	if err != nil {
+		return gfm.requestError(r.Context(), r, err)
+	}
+	if extra, _ := r.Body.Read(make([]byte, 1)); n != want || extra > 0 {
+		return fmt.Errorf("%w: body does not match the declared %d bytes", ErrInvalidContentRange, want)
+	}
+	return nil
+}
+
+// finishChunkedUpload stores a completed session's file and removes its
+// temporary file.
+func (gfm *GFileMux) finishChunkedUpload(ctx context.Context, session ChunkSession, key string) (Files, error) {
+	path := gfm.chunkPath(session.ID)
+	defer os.Remove(path)
+
+	ctx, cancel := gfm.batchContext(ctx)
+	defer cancel()
+	src := fileSource{
+		field: key,
+		name:  session.FileName,
+		size:  session.TotalSize,
+		open: func() (io.ReadSeekCloser, error) {
+			return os.Open(path)
+		},
+	}
+	results, err := gfm.uploadFields(ctx, session.Bucket, []fieldSources{{field: key, sources: []fileSource{src}}})
+	if err != nil {
+		return nil, err
+	}
+	gfm.log(ctx, slog.LevelInfo, "chunked upload completed", "bucket", session.Bucket, "session", session.ID)
+	return Files{key: results[0]}, nil
+}
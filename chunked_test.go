@@ -0,0 +1,167 @@
+package GFileMux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkSession_addRange(t *testing.T) {
+	var s ChunkSession
+	for _, r := range []ByteRange{{10, 19}, {0, 4}, {30, 39}, {5, 9}, {15, 25}} {
+		s.addRange(r)
+	}
+	want := []ByteRange{{0, 25}, {30, 39}}
+	if !reflect.DeepEqual(s.Received, want) {
+		t.Errorf("Received = %v, want %v", s.Received, want)
+	}
+	if s.ReceivedBytes() != 36 {
+		t.Errorf("ReceivedBytes = %d, want 36", s.ReceivedBytes())
+	}
+}
+
+// sendChunk sends content[start:end+1] of a len(content)-byte file.
+func sendChunk(t *testing.T, h http.Handler, session, content string, start, end int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(content[start:end+1]))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+	if session == "" {
+		req.Header.Set(ChunkFileNameHeader, "r%C3%A9sum%C3%A9.txt")
+	} else {
+		req.Header.Set(ChunkSessionHeader, session)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGFileMux_ChunkedUpload(t *testing.T) {
+	store := &recordingStorage{}
+	dir := t.TempDir()
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithChunkDir(dir),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+	var files Files
+	h := handler.ChunkedUpload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	}))
+
+	const content = "0123456789abcdefghij"
+	rr := sendChunk(t, h, "", content, 10, 14)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("first chunk: expected 202, got %d: %s", rr.Code, rr.Body)
+	}
+	id := rr.Header().Get(ChunkSessionHeader)
+	var session ChunkSession
+	if err := json.Unmarshal(rr.Body.Bytes(), &session); err != nil || session.ID != id || session.TotalSize != 20 {
+		t.Fatalf("unexpected session %+v (%v) for ID %q", session, err, id)
+	}
+
+	for _, c := range [][2]int{{0, 9}, {0, 4}} {
+		if rr := sendChunk(t, h, id, content, c[0], c[1]); rr.Code != http.StatusAccepted {
+			t.Fatalf("chunk %v: expected 202, got %d: %s", c, rr.Code, rr.Body)
+		}
+	}
+
+	status := httptest.NewRequest(http.MethodPut, "/", nil)
+	status.Header.Set(ChunkSessionHeader, id)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, status)
+	json.Unmarshal(rr.Body.Bytes(), &session)
+	if rr.Code != http.StatusOK || !reflect.DeepEqual(session.Received, []ByteRange{{0, 14}}) {
+		t.Fatalf("status: got %d with ranges %v", rr.Code, session.Received)
+	}
+
+	if rr := sendChunk(t, h, id, content, 15, 19); rr.Code != http.StatusOK {
+		t.Fatalf("last chunk: expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if got := files["file"]; len(got) != 1 || got[0].OriginalName != "résumé.txt" || got[0].Size != 20 {
+		t.Fatalf("unexpected files %+v", got)
+	}
+	if string(store.files["résumé.txt"]) != content {
+		t.Errorf("stored %q, want %q", store.files["résumé.txt"], content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the chunk file to be removed, found %v", entries)
+	}
+	if rr := sendChunk(t, h, id, content, 0, 4); rr.Code != http.StatusNotFound {
+		t.Errorf("finished session: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestGFileMux_ChunkedUpload_EmptyFile(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithChunkDir(t.TempDir()),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+	var files Files
+	h := handler.ChunkedUpload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodPut, "/", http.NoBody)
+	req.Header.Set("Content-Range", "bytes */0")
+	req.Header.Set(ChunkFileNameHeader, "empty.txt")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if got := files["file"]; len(got) != 1 || got[0].Size != 0 {
+		t.Fatalf("unexpected files %+v", got)
+	}
+	if data, ok := store.files["empty.txt"]; !ok || len(data) != 0 {
+		t.Errorf("expected an empty stored file, got %q (stored: %v)", data, ok)
+	}
+}
+
+func TestGFileMux_ChunkedUpload_Errors(t *testing.T) {
+	handler := newTestHandler(t, WithChunkDir(t.TempDir()), WithMaxFileSize(100))
+	h := handler.ChunkedUpload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	first := sendChunk(t, h, "", "0123456789", 0, 4)
+	id := first.Header().Get(ChunkSessionHeader)
+
+	cases := []struct {
+		name    string
+		session string
+		rng     string
+		body    string
+		want    int
+	}{
+		{"missing range", "", "", "x", http.StatusBadRequest},
+		{"malformed range", "", "bytes 5-1/10", "x", http.StatusBadRequest},
+		{"too large", "", "bytes 0-0/101", "x", http.StatusRequestEntityTooLarge},
+		{"unknown range of non-empty file", "", "bytes */10", "", http.StatusBadRequest},
+		{"body for empty file", "", "bytes */0", "x", http.StatusBadRequest},
+		{"unknown session", strings.Repeat("ab", 16), "bytes 0-0/10", "x", http.StatusNotFound},
+		{"path in session ID", "../../etc/passwd", "bytes 0-0/10", "x", http.StatusNotFound},
+		{"total mismatch", id, "bytes 5-5/11", "x", http.StatusBadRequest},
+		{"short body", id, "bytes 5-9/10", "56", http.StatusBadRequest},
+		{"long body", id, "bytes 5-6/10", "5678", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(tc.body))
+		if tc.rng != "" {
+			req.Header.Set("Content-Range", tc.rng)
+		}
+		if tc.session != "" {
+			req.Header.Set(ChunkSessionHeader, tc.session)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.want, rr.Code, rr.Body)
+		}
+	}
+}
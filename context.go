@@ -3,7 +3,9 @@ package GFileMux
 import (
 	"context"
 	"errors"
+	"maps"
 	"net/http"
+	"slices"
 )
 
 // fileContextKey is the key type used to store files in context.
@@ -15,11 +17,19 @@ const fileKey fileContextKey = "files"
 // Files is a map of field name → slice of uploaded files for that field.
 type Files map[string][]File
 
-// All returns a flat slice of every uploaded File across all form fields.
+// All returns a flat slice of every uploaded File across all form fields. It
+// is equivalent to Flatten.
 func (f Files) All() []File {
-	var all []File
-	for _, files := range f {
-		all = append(all, files...)
+	return f.Flatten()
+}
+
+// Flatten returns every uploaded File across all form fields as one slice, for
+// callers that don't care about field grouping. The order is stable: fields
+// sorted by name, and each field's files in the order they were submitted.
+func (f Files) Flatten() []File {
+	all := make([]File, 0, f.Count())
+	for _, field := range slices.Sorted(maps.Keys(f)) {
+		all = append(all, f[field]...)
 	}
 	return all
 }
@@ -34,19 +44,20 @@ func (f Files) Count() int {
 }
 
 // addFilesToContext stores the provided files in the context under the key `fileKey`.
-// If files already exist in the context, the new ones are appended.
+// If files already exist in the context, the new ones are appended. The map held
+// by the parent context is copied rather than mutated.
 func addFilesToContext(ctx context.Context, files Files) context.Context {
-	// Retrieve the existing files from the context, if any.
-	existingFiles, _ := ctx.Value(fileKey).(Files)
-	if existingFiles == nil {
-		// If no existing files, initialize an empty map.
-		existingFiles = make(Files)
+	// Copy the existing files from the context, if any.
+	existingFiles := make(Files)
+	if parent, ok := ctx.Value(fileKey).(Files); ok {
+		for fieldName, fileSlice := range parent {
+			existingFiles[fieldName] = slices.Clone(fileSlice)
+		}
 	}
 
-	// Iterate over the provided files and append them to the corresponding field names.
-	for _, fileSlice := range files {
+	// Iterate over the provided files and append them, in order, to their field.
+	for fieldName, fileSlice := range files {
 		if len(fileSlice) > 0 {
-			fieldName := fileSlice[0].FieldName
 			existingFiles[fieldName] = append(existingFiles[fieldName], fileSlice...)
 		}
 	}
@@ -2,6 +2,7 @@ package GFileMux
 
 import (
 	"net/http/httptest"
+	"slices"
 	"testing"
 
 	"net/http"
@@ -39,6 +40,24 @@ func TestFiles_All(t *testing.T) {
 	}
 }
 
+func TestFiles_Flatten(t *testing.T) {
+	f := Files{
+		"images": {{OriginalName: "a.jpg"}, {OriginalName: "b.jpg"}},
+		"docs":   {{OriginalName: "c.pdf"}},
+		"empty":  nil,
+	}
+	var names []string
+	for _, file := range f.Flatten() {
+		names = append(names, file.OriginalName)
+	}
+	if want := []string{"c.pdf", "a.jpg", "b.jpg"}; !slices.Equal(names, want) {
+		t.Fatalf("Flatten() = %v, want %v", names, want)
+	}
+	if got := (Files{}).Flatten(); got == nil || len(got) != 0 {
+		t.Fatalf("expected an empty, non-nil slice for empty Files, got %#v", got)
+	}
+}
+
 func TestFiles_Count(t *testing.T) {
 	f := Files{
 		"images": {{OriginalName: "a.jpg"}, {OriginalName: "b.jpg"}},
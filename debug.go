@@ -0,0 +1,60 @@
+package GFileMux
+
+import (
+	"context"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// partSummary describes one multipart part for WithDebugUploads, without its
+// content.
+type partSummary struct {
+	field       string
+	file        bool
+	contentType string
+	size        int64 // -1 when the part was not read to the end
+}
+
+// formParts summarizes the parts of a parsed form, ordered by field name as
+// ParseMultipartForm does not keep submission order.
+func formParts(form *multipart.Form) []partSummary {
+	if form == nil {
+		return nil
+	}
+	var parts []partSummary
+	for field, values := range form.Value {
+		for _, v := range values {
+			parts = append(parts, partSummary{field: field, size: int64(len(v))})
+		}
+	}
+	for field, headers := range form.File {
+		for _, h := range headers {
+			parts = append(parts, partSummary{field: field, file: true, contentType: h.Header.Get("Content-Type"), size: h.Size})
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].field < parts[j].field })
+	return parts
+}
+
+// logUploadDebug logs the multipart layout of r for WithDebugUploads: its
+// boundary, part count and each part's field, declared content type and size.
+func (gfm *GFileMux) logUploadDebug(ctx context.Context, r *http.Request, parts []partSummary, err error) {
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	attrs := make([]any, 0, len(parts))
+	for i, p := range parts {
+		group := []any{"field", p.field, "file", p.file, "size", p.size}
+		if p.contentType != "" {
+			group = append(group, "content_type", p.contentType)
+		}
+		attrs = append(attrs, slog.Group(strconv.Itoa(i), group...))
+	}
+	args := []any{"boundary", params["boundary"], "content_length", r.ContentLength, "parts", len(parts), slog.Group("part", attrs...)}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	gfm.log(ctx, slog.LevelInfo, "multipart debug", args...)
+}
@@ -0,0 +1,66 @@
+package GFileMux
+
+import (
+	"bytes"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGFileMux_DebugUploads(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		var logs bytes.Buffer
+		handler := newTestHandler(t,
+			WithStorage(&recordingStorage{}),
+			WithStreaming(streaming),
+			WithDebugUploads(true),
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		)
+
+		req := buildMultipartRequestParts(t,
+			formPart{"avatar", "me.png", []byte("secret-bytes")},
+			formPart{"ignored", "x.txt", []byte("more-secret")},
+		)
+		_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "avatar")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("streaming=%v: expected 200, got %d: %s", streaming, rr.Code, rr.Body)
+		}
+
+		out := logs.String()
+		for _, want := range []string{
+			"multipart debug",
+			"boundary=" + params["boundary"],
+			"parts=2",
+			"part.0.field=avatar",
+			"part.0.content_type=application/octet-stream",
+			"part.0.size=12",
+			"part.1.field=ignored",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("streaming=%v: expected %q in the debug log, got %s", streaming, want, out)
+			}
+		}
+		if strings.Contains(out, "secret") || strings.Contains(out, "me.png") {
+			t.Errorf("streaming=%v: file contents or names were logged: %s", streaming, out)
+		}
+	}
+}
+
+func TestGFileMux_DebugUploads_ParseError(t *testing.T) {
+	var logs bytes.Buffer
+	handler := newTestHandler(t, WithDebugUploads(true), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("--nope\r\nbroken"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=client-boundary")
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	if out := logs.String(); !strings.Contains(out, "boundary=client-boundary") || !strings.Contains(out, "parts=0") || !strings.Contains(out, "error=") {
+		t.Errorf("expected the boundary and parse error logged, got %s", out)
+	}
+}
@@ -0,0 +1,240 @@
+package GFileMux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadHandler returns an http.Handler that serves files stored in s, the
+// counterpart to the Upload middleware. keyFromRequest selects the file for a
+// request through the Bucket and Key of the returned PathOptions; an empty Key
+// responds 404. Authorization belongs in middleware wrapped around the handler.
+//
+// The file is streamed with its stored Content-Type and Content-Length, and
+// Range requests are honored. Files missing from storage (errors wrapping
+// fs.ErrNotExist) respond 404; other storage errors respond 500.
+//
+// Every response carries X-Content-Type-Options: nosniff, so browsers never
+// render a file as a type other than the stored one. Files are served inline
+// by default; pass DownloadAsAttachment to have browsers save them instead,
+// which keeps user-uploaded HTML or SVG from rendering on the app's origin.
+//
+// The stored checksum (see ChecksumMetadataKey) is sent as the ETag and the
+// stored ModTime as Last-Modified, when the backend reports them, and
+// If-None-Match and If-Modified-Since requests are answered with 304 Not
+// Modified. When s implements Statter, HEAD and conditional requests are
+// answered from Stat, so the content is only read when it is sent.
+//
+// s must implement Opener, as every bundled backend does; DownloadHandler
+// panics otherwise.
+//
+// Example:
+//
+//	http.Handle("GET /files/{key}", GFileMux.DownloadHandler(store, func(r *http.Request) GFileMux.PathOptions {
+//	    return GFileMux.PathOptions{Bucket: "avatars", Key: r.PathValue("key")}
+//	}))
+func DownloadHandler(s Storage, keyFromRequest func(*http.Request) PathOptions, opts ...DownloadOption) http.Handler {
+	if !implements[Opener](s) {
+		panic("GFileMux: DownloadHandler requires a storage backend that implements Opener")
+	}
+	opener := s.(Opener)
+	var statter Statter
+	if implements[Statter](s) {
+		statter = s.(Statter)
+	}
+	var cfg downloadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		target := keyFromRequest(r)
+		if target.Key == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if statter != nil && (r.Method == http.MethodHead || isConditional(r)) {
+			meta, err := statter.Stat(r.Context(), target.Bucket, target.Key)
+			if err != nil {
+				downloadError(w, r, err)
+				return
+			}
+			if notModified(r, meta) {
+				writeNotModified(w, meta)
+				return
+			}
+			if r.Method == http.MethodHead {
+				// No body is written, so ServeContent only needs the size.
+				cfg.setContentHeaders(w, target.Key, meta)
+				http.ServeContent(w, r, "", meta.ModTime, &forwardSeeker{r: http.NoBody, size: meta.Size})
+				return
+			}
+		}
+
+		rc, meta, err := opener.Open(r.Context(), target.Bucket, target.Key)
+		if err != nil {
+			downloadError(w, r, err)
+			return
+		}
+		defer rc.Close()
+
+		cfg.setContentHeaders(w, target.Key, meta)
+		content, ok := rc.(io.ReadSeeker)
+		if !ok {
+			content = &forwardSeeker{r: rc, size: meta.Size}
+		}
+		// ServeContent handles Range, conditional requests and HEAD, and sets
+		// Content-Length.
+		http.ServeContent(w, r, "", meta.ModTime, content)
+	})
+}
+
+// DownloadOption configures DownloadHandler.
+type DownloadOption func(*downloadConfig)
+
+type downloadConfig struct {
+	attachment bool
+}
+
+// DownloadAsAttachment serves files with Content-Disposition: attachment, named
+// after the last element of the key, so browsers download them rather than
+// display them. By default files are served inline.
+func DownloadAsAttachment(enable bool) DownloadOption {
+	return func(c *downloadConfig) {
+		c.attachment = enable
+	}
+}
+
+// setContentHeaders sets the Content-Type, X-Content-Type-Options,
+// Content-Disposition and, when the checksum is known, the ETag of a download
+// of key from its metadata.
+func (c downloadConfig) setContentHeaders(w http.ResponseWriter, key string, meta *UploadedFileMetadata) {
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	disposition := "inline"
+	if c.attachment {
+		disposition = "attachment"
+	}
+	if name := path.Base(key); name != "." && name != "/" {
+		if d := mime.FormatMediaType(disposition, map[string]string{"filename": name}); d != "" {
+			disposition = d
+		}
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	if checksum := meta.Metadata[ChecksumMetadataKey]; checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(checksum))
+	}
+}
+
+// writeNotModified answers a conditional request whose cached copy is current.
+func writeNotModified(w http.ResponseWriter, meta *UploadedFileMetadata) {
+	if checksum := meta.Metadata[ChecksumMetadataKey]; checksum != "" {
+		w.Header().Set("ETag", strconv.Quote(checksum))
+	}
+	if !meta.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", meta.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// isConditional reports whether r asks for the file only if it changed.
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified reports whether the client's cached copy described by r's
+// conditional headers is still current, following RFC 9110: If-None-Match
+// takes precedence over If-Modified-Since.
+func notModified(r *http.Request, meta *UploadedFileMetadata) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		checksum := meta.Metadata[ChecksumMetadataKey]
+		if checksum == "" {
+			return false
+		}
+		etag := strconv.Quote(checksum)
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if meta.ModTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !meta.ModTime.Truncate(time.Second).After(since)
+}
+
+// downloadError responds 404 for a missing file and 500 otherwise.
+func downloadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// forwardSeeker lets http.ServeContent serve ranges from a reader that cannot
+// seek, given its size. Seeks only move a logical offset; the next Read skips
+// forward to it by discarding bytes. Seeking back before data already read is
+// an error, so ranges must be requested in ascending order.
+type forwardSeeker struct {
+	r      io.Reader
+	size   int64
+	pos    int64 // bytes consumed from r
+	offset int64 // position set by Seek
+}
+
+func (s *forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *forwardSeeker) Read(p []byte) (int, error) {
+	if s.offset < s.pos {
+		return 0, errors.New("cannot seek backward in a non-seekable download")
+	}
+	if s.offset > s.pos {
+		n, err := io.CopyN(io.Discard, s.r, s.offset-s.pos)
+		s.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	s.offset = s.pos
+	return n, err
+}
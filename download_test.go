@@ -0,0 +1,186 @@
+package GFileMux
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadHandler(t *testing.T) {
+	store := &openableStorage{files: map[string][]byte{"report.txt": []byte("0123456789")}}
+	handler := DownloadHandler(store, func(r *http.Request) PathOptions {
+		return PathOptions{Bucket: "docs", Key: r.URL.Query().Get("key")}
+	})
+
+	cases := []struct {
+		name       string
+		method     string
+		key        string
+		rangeHdr   string
+		wantStatus int
+		wantBody   string
+	}{
+		{"full file", http.MethodGet, "report.txt", "", http.StatusOK, "0123456789"},
+		{"range", http.MethodGet, "report.txt", "bytes=3-5", http.StatusPartialContent, "345"},
+		{"suffix range", http.MethodGet, "report.txt", "bytes=-2", http.StatusPartialContent, "89"},
+		{"missing file", http.MethodGet, "nope.txt", "", http.StatusNotFound, ""},
+		{"empty key", http.MethodGet, "", "", http.StatusNotFound, ""},
+		{"head", http.MethodHead, "report.txt", "", http.StatusOK, ""},
+		{"wrong method", http.MethodPost, "report.txt", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/?key="+tc.key, nil)
+			if tc.rangeHdr != "" {
+				req.Header.Set("Range", tc.rangeHdr)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, rr.Code)
+			}
+			if tc.wantBody != "" && rr.Body.String() != tc.wantBody {
+				t.Errorf("expected body %q, got %q", tc.wantBody, rr.Body)
+			}
+			if rr.Code == http.StatusOK {
+				if got := rr.Header().Get("Content-Length"); got != "10" {
+					t.Errorf("expected Content-Length 10, got %q", got)
+				}
+				if got := rr.Header().Get("Content-Type"); got != "application/octet-stream" {
+					t.Errorf("expected the default Content-Type, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadHandler_RequiresOpener(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a backend without Opener")
+		}
+	}()
+	DownloadHandler(&MockStorage{}, func(*http.Request) PathOptions { return PathOptions{} })
+}
+
+func TestDownloadHandler_ContentDisposition(t *testing.T) {
+	store := &openableStorage{files: map[string][]byte{"u/page.html": []byte("<script></script>")}}
+	keyFunc := func(r *http.Request) PathOptions {
+		return PathOptions{Bucket: "docs", Key: "u/page.html"}
+	}
+
+	cases := []struct {
+		name            string
+		opts            []DownloadOption
+		wantDisposition string
+	}{
+		{"inline by default", nil, `inline; filename=page.html`},
+		{"attachment", []DownloadOption{DownloadAsAttachment(true)}, `attachment; filename=page.html`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			DownloadHandler(store, keyFunc, tc.opts...).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("expected X-Content-Type-Options nosniff, got %q", got)
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != tc.wantDisposition {
+				t.Errorf("expected Content-Disposition %q, got %q", tc.wantDisposition, got)
+			}
+		})
+	}
+}
+
+// cacheableStorage serves one file with a stored checksum and modification
+// time, counting how often its content is opened.
+type cacheableStorage struct {
+	openableStorage
+	modTime time.Time
+	opens   int
+}
+
+func (cs *cacheableStorage) meta(key string) *UploadedFileMetadata {
+	return &UploadedFileMetadata{
+		Key:      key,
+		Size:     int64(len(cs.files[key])),
+		Metadata: map[string]string{ChecksumMetadataKey: "abc123"},
+		ModTime:  cs.modTime,
+	}
+}
+
+func (cs *cacheableStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *UploadedFileMetadata, error) {
+	cs.opens++
+	rc, _, err := cs.openableStorage.Open(ctx, bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, cs.meta(key), nil
+}
+
+func (cs *cacheableStorage) Stat(ctx context.Context, bucket, key string) (*UploadedFileMetadata, error) {
+	return cs.meta(key), nil
+}
+
+func TestDownloadHandler_ConditionalRequests(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &cacheableStorage{
+		openableStorage: openableStorage{files: map[string][]byte{"a.txt": []byte("hello")}},
+		modTime:         modTime,
+	}
+	handler := DownloadHandler(store, func(r *http.Request) PathOptions {
+		return PathOptions{Key: "a.txt"}
+	})
+
+	cases := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"no condition", "", "", http.StatusOK},
+		{"etag matches", "If-None-Match", `"abc123"`, http.StatusNotModified},
+		{"weak etag in list", "If-None-Match", `"zzz", W/"abc123"`, http.StatusNotModified},
+		{"etag differs", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store.opens = 0
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, rr.Code)
+			}
+			if got := rr.Header().Get("ETag"); got != `"abc123"` {
+				t.Errorf("expected the checksum as ETag, got %q", got)
+			}
+			switch tc.wantStatus {
+			case http.StatusNotModified:
+				if store.opens != 0 || rr.Body.Len() != 0 {
+					t.Errorf("a 304 should not read the content: %d opens, body %q", store.opens, rr.Body)
+				}
+			case http.StatusOK:
+				if rr.Body.String() != "hello" {
+					t.Errorf("expected the file content, got %q", rr.Body)
+				}
+				if got := rr.Header().Get("Last-Modified"); got != modTime.Format(http.TimeFormat) {
+					t.Errorf("expected Last-Modified %q, got %q", modTime.Format(http.TimeFormat), got)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,79 @@
 package GFileMux
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusClientClosedRequest is the non-standard status code (popularised by
+// nginx) reported for requests whose client disconnected mid-upload.
+const StatusClientClosedRequest = 499
+
+// ErrClientDisconnected is returned when the client goes away before the
+// upload completes, e.g. the connection is closed while the body is being read.
+var ErrClientDisconnected = errors.New("GFileMux: client disconnected before the upload completed")
+
+// ErrMemoryBudgetExhausted is returned when admitting a request would exceed
+// the process-wide budget set by WithGlobalMemoryBudget.
+var ErrMemoryBudgetExhausted = errors.New("GFileMux: upload memory budget exhausted, try again later")
+
+// ErrUploadsPaused is wrapped by the *PausedError returned while uploads are
+// paused with SetAcceptingUploads.
+var ErrUploadsPaused = errors.New("GFileMux: uploads are paused, try again later")
+
+// PausedError is returned by Upload, and by ChunkedUpload for new sessions,
+// while SetAcceptingUploads(false) is in effect. RetryAfter is the wait
+// suggested to clients (see WithPausedRetryAfter).
+type PausedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *PausedError) Error() string {
+	return ErrUploadsPaused.Error()
+}
+
+func (e *PausedError) Unwrap() error {
+	return ErrUploadsPaused
+}
+
+// ErrNegativeSize is returned when a storage backend reports a negative size
+// for a file it stored. The file is deleted again and the upload fails.
+var ErrNegativeSize = errors.New("GFileMux: storage backend reported a negative file size")
+
+// ErrNoFilesUploaded is returned when a request carries no files for one or
+// more of the handler's fields and WithIgnoreNonExistentKey is off. The
+// returned error wraps it and lists the missing fields.
+var ErrNoFilesUploaded = errors.New("GFileMux: no files were provided")
+
+// noFilesError reports the fields that received no files.
+func noFilesError(fields []string) error {
+	return fmt.Errorf("%w in fields: %s", ErrNoFilesUploaded, strings.Join(fields, ", "))
+}
+
+// ErrEmptyKey is returned by storage backends when a file name or key is
+// empty or only whitespace. See NormalizeLocation.
+var ErrEmptyKey = errors.New("GFileMux: file name or key is required")
+
+// ErrFileExists is returned when an upload would replace a stored file and
+// WithOverwritePolicy is OverwriteError, or OverwriteRename found no free name.
+var ErrFileExists = errors.New("GFileMux: a file with this key already exists")
+
+// ErrChunkSessionNotFound is returned by ChunkedUpload when a request names a
+// chunk session that does not exist, has finished, or belongs to another bucket.
+var ErrChunkSessionNotFound = errors.New("GFileMux: chunk session not found")
+
+// ErrInvalidContentRange is returned by ChunkedUpload when a chunk's
+// Content-Range header is missing or malformed, disagrees with its session's
+// total size, or does not match the length of the body.
+var ErrInvalidContentRange = errors.New("GFileMux: invalid Content-Range")
+
+// ErrQuotaExceeded is returned, wrapped, by a QuotaCheckerFunc to reject a
+// request that would exceed the caller's storage quota. See WithQuotaChecker.
+var ErrQuotaExceeded = errors.New("GFileMux: storage quota exceeded")
 
 // ValidationError is returned when a file fails validation (e.g. wrong MIME type, extension, or size).
 // Callers can detect this with errors.As to distinguish validation failures from infrastructure errors.
@@ -21,29 +94,126 @@ type SizeError struct {
 	Field   string
 	Size    int64 // actual size in bytes
 	MaxSize int64 // configured limit in bytes
+
+	// Total is set for the WithMaxTotalUploadSize limit: Size is then the
+	// combined size of the request's files so far, and Field names the field
+	// whose file crossed the limit.
+	Total bool
 }
 
 func (e *SizeError) Error() string {
+	if e.Total {
+		return fmt.Sprintf(
+			"GFileMux: uploaded files total %d bytes, max allowed is %d bytes (exceeded at field %q)",
+			e.Size, e.MaxSize, e.Field,
+		)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf(
+			"GFileMux: request body is too large: got %d bytes, max allowed is %d bytes",
+			e.Size, e.MaxSize,
+		)
+	}
 	return fmt.Sprintf(
 		"GFileMux: file in field %q is too large: got %d bytes, max allowed is %d bytes",
 		e.Field, e.Size, e.MaxSize,
 	)
 }
 
-// MaxFilesError is returned when the number of files in a field exceeds WithMaxFiles.
+// MaxFilesError is returned when the number of files in a field exceeds WithMaxFiles,
+// or the number in the request exceeds WithMaxTotalFiles.
 type MaxFilesError struct {
 	Field    string
 	Got      int
 	MaxFiles int
+
+	// Total is set for the WithMaxTotalFiles limit: Got and MaxFiles then
+	// count the files of every field, and Field names the one whose files
+	// crossed the limit.
+	Total bool
 }
 
 func (e *MaxFilesError) Error() string {
+	if e.Total {
+		return fmt.Sprintf(
+			"GFileMux: too many files in request: got %d, max allowed is %d (exceeded at field %q)",
+			e.Got, e.MaxFiles, e.Field,
+		)
+	}
 	return fmt.Sprintf(
 		"GFileMux: too many files in field %q: got %d, max allowed is %d",
 		e.Field, e.Got, e.MaxFiles,
 	)
 }
 
+// HeaderSizeError is returned when a multipart part's headers exceed the
+// limit set by WithFileHeaderSizeLimit.
+type HeaderSizeError struct {
+	Field   string // form field name of the part, when it has one
+	Size    int    // header bytes in the part
+	MaxSize int    // configured limit in bytes
+}
+
+func (e *HeaderSizeError) Error() string {
+	return fmt.Sprintf(
+		"GFileMux: headers of part %q are too large: got %d bytes, max allowed is %d bytes",
+		e.Field, e.Size, e.MaxSize,
+	)
+}
+
+// ContextLimitError is returned when the files accumulated in a request's
+// context would exceed the limits set by WithContextFileLimitEnforcement.
+// A zero MaxFiles or MaxSize means that dimension is not limited. Field names
+// the form field whose files crossed the limit, when known.
+type ContextLimitError struct {
+	Field    string
+	Files    int
+	MaxFiles int
+	Size     int64
+	MaxSize  int64
+}
+
+func (e *ContextLimitError) Error() string {
+	var at string
+	if e.Field != "" {
+		at = fmt.Sprintf(" (exceeded at field %q)", e.Field)
+	}
+	if e.MaxFiles > 0 && e.Files > e.MaxFiles {
+		return fmt.Sprintf("GFileMux: too many files in request: %d, max allowed is %d%s", e.Files, e.MaxFiles, at)
+	}
+	return fmt.Sprintf("GFileMux: uploaded files in request total %d bytes, max allowed is %d%s", e.Size, e.MaxSize, at)
+}
+
+// ParseError is returned when the request body is not a well-formed
+// multipart/form-data payload.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("GFileMux: malformed multipart request: %v", e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when an upload does not finish within a configured
+// time limit. It unwraps to context.DeadlineExceeded.
+type TimeoutError struct {
+	Op      string        // e.g. "upload"
+	Timeout time.Duration // configured limit
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("GFileMux: %s did not complete within %s", e.Op, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
 // StorageError wraps errors that originate from a storage backend.
 type StorageError struct {
 	Backend string // e.g. "disk", "memory", "s3"
@@ -58,3 +228,44 @@ func (e *StorageError) Error() string {
 func (e *StorageError) Unwrap() error {
 	return e.Err
 }
+
+// ErrorStatusCode maps an upload error to the HTTP status code that best
+// describes it. It is used by DefaultUploadErrorHandlerFunc and is exported so
+// custom error handlers can stay consistent with it:
+//
+//   - *ValidationError, *MaxFilesError, *ParseError → 400 Bad Request
+//   - *SizeError, *ContextLimitError               → 413 Request Entity Too Large
+//   - *TimeoutError                                → 408 Request Timeout
+//   - ErrMemoryBudgetExhausted, ErrUploadsPaused   → 503 Service Unavailable
+//   - ErrClientDisconnected                        → 499 (StatusClientClosedRequest)
+//   - anything else                                → 500 Internal Server Error
+func ErrorStatusCode(err error) int {
+	var (
+		ve  *ValidationError
+		mfe *MaxFilesError
+		pe  *ParseError
+		se  *SizeError
+		te  *TimeoutError
+		cle *ContextLimitError
+		hse *HeaderSizeError
+	)
+	switch {
+	case errors.Is(err, ErrClientDisconnected):
+		return StatusClientClosedRequest
+	case errors.Is(err, ErrMemoryBudgetExhausted), errors.Is(err, ErrUploadsPaused):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &te), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	case errors.As(err, &se), errors.As(err, &cle), errors.As(err, &hse), errors.Is(err, ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrChunkSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrFileExists):
+		return http.StatusConflict
+	case errors.As(err, &ve), errors.As(err, &mfe), errors.As(err, &pe), errors.Is(err, ErrNoFilesUploaded),
+		errors.Is(err, ErrInvalidContentRange):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
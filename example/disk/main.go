@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/ghulamazad/GFileMux"
 	"github.com/ghulamazad/GFileMux/storage"
@@ -27,8 +26,10 @@ func main() {
 		),
 		GFileMux.WithFileNameGeneratorFunc(func(originalFileName string) string {
 			// Generate a new unique file name using UUID and original file extension
-			ext := getFileExtension(originalFileName)
-			return fmt.Sprintf("%s.%s", uuid.NewString(), ext)
+			if ext := GFileMux.FileExtension(originalFileName); ext != "" {
+				return fmt.Sprintf("%s.%s", uuid.NewString(), ext)
+			}
+			return uuid.NewString()
 		}),
 		GFileMux.WithStorage(disk), // Use disk storage
 	)
@@ -59,17 +60,17 @@ func main() {
 		fmt.Printf("Files in 'files' field: %+v\n", fileField)
 
 		// Process each uploaded file and print details
-		for _, file := range files {
+		for _, file := range files.Flatten() {
 			// Log the details of each uploaded file
 			fmt.Printf("Uploaded file details: %+v\n", file)
 
 			// Print the file path in disk storage
 			filePath, err := disk.Path(context.Background(), GFileMux.PathOptions{
-				Key:    file[0].StorageKey,
-				Bucket: file[0].FolderDestination,
+				Key:    file.StorageKey,
+				Bucket: file.FolderDestination,
 			})
 			if err != nil {
-				log.Printf("Error retrieving file path for %s: %v", file[0].StorageKey, err)
+				log.Printf("Error retrieving file path for %s: %v", file.StorageKey, err)
 				continue // Skip to the next file if there's an error
 			}
 			// Print the file path if no error
@@ -83,12 +84,3 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
-// Helper function to extract the file extension from a file name
-func getFileExtension(fileName string) string {
-	parts := strings.Split(fileName, ".")
-	if len(parts) > 1 {
-		return parts[len(parts)-1]
-	}
-	return ""
-}
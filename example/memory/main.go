@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/ghulamazad/GFileMux"
 	"github.com/ghulamazad/GFileMux/storage"
@@ -24,8 +23,10 @@ func main() {
 		),
 		GFileMux.WithFileNameGeneratorFunc(func(originalFileName string) string {
 			// Generate a new unique file name based on the UUID
-			ext := getFileExtension(originalFileName)
-			return fmt.Sprintf("%s.%s", uuid.NewString(), ext)
+			if ext := GFileMux.FileExtension(originalFileName); ext != "" {
+				return fmt.Sprintf("%s.%s", uuid.NewString(), ext)
+			}
+			return uuid.NewString()
 		}),
 		GFileMux.WithStorage(memory), // Use in-memory storage
 	)
@@ -36,8 +37,8 @@ func main() {
 	// Create a new HTTP ServeMux
 	mux := http.NewServeMux()
 
-	// Handle file uploads on the root route
-	mux.Handle("/", handler.Upload("bucket_name", "file1", "file2")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Handle file uploads on the root route. Memory storage needs no bucket.
+	mux.Handle("/", handler.Upload("", "file1", "file2")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Retrieve the uploaded files from the request context
 		files, err := GFileMux.GetUploadedFilesFromContext(r)
 		if err != nil {
@@ -56,19 +57,19 @@ func main() {
 		fmt.Printf("Files in 'file1': %+v\n", file1)
 
 		// Loop through all uploaded files and print their paths in memory
-		for _, v := range files {
+		for _, v := range files.Flatten() {
 			fmt.Printf("Uploaded file: %+v\n", v)
 			fmt.Println()
 
 			// Print the path of the uploaded file in memory storage
 			filePath, err := memory.Path(context.Background(), GFileMux.PathOptions{
-				Key:    v[0].StorageKey,
-				Bucket: v[0].FolderDestination,
+				Key:    v.StorageKey,
+				Bucket: v.FolderDestination,
 			})
 
 			if err != nil {
 				// Handle the error properly and print it
-				fmt.Printf("Error retrieving file path for storage key %s: %v\n", v[0].StorageKey, err)
+				fmt.Printf("Error retrieving file path for storage key %s: %v\n", v.StorageKey, err)
 			}
 
 			fmt.Println("File path:", filePath)
@@ -81,12 +82,3 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
-// Helper function to extract the file extension from a file name
-func getFileExtension(fileName string) string {
-	parts := strings.Split(fileName, ".")
-	if len(parts) > 1 {
-		return parts[len(parts)-1]
-	}
-	return ""
-}
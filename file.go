@@ -1,5 +1,10 @@
 package GFileMux
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 // File represents an uploaded file with relevant metadata.
 type File struct {
 	// FieldName indicates the name of the form field used for file upload in the multipart form.
@@ -8,6 +13,11 @@ type File struct {
 	// OriginalName is the name of the file as provided by the client.
 	OriginalName string `json:"original_name,omitempty"`
 
+	// Extension is the extension of OriginalName, lowercased and without the
+	// dot, e.g. "jpg" for "Photo.JPG". It is empty when the name has none. See
+	// FileExtension.
+	Extension string `json:"extension,omitempty"`
+
 	// UploadedFileName is the name of the file after it has been processed and stored.
 	// This may differ from the original file name due to potential renaming during storage.
 	UploadedFileName string `json:"uploaded_file_name,omitempty"`
@@ -21,10 +31,53 @@ type File struct {
 	// MimeType specifies the MIME type of the uploaded file (e.g., "image/jpeg", "application/pdf").
 	MimeType string `json:"mime_type,omitempty"`
 
-	// Size is the size of the uploaded file in bytes.
+	// DeclaredMimeType is the Content-Type the client sent with the file's
+	// multipart part, without parameters. It is empty when none was sent and
+	// for files uploaded with UploadFiles.
+	DeclaredMimeType string `json:"declared_mime_type,omitempty"`
+
+	// Size is the size of the uploaded file in bytes. With WithStreaming it is -1
+	// while validators run, as a streamed file's size is only known once stored.
 	Size int64 `json:"size,omitempty"`
 
 	// ChecksumSHA256 is the hex-encoded SHA-256 hash of the file contents, computed during upload.
 	// It is empty when WithChecksumValidation is not enabled.
 	ChecksumSHA256 string `json:"checksum_sha256,omitempty"`
+
+	// Checksum is the hex-encoded digest of the file contents in the algorithm
+	// chosen with WithChecksumAlgorithm, computed while the file is stored. It
+	// is empty when no algorithm is set.
+	Checksum string `json:"checksum,omitempty"`
+
+	// PublicID is an opaque identifier for the file, issued when
+	// WithPublicIDGenerator is set, that can be handed to clients instead of
+	// StorageKey. ResolvePublicID maps it back to the stored file.
+	PublicID string `json:"public_id,omitempty"`
+
+	// DuplicateOf points to an earlier file in the same upload with identical content.
+	// It is nil for unique files and when WithDuplicateDetection is not enabled.
+	DuplicateOf *FileRef `json:"duplicate_of,omitempty"`
+}
+
+// FileRef identifies a file within an upload by its form field and original name.
+type FileRef struct {
+	FieldName    string `json:"field_name"`
+	OriginalName string `json:"original_name"`
+}
+
+// FileExtension returns the extension of a client-supplied file name,
+// lowercased and without the dot: "Photo.JPG" gives "jpg" and
+// "archive.tar.gz" gives "gz". Directory parts with either separator are
+// ignored. Names without an extension, including dotfiles such as ".env",
+// give "".
+func FileExtension(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	ext := filepath.Ext(name)
+	if ext == name {
+		// A dotfile's leading dot does not start an extension.
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
 }
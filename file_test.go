@@ -0,0 +1,52 @@
+package GFileMux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFileExtension(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"photo.JPG", "jpg"},
+		{"archive.tar.gz", "gz"},
+		{"README", ""},
+		{".env", ""},
+		{"trailing.", ""},
+		{`C:\Users\me\report.PDF`, "pdf"},
+		{"dir.v2/notes", ""},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := FileExtension(tc.in); got != tc.want {
+			t.Errorf("FileExtension(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestUpload_FileExtension(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		handler := newTestHandler(t, WithStreaming(streaming))
+		req := buildMultipartRequestParts(t,
+			formPart{"photo", "Holiday.JPEG", []byte("a")},
+			formPart{"doc", "Makefile", []byte("b")},
+		)
+		rr := httptest.NewRecorder()
+		var files Files
+		handler.Upload("bucket", "photo", "doc")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ = GetUploadedFilesFromContext(r)
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("streaming=%v: expected 200, got %d: %s", streaming, rr.Code, rr.Body)
+		}
+		if got := files["photo"][0].Extension; got != "jpeg" {
+			t.Errorf("streaming=%v: expected extension jpeg, got %q", streaming, got)
+		}
+		if got := files["doc"][0].Extension; got != "" {
+			t.Errorf("streaming=%v: expected no extension, got %q", streaming, got)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package GFileMux
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilenamePolicy selects how WithFilenamePolicy treats original file names
+// that are unsafe to store: names with path components, control characters,
+// characters reserved on common filesystems (< > : " / \ | ? *), leading or
+// trailing dots and spaces, or more than maxFilenameBytes bytes.
+type FilenamePolicy int
+
+const (
+	// FilenamePolicyNone leaves file names to the configured validator and
+	// name generator.
+	FilenamePolicyNone FilenamePolicy = iota
+	// FilenamePolicyReject fails uploads whose original name is unsafe, via
+	// ValidateSafeFilename.
+	FilenamePolicyReject
+	// FilenamePolicySanitize rewrites unsafe original names before the name
+	// generator sees them, via SafeFileNameGenerator.
+	FilenamePolicySanitize
+)
+
+// maxFilenameBytes is the longest file name most filesystems accept.
+const maxFilenameBytes = 255
+
+// SanitizeFilename returns a version of name that is safe to store. Any
+// directory part is dropped, control and reserved characters become '_',
+// leading and trailing dots and spaces are trimmed, and the result is cut to
+// 255 bytes, keeping the extension. A name with nothing left becomes "file".
+// Names that are already safe are returned unchanged.
+func SanitizeFilename(name string) string {
+	// Drop directory components with either separator, whatever the OS.
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "file"
+	}
+	if len(name) > maxFilenameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFilenameBytes/2 {
+			ext = ""
+		}
+		base := name[:maxFilenameBytes-len(ext)]
+		// Do not split a multi-byte character.
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = strings.TrimRight(base, ". ") + ext
+	}
+	return name
+}
+
+// ValidateSafeFilename returns a FileValidatorFunc that rejects files whose
+// original name is unsafe to store, i.e. one that SanitizeFilename would
+// change. See FilenamePolicy.
+//
+// Example:
+//
+//	GFileMux.ValidateSafeFilename()
+func ValidateSafeFilename() FileValidatorFunc {
+	return func(file File) error {
+		if safe := SanitizeFilename(file.OriginalName); safe != file.OriginalName {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("unsafe file name %q; a safe name would be %q", file.OriginalName, safe),
+			}
+		}
+		return nil
+	}
+}
+
+// SafeFileNameGenerator returns a FileNameGeneratorFunc that passes the
+// original name through SanitizeFilename before next, so the stored name is
+// built from a safe one. File.OriginalName keeps the name the client sent.
+//
+// Example:
+//
+//	GFileMux.SafeFileNameGenerator(GFileMux.DefaultFileNameGeneratorFunc)
+func SafeFileNameGenerator(next FileNameGeneratorFunc) FileNameGeneratorFunc {
+	return func(name string) string {
+		return next(SanitizeFilename(name))
+	}
+}
+
+// SanitizeOptions configures SanitizingFileNameGenerator.
+type SanitizeOptions struct {
+	// Replacement replaces each run of characters other than letters,
+	// digits, '.', '-' and '_'. It defaults to "-".
+	Replacement string
+	// Lowercase lowercases the name and extension.
+	Lowercase bool
+	// ASCIIOnly also replaces non-ASCII letters and digits.
+	ASCIIOnly bool
+	// MaxLength caps the result in bytes, extension included. It defaults to
+	// 255.
+	MaxLength int
+}
+
+// SanitizingFileNameGenerator returns a FileNameGeneratorFunc that turns the
+// original name into a URL- and filesystem-safe slug. Any directory part is
+// dropped, runs of spaces, symbols (emoji included) and reserved characters
+// become opts.Replacement, and separators are trimmed from both ends. The
+// extension is kept, reduced to letters and digits, and the base name is cut
+// so the result fits opts.MaxLength. A name with nothing left becomes "file".
+//
+// Unlike SafeFileNameGenerator, it changes names that are already safe,
+// and it does not make names unique. Compose it with a unique prefix:
+//
+//	slug := GFileMux.SanitizingFileNameGenerator(GFileMux.SanitizeOptions{Lowercase: true})
+//	GFileMux.WithFileNameGeneratorFunc(func(name string) string {
+//		return uuid.NewString() + "-" + slug(name)
+//	})
+func SanitizingFileNameGenerator(opts SanitizeOptions) FileNameGeneratorFunc {
+	replacement := opts.Replacement
+	if replacement == "" {
+		replacement = "-"
+	}
+	maxLength := opts.MaxLength
+	if maxLength <= 0 {
+		maxLength = maxFilenameBytes
+	}
+	keep := func(r rune) bool {
+		if opts.ASCIIOnly && r > unicode.MaxASCII {
+			return false
+		}
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	return func(name string) string {
+		if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+			name = name[i+1:]
+		}
+		if opts.Lowercase {
+			name = strings.ToLower(name)
+		}
+
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		ext = strings.Map(func(r rune) rune {
+			if keep(r) {
+				return r
+			}
+			return -1
+		}, ext)
+		if ext != "" {
+			ext = "." + ext
+		}
+		if len(ext) > maxLength/2 {
+			ext = ""
+		}
+
+		var b strings.Builder
+		pending := false
+		for _, r := range base {
+			if keep(r) || r == '.' || r == '-' || r == '_' {
+				if pending && b.Len() > 0 {
+					b.WriteString(replacement)
+				}
+				pending = false
+				b.WriteRune(r)
+				continue
+			}
+			pending = true
+		}
+		trim := func(s string) string {
+			return strings.Trim(s, ".-_"+replacement)
+		}
+		slug := trim(b.String())
+		if slug == "" {
+			slug = "file"
+		}
+
+		if limit := maxLength - len(ext); len(slug) > limit {
+			slug = slug[:limit]
+			// Do not split a multi-byte character.
+			for !utf8.ValidString(slug) {
+				slug = slug[:len(slug)-1]
+			}
+			if slug = trim(slug); slug == "" {
+				slug = "file"
+			}
+		}
+		return slug + ext
+	}
+}
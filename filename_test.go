@@ -0,0 +1,126 @@
+package GFileMux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".pdf" // 404 bytes
+	cases := []struct {
+		in, want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"résumé 2026.pdf", "résumé 2026.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\report.pdf`, "report.pdf"},
+		{"a<b>c:d\"e|f?g*.txt", "a_b_c_d_e_f_g_.txt"},
+		{"line\nbreak\x00.txt", "line_break_.txt"},
+		{" .hidden. ", "hidden"},
+		{"..", "file"},
+		{"", "file"},
+	}
+	for _, tc := range cases {
+		if got := SanitizeFilename(tc.in); got != tc.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	got := SanitizeFilename(long)
+	if len(got) > maxFilenameBytes || !strings.HasSuffix(got, ".pdf") || !strings.HasPrefix(got, "éé") {
+		t.Errorf("expected a name cut to %d bytes keeping .pdf, got %d bytes: %q", maxFilenameBytes, len(got), got)
+	}
+	if SanitizeFilename(got) != got {
+		t.Errorf("a sanitized name should be stable, got %q", SanitizeFilename(got))
+	}
+}
+
+func TestSanitizingFileNameGenerator(t *testing.T) {
+	lower := SanitizingFileNameGenerator(SanitizeOptions{Lowercase: true})
+	cases := []struct {
+		in, want string
+	}{
+		{"My Report (final).PDF", "my-report-final.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\a b.txt`, "a-b.txt"},
+		{"party 🎉🎉 photo.jpg", "party-photo.jpg"},
+		{"🎉.png", "file.png"},
+		{"résumé 2026.pdf", "résumé-2026.pdf"},
+		{"..", "file"},
+		{"", "file"},
+	}
+	for _, tc := range cases {
+		if got := lower(tc.in); got != tc.want {
+			t.Errorf("lower(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	ascii := SanitizingFileNameGenerator(SanitizeOptions{Replacement: "_", ASCIIOnly: true})
+	if got := ascii("Résumé Final.PDF"); got != "R_sum_Final.PDF" {
+		t.Errorf("ascii = %q, want %q", got, "R_sum_Final.PDF")
+	}
+
+	long := SanitizingFileNameGenerator(SanitizeOptions{MaxLength: 20})
+	if got := long(strings.Repeat("é", 50) + ".jpeg"); got != strings.Repeat("é", 7)+".jpeg" {
+		t.Errorf("long = %q, want 7 runes and .jpeg", got)
+	}
+	if got := SanitizingFileNameGenerator(SanitizeOptions{})(strings.Repeat("a b ", 100) + ".txt"); len(got) > maxFilenameBytes || !strings.HasSuffix(got, ".txt") || strings.HasSuffix(got, "-.txt") {
+		t.Errorf("expected a name cut to %d bytes keeping .txt, got %d bytes: %q", maxFilenameBytes, len(got), got)
+	}
+
+	// Composed with a unique prefix, the slug still follows it.
+	composed := func(name string) string { return uuid.NewString() + "-" + lower(name) }
+	if got := composed("A B.png"); !strings.HasSuffix(got, "-a-b.png") || len(got) != 36+len("-a-b.png") {
+		t.Errorf("composed = %q", got)
+	}
+}
+
+func TestGFileMux_FilenamePolicy(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    FilenamePolicy
+		filename  string
+		wantCode  int
+		wantStore string
+	}{
+		// mime/multipart already drops directories, so use reserved characters.
+		{"reject unsafe", FilenamePolicyReject, "bad|name?.sh", http.StatusBadRequest, ""},
+		{"reject allows safe", FilenamePolicyReject, "photo.png", http.StatusOK, "photo.png"},
+		{"sanitize rewrites", FilenamePolicySanitize, "bad|name?.sh", http.StatusOK, "bad_name_.sh"},
+		{"none passes through", FilenamePolicyNone, "a:b.txt", http.StatusOK, "a:b.txt"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &recordingStorage{}
+			handler := newTestHandler(t,
+				WithStorage(store),
+				WithFilenamePolicy(tc.policy),
+				// The policy must wrap a generator configured after it.
+				WithFileNameGeneratorFunc(func(s string) string { return s }),
+			)
+
+			req := buildMultipartRequest(t, "file", tc.filename, []byte("content"))
+			rr := httptest.NewRecorder()
+			var files Files
+			handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				files, _ = GetUploadedFilesFromContext(r)
+			})).ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantStore == "" {
+				return
+			}
+			if _, ok := store.files[tc.wantStore]; !ok {
+				t.Errorf("expected the file stored as %q, got %v", tc.wantStore, store.files)
+			}
+			if files["file"][0].OriginalName != tc.filename {
+				t.Errorf("OriginalName should keep the client's name, got %q", files["file"][0].OriginalName)
+			}
+		})
+	}
+}
@@ -1,17 +1,33 @@
 package GFileMux
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"log/slog"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ghulamazad/GFileMux/utils"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/unicode/norm"
 )
 
 // GFileMux is the core handler struct holding all upload configuration.
@@ -22,9 +38,43 @@ type GFileMux struct {
 	// maxSize is the maximum allowed size for the entire multipart body in bytes.
 	maxSize int64
 
+	// fieldMaxSizes caps the size of each file in the listed fields.
+	fieldMaxSizes map[string]int64
+
+	// memoryBudget caps the request-body bytes admitted process-wide. 0 = no limit.
+	memoryBudget int64
+
+	// dynamicMaxSize, when set, computes maxSize per request.
+	dynamicMaxSize func(*http.Request) int64
+
 	// maxFiles is the maximum number of files allowed per form field. 0 = unlimited.
 	maxFiles int
 
+	// maxTotalFiles is the maximum number of files allowed across all the
+	// fields of a request. 0 = unlimited.
+	maxTotalFiles int
+
+	// maxTotalSize caps the combined size of a request's files, excluding
+	// multipart overhead. 0 = unlimited.
+	maxTotalSize int64
+
+	// maxConcurrency caps the files of a request uploaded at once; 0 means
+	// unlimited.
+	maxConcurrency int
+
+	// requireExplicitValidation makes New fail when no validator is configured.
+	requireExplicitValidation bool
+
+	// uploadTimings records per-phase timings for each request.
+	uploadTimings bool
+
+	// debugUploads logs the multipart layout of each request.
+	debugUploads bool
+
+	// fileOpenAttempts is how many times opening a file is tried when it fails
+	// transiently. Values below 2 disable retries.
+	fileOpenAttempts int
+
 	// ignoreNonExistentKeys, when true, silently skips form fields that are absent.
 	ignoreNonExistentKeys bool
 
@@ -35,17 +85,148 @@ type GFileMux struct {
 	// computeChecksum controls whether SHA-256 is computed for each uploaded file.
 	computeChecksum bool
 
+	// filenamePolicy adds a safety check or rewrite for original file names.
+	filenamePolicy FilenamePolicy
+
+	// spoolMemoryThreshold is the largest file spool keeps in memory rather
+	// than in a temporary file.
+	spoolMemoryThreshold int64
+
+	// chunkSessions tracks ChunkedUpload sessions; chunkDir holds their
+	// received bytes (os.TempDir when empty). chunkMu serializes session
+	// updates.
+	chunkSessions ChunkSessionStore
+	chunkDir      string
+	chunkMu       sync.Mutex
+
+	// contentTypeDetector, when set, replaces utils.FetchContentType.
+	contentTypeDetector ContentTypeDetectorFunc
+
+	// quotaChecker, when set, approves the files of a request before they
+	// are stored.
+	quotaChecker QuotaCheckerFunc
+
+	// overwritePolicy decides what to do when a storage key is already taken.
+	overwritePolicy OverwritePolicy
+
+	// checksumAlgorithm selects the hash computed into File.Checksum.
+	checksumAlgorithm ChecksumAlgorithm
+
+	// keyPrefixFunc, when set, computes a prefix for the storage key of every
+	// file in a request.
+	keyPrefixFunc func(*http.Request) (string, error)
+
+	// checksumFieldSuffix names the form value carrying each file's expected
+	// SHA-256: field "file" is checked against "file" + checksumFieldSuffix.
+	checksumFieldSuffix string
+
+	// nameFromChecksum replaces the generated name with
+	// "<original-base>.<short-hash><ext>" for cache busting.
+	nameFromChecksum bool
+
+	// mimeOverrides maps a lowercased file extension (with leading dot) to the
+	// MIME type that replaces the sniffed one.
+	mimeOverrides map[string]string
+
+	// fallbackMimeFromExtension uses the extension's registered MIME type when
+	// sniffing only yields application/octet-stream.
+	fallbackMimeFromExtension bool
+
 	// fileValidator validates each file before it is stored.
 	fileValidator FileValidatorFunc
 
+	// contentValidator optionally validates each file's content before it is stored.
+	contentValidator FileContentValidatorFunc
+
+	// remoteValidator, when set, asks a policy service to approve each file.
+	remoteValidator *remoteValidator
+
 	// fileNameGenerator generates a storage filename from the original name.
 	fileNameGenerator FileNameGeneratorFunc
 
 	// uploadErrorHandler builds the HTTP error response for upload failures.
 	uploadErrorHandler UploadErrorHandlerFunc
 
+	// uploadSuccessHandler, when set, answers successful uploads instead of
+	// the next handler.
+	uploadSuccessHandler UploadSuccessHandlerFunc
+
 	// logger is an optional structured logger. nil means no logging.
 	logger *slog.Logger
+
+	// normalizeUnicodeNames applies NFC normalization to original filenames.
+	normalizeUnicodeNames bool
+
+	// maxUploadDuration bounds the wall-clock time of a whole Upload batch,
+	// parsing included. 0 = no limit.
+	maxUploadDuration time.Duration
+
+	// perFileTimeout bounds the processing of each individual file. 0 = no limit.
+	perFileTimeout time.Duration
+
+	// caseInsensitiveFields matches form field names ignoring case.
+	caseInsensitiveFields bool
+
+	// postStoreValidation defers content validation until after the file is
+	// stored, deleting it on failure.
+	postStoreValidation bool
+	// pendingValidations tracks post-store validations still running.
+	pendingValidations sync.WaitGroup
+
+	// requiresBucket is set from the storage backend's capabilities at New.
+	requiresBucket bool
+
+	// streaming reads multipart parts as they arrive instead of buffering the
+	// whole form with ParseMultipartForm.
+	streaming bool
+
+	// maxPartHeaderBytes caps each part's headers on the streaming path; 0
+	// means no limit beyond mime/multipart's own.
+	maxPartHeaderBytes int
+
+	// requireFilename rejects file parts that carry no filename.
+	requireFilename bool
+
+	// detectDuplicates marks files whose content repeats an earlier file in the batch.
+	detectDuplicates bool
+
+	// contextMaxFiles and contextMaxSize cap the files retained in a request's
+	// context across every Upload in the chain. 0 = no limit.
+	contextMaxFiles int
+	contextMaxSize  int64
+
+	// audit, when set, receives one JSON line per stored file.
+	audit *auditSink
+
+	// publicIDGenerator, when set, issues File.PublicID for every stored file
+	// and records it in publicIDStore.
+	publicIDGenerator PublicIDGeneratorFunc
+	publicIDStore     PublicIDStore
+
+	// responseEnvelope, when set, makes Upload answer the request itself with
+	// the JSON-encoded value it returns instead of calling the next handler.
+	responseEnvelope func(Files) any
+
+	// createdResponse answers single-file uploads with 201 Created and a
+	// Location header.
+	createdResponse bool
+
+	// autoResponse writes the uploaded Files as JSON when the next handler
+	// leaves the response untouched.
+	autoResponse bool
+
+	// Upload lifecycle hooks, called for each file; see WithOnUploadStart.
+	onUploadStart   func(ctx context.Context, field string, header *multipart.FileHeader)
+	onUploadSuccess func(ctx context.Context, file File)
+	onUploadError   func(ctx context.Context, field string, err error)
+
+	// uploadMetadata supplies user metadata stored with each file; see
+	// WithUploadMetadata.
+	uploadMetadata func(ctx context.Context, file File) map[string]string
+
+	// paused rejects new uploads while set; see SetAcceptingUploads.
+	paused           atomic.Bool
+	pausedRetryAfter time.Duration
 }
 
 // GFileMuxOption is a function that configures a GFileMux instance.
@@ -54,7 +235,7 @@ type GFileMuxOption func(*GFileMux)
 // New creates a new GFileMux handler with the supplied options.
 // A storage backend must be provided via WithStorage; all other options are optional.
 func New(options ...GFileMuxOption) (*GFileMux, error) {
-	handler := &GFileMux{}
+	handler := &GFileMux{pausedRetryAfter: DefaultPausedRetryAfter}
 
 	for _, opt := range options {
 		opt(handler)
@@ -63,6 +244,9 @@ func New(options ...GFileMuxOption) (*GFileMux, error) {
 	if handler.maxSize <= 0 {
 		handler.maxSize = DefaultMaxFileUploadSize
 	}
+	if handler.requireExplicitValidation && handler.fileValidator == nil && !handler.hasContentValidation() {
+		return nil, errors.New("explicit validation is required: configure a validator, or pass WithFileValidatorFunc(GFileMux.DefaultFileValidator) to accept every file")
+	}
 	if handler.fileValidator == nil {
 		handler.fileValidator = DefaultFileValidator
 	}
@@ -72,9 +256,42 @@ func New(options ...GFileMuxOption) (*GFileMux, error) {
 	if handler.uploadErrorHandler == nil {
 		handler.uploadErrorHandler = DefaultUploadErrorHandlerFunc
 	}
+	if handler.publicIDGenerator != nil && handler.publicIDStore == nil {
+		handler.publicIDStore = NewMemoryPublicIDStore()
+	}
+	if handler.chunkSessions == nil {
+		handler.chunkSessions = NewMemoryChunkSessionStore()
+	}
+	if handler.checksumAlgorithm != ChecksumAlgorithmNone {
+		if _, err := handler.checksumAlgorithm.newHash(); err != nil {
+			return nil, err
+		}
+	}
+	switch handler.filenamePolicy {
+	case FilenamePolicyReject:
+		handler.fileValidator = ChainValidators(ValidateSafeFilename(), handler.fileValidator)
+	case FilenamePolicySanitize:
+		handler.fileNameGenerator = SafeFileNameGenerator(handler.fileNameGenerator)
+	}
 	if handler.storage == nil {
 		return nil, errors.New("a storage backend must be provided via WithStorage")
 	}
+	if handler.postStoreValidation {
+		if !implements[Opener](handler.storage) {
+			return nil, errors.New("post-store validation requires a storage backend that implements Opener")
+		}
+	}
+	if handler.overwritePolicy != OverwriteAllow {
+		if !implements[Exister](handler.storage) {
+			return nil, errors.New("an overwrite policy requires a storage backend that implements Exister")
+		}
+	}
+	handler.requiresBucket = storageCapabilities(handler.storage).RequiresBucket
+	if handler.streaming {
+		if reason := handler.spoolReason(); reason != "" {
+			handler.log(context.Background(), slog.LevelInfo, "streaming uploads will be buffered to temporary files", "reason", reason)
+		}
+	}
 
 	return handler, nil
 }
@@ -84,6 +301,18 @@ func (gfm *GFileMux) Storage() Storage {
 	return gfm.storage
 }
 
+// checkBucket rejects a bucket the handler may not upload to: an empty one
+// when the storage backend requires a bucket, or one outside allowedBuckets.
+func (gfm *GFileMux) checkBucket(bucket string) error {
+	if bucket == "" && gfm.requiresBucket {
+		return errors.New("a bucket is required by the configured storage backend")
+	}
+	if !gfm.isBucketAllowed(bucket) {
+		return fmt.Errorf("bucket %q is not allowed", bucket)
+	}
+	return nil
+}
+
 // isBucketAllowed returns true when the bucket is in the allowedBuckets list,
 // or when no whitelist has been configured.
 func (gfm *GFileMux) isBucketAllowed(bucket string) bool {
@@ -93,6 +322,316 @@ func (gfm *GFileMux) isBucketAllowed(bucket string) bool {
 	return slices.Contains(gfm.allowedBuckets, bucket)
 }
 
+// SetAcceptingUploads pauses or resumes ingestion, e.g. while draining an
+// instance during a deploy. While paused, Upload rejects every request and
+// ChunkedUpload rejects requests that would start a session, both with a
+// *PausedError (503 Service Unavailable with Retry-After from the default
+// error handler); uploads already in progress complete. It is safe to call
+// concurrently with requests. A new GFileMux accepts uploads.
+func (gfm *GFileMux) SetAcceptingUploads(accepting bool) {
+	gfm.paused.Store(!accepting)
+}
+
+// checkAccepting returns a *PausedError while uploads are paused.
+func (gfm *GFileMux) checkAccepting() error {
+	if gfm.paused.Load() {
+		return &PausedError{RetryAfter: gfm.pausedRetryAfter}
+	}
+	return nil
+}
+
+// resolveMimeType refines the sniffed MIME type of fileName: a configured
+// override for its extension wins, and when sniffing could not classify the
+// content the extension's registered type is used if that fallback is enabled.
+func (gfm *GFileMux) resolveMimeType(fileName, detected string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if m, ok := gfm.mimeOverrides[ext]; ok {
+		return m
+	}
+	if gfm.fallbackMimeFromExtension && detected == "application/octet-stream" && ext != "" {
+		if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+			return byExt
+		}
+	}
+	return detected
+}
+
+// requestMaxSize returns the body size limit for r: the dynamic limit when one
+// is configured and positive, otherwise routeMax when positive (see
+// WithMaxSize), otherwise the static maxSize.
+func (gfm *GFileMux) requestMaxSize(r *http.Request, routeMax int64) int64 {
+	if gfm.dynamicMaxSize != nil {
+		if size := gfm.dynamicMaxSize(r); size > 0 {
+			return size
+		}
+	}
+	if routeMax > 0 {
+		return routeMax
+	}
+	return gfm.maxSize
+}
+
+// checkContextLimits reports a *ContextLimitError when adding fields to the
+// files already held in the request context would exceed the configured caps,
+// naming the first field whose files cross one. It runs before anything is
+// stored.
+func (gfm *GFileMux) checkContextLimits(existing Files, fields []fieldSources) error {
+	if gfm.contextMaxFiles <= 0 && gfm.contextMaxSize <= 0 {
+		return nil
+	}
+	count := existing.Count()
+	var size int64
+	for _, f := range existing.All() {
+		size = addSizes(size, f.Size)
+	}
+	exceeded := func() bool {
+		return (gfm.contextMaxFiles > 0 && count > gfm.contextMaxFiles) || (gfm.contextMaxSize > 0 && size > gfm.contextMaxSize)
+	}
+	var field string
+	for _, group := range fields {
+		count += len(group.sources)
+		for _, src := range group.sources {
+			size = addSizes(size, src.size) // unknown (-1) until stored
+		}
+		if field == "" && exceeded() {
+			field = group.field
+		}
+	}
+	if exceeded() {
+		return &ContextLimitError{Field: field, Files: count, MaxFiles: gfm.contextMaxFiles, Size: size, MaxSize: gfm.contextMaxSize}
+	}
+	return nil
+}
+
+// detectContentType returns the MIME type of rs, without parameters, using the
+// detector set with WithContentTypeDetector or utils.FetchContentType. rs is
+// left at the start.
+func (gfm *GFileMux) detectContentType(rs io.ReadSeeker) (string, error) {
+	if gfm.contentTypeDetector == nil {
+		return utils.FetchContentType(rs)
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mimeType, err := gfm.contentTypeDetector(rs)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.TrimSpace(mimeType), nil
+}
+
+// checkQuota asks the quota checker, if any, to approve fileCount files of
+// incomingBytes bytes. Errors other than a rejection are wrapped as failures
+// of the quota check.
+func (gfm *GFileMux) checkQuota(ctx context.Context, r *http.Request, incomingBytes int64, fileCount int) error {
+	if gfm.quotaChecker == nil {
+		return nil
+	}
+	if err := gfm.quotaChecker(ctx, r, incomingBytes, fileCount); err != nil {
+		if !errors.Is(err, ErrQuotaExceeded) {
+			return fmt.Errorf("quota check failed: %w", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkTotalFiles reports a *MaxFilesError when total, the files counted so far
+// in a request up to and including field's, exceeds WithMaxTotalFiles.
+func (gfm *GFileMux) checkTotalFiles(field string, total int) error {
+	if gfm.maxTotalFiles > 0 && total > gfm.maxTotalFiles {
+		return &MaxFilesError{Field: field, Got: total, MaxFiles: gfm.maxTotalFiles, Total: true}
+	}
+	return nil
+}
+
+// addSizes returns total + size for aggregate size accounting. Negative sizes
+// (unknown) count as zero, and the sum saturates at math.MaxInt64 instead of
+// overflowing, so it still exceeds any limit it should.
+func addSizes(total, size int64) int64 {
+	if size <= 0 {
+		return total
+	}
+	if total > math.MaxInt64-size {
+		return math.MaxInt64
+	}
+	return total + size
+}
+
+// batchContext derives the context for one Upload batch, applying the
+// maxUploadDuration deadline when configured.
+func (gfm *GFileMux) batchContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if gfm.maxUploadDuration > 0 {
+		return context.WithTimeout(parent, gfm.maxUploadDuration)
+	}
+	return context.WithCancel(parent)
+}
+
+// requestError attributes err to the state of the request: a client that went
+// away yields ErrClientDisconnected and an expired batch deadline yields a
+// *TimeoutError. Otherwise err is returned unchanged.
+func (gfm *GFileMux) requestError(ctx context.Context, r *http.Request, err error) error {
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrClientDisconnected, err)
+	}
+	if gfm.maxUploadDuration > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Op: "upload", Timeout: gfm.maxUploadDuration, Err: ctx.Err()}
+	}
+	return err
+}
+
+// bodySizeError reports a *SizeError when err comes from reading past the
+// http.MaxBytesReader limit on r's body.
+func bodySizeError(r *http.Request, err error) (*SizeError, bool) {
+	var mbe *http.MaxBytesError
+	if !errors.As(err, &mbe) {
+		return nil, false
+	}
+	size := r.ContentLength
+	if size <= mbe.Limit {
+		size = mbe.Limit + 1 // unknown length; at least one byte over
+	}
+	return &SizeError{Size: size, MaxSize: mbe.Limit}, true
+}
+
+// parseError classifies a ParseMultipartForm failure as an oversized body
+// (*SizeError), a disconnected client, a timeout, or a malformed body (*ParseError).
+func (gfm *GFileMux) parseError(ctx context.Context, r *http.Request, err error) error {
+	if se, ok := bodySizeError(r, err); ok {
+		return se
+	}
+	if classified := gfm.requestError(ctx, r, err); classified != err {
+		return classified
+	}
+	return &ParseError{Err: err}
+}
+
+// formFiles returns the file headers submitted under key. With
+// caseInsensitiveFields an exact match wins; otherwise the single field whose
+// name equals key ignoring case is used, and several such fields are rejected
+// as ambiguous.
+func (gfm *GFileMux) formFiles(form *multipart.Form, key string) ([]*multipart.FileHeader, bool, error) {
+	if headers, ok := form.File[key]; ok || !gfm.caseInsensitiveFields {
+		return headers, ok, nil
+	}
+	var (
+		match   string
+		headers []*multipart.FileHeader
+	)
+	for name, hs := range form.File {
+		if !strings.EqualFold(name, key) {
+			continue
+		}
+		if match != "" {
+			return nil, false, &ValidationError{
+				Field:   key,
+				Message: fmt.Sprintf("ambiguous field: %q and %q differ only by case", match, name),
+			}
+		}
+		match, headers = name, hs
+	}
+	return headers, match != "", nil
+}
+
+// hasFilename reports whether name carries a usable file name, rather than
+// nothing or a bare path such as "." or "/".
+func hasFilename(name string) bool {
+	base := filepath.Base(strings.TrimSpace(name))
+	return base != "." && base != ".." && base != "/" && base != string(filepath.Separator)
+}
+
+// checksumNameLength is the number of hex digits of the SHA-256 digest used by
+// WithUploadedFileNameFromChecksum.
+const checksumNameLength = 12
+
+// checksumFileName builds "<base>.<short-hash><ext>" from the original name,
+// e.g. "logo.png" → "logo.3f2a1b9c0d4e.png".
+func checksumFileName(originalName, checksum string) string {
+	name := filepath.Base(originalName)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// Dotfiles such as ".env" have no base; keep the whole name as the base.
+		base, ext = name, ""
+	}
+	return base + "." + checksum[:checksumNameLength] + ext
+}
+
+// fileContext derives the context for a single file from the batch context,
+// applying perFileTimeout when configured. Each file gets its own context so
+// one stuck storage call can be cancelled without touching its siblings.
+func (gfm *GFileMux) fileContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if gfm.perFileTimeout > 0 {
+		return context.WithTimeout(parent, gfm.perFileTimeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// contextReader fails reads once ctx is done, so request body parsing honours
+// the batch deadline even when the server does not support read deadlines.
+type contextReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.ReadCloser.Read(p)
+}
+
+// writeSuccessResponse writes the JSON success body for a completed upload.
+// It reports whether a response was written; when it returns false the caller
+// should hand the request on to the next handler.
+func (gfm *GFileMux) writeSuccessResponse(w http.ResponseWriter, r *http.Request, bucket string, files Files) bool {
+	status := http.StatusOK
+	var payload any
+	if gfm.responseEnvelope != nil {
+		payload = gfm.responseEnvelope(files)
+	}
+	if location, ok := gfm.createdLocation(r.Context(), bucket, files); ok {
+		w.Header().Set("Location", location)
+		status = http.StatusCreated
+		if payload == nil {
+			payload = files.All()[0]
+		}
+	}
+	if payload == nil {
+		return false
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		gfm.uploadErrorHandler(fmt.Errorf("could not encode upload response: %w", err)).ServeHTTP(w, r)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+	return true
+}
+
+// createdLocation returns the Location of the single file in files for a
+// 201 Created response. It reports false when createdResponse is off, when
+// there is not exactly one file, or when the backend cannot produce a path.
+func (gfm *GFileMux) createdLocation(ctx context.Context, bucket string, files Files) (string, bool) {
+	if !gfm.createdResponse || files.Count() != 1 {
+		return "", false
+	}
+	file := files.All()[0]
+	location, err := gfm.storage.Path(ctx, PathOptions{Bucket: bucket, Key: file.StorageKey})
+	if err != nil {
+		gfm.log(ctx, slog.LevelWarn, "could not resolve Location for created response", "key", file.StorageKey, "error", err)
+		return "", false
+	}
+	return location, true
+}
+
 // log emits a structured log line when a logger is configured.
 func (gfm *GFileMux) log(ctx context.Context, level slog.Level, msg string, args ...any) {
 	if gfm.logger != nil {
@@ -100,10 +639,43 @@ func (gfm *GFileMux) log(ctx context.Context, level slog.Level, msg string, args
 	}
 }
 
-// UploadOptions struct encapsulates per-call upload options.
+// dedupeKeys drops repeated keys, which would otherwise store the same files
+// twice from concurrent goroutines.
+func (gfm *GFileMux) dedupeKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	var dupes []string
+	for _, key := range keys {
+		norm := key
+		if gfm.caseInsensitiveFields {
+			norm = strings.ToLower(key)
+		}
+		if seen[norm] {
+			dupes = append(dupes, key)
+			continue
+		}
+		seen[norm] = true
+		unique = append(unique, key)
+	}
+	if len(dupes) > 0 {
+		gfm.log(context.Background(), slog.LevelWarn, "duplicate keys passed to Upload are processed once", "duplicates", dupes)
+	}
+	return unique
+}
+
+// UploadOptions holds the per-call configuration of UploadWith, set with the
+// Option functions WithBucket, WithKeys, WithMaxSize and WithMaxFileCount.
 type UploadOptions struct {
 	Bucket string
 	Keys   []string
+
+	// MaxSize overrides the handler's WithMaxFileSize limit for the route.
+	// 0 keeps the handler's limit.
+	MaxSize int64
+
+	// MaxFiles overrides the handler's WithMaxFiles limit for the route.
+	// 0 keeps the handler's limit.
+	MaxFiles int
 }
 
 // Option configures an UploadOptions value.
@@ -113,159 +685,834 @@ type Option func(*UploadOptions)
 // files found under each of the provided keys to the configured storage backend,
 // and stores their metadata in the request context for use by the next handler.
 //
-// The race condition that previously existed (concurrent writes to a plain map)
-// is eliminated here by using sync.Map: each goroutine writes exclusively to its
-// own key, so there is zero lock contention while still being race-detector-clean.
+// Files are uploaded concurrently, up to WithMaxConcurrency at a time across
+// all fields, and keep their multipart submission order within a field. bucket may be empty when
+// the storage backend does not require one (see StorageCapabilities).
+//
+// A key listed more than once is processed once, in the position of its first
+// occurrence, and a warning is logged. Under WithCaseInsensitiveFields keys
+// that differ only by case count as duplicates.
 func (gfm *GFileMux) Upload(bucket string, keys ...string) func(next http.Handler) http.Handler {
+	return gfm.UploadWith(WithBucket(bucket), WithKeys(keys...))
+}
+
+// UploadWith is Upload configured with functional options, so routes sharing
+// one handler can differ, e.g. in their size limit. Upload(bucket, keys...) is
+// UploadWith(WithBucket(bucket), WithKeys(keys...)).
+//
+//	handler.UploadWith(
+//	    GFileMux.WithBucket("avatars"),
+//	    GFileMux.WithKeys("file"),
+//	    GFileMux.WithMaxSize(2<<20),
+//	)
+func (gfm *GFileMux) UploadWith(opts ...Option) func(next http.Handler) http.Handler {
+	var o UploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	bucket := o.Bucket
+	keys := gfm.dedupeKeys(o.Keys)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Guard: validate bucket against allowedBuckets whitelist.
-			if !gfm.isBucketAllowed(bucket) {
-				gfm.uploadErrorHandler(fmt.Errorf("bucket %q is not allowed", bucket)).ServeHTTP(w, r)
+			if err := gfm.checkAccepting(); err != nil {
+				gfm.log(r.Context(), slog.LevelWarn, "upload rejected", "error", err)
+				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
 				return
 			}
-
-			// Enforce total body size limit before parsing.
-			r.Body = http.MaxBytesReader(w, r.Body, gfm.maxSize)
-			if err := r.ParseMultipartForm(gfm.maxSize); err != nil {
-				if strings.Contains(err.Error(), "request body too large") {
-					gfm.uploadErrorHandler(&SizeError{Size: gfm.maxSize, MaxSize: gfm.maxSize}).ServeHTTP(w, r)
-					return
-				}
+			// Guard: validate bucket against the backend and allowedBuckets whitelist.
+			if err := gfm.checkBucket(bucket); err != nil {
 				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
 				return
 			}
 
-			ctx, cancel := context.WithCancel(r.Context())
+			// The batch context covers parsing and every storage write.
+			ctx, cancel := gfm.batchContext(r.Context())
 			defer cancel()
+			ctx, err := gfm.requestContext(ctx, r)
+			if err != nil {
+				gfm.log(ctx, errorLogLevel(err), "upload rejected", "error", err)
+				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
+				return
+			}
+			var timings *timingRecorder
+			if gfm.uploadTimings {
+				ctx, timings = withTimingRecorder(ctx)
+			}
+
+			// Enforce total body size limit before parsing.
+			maxSize := gfm.requestMaxSize(r, o.MaxSize)
+			if gfm.memoryBudget > 0 {
+				// Reserve the declared body size, or the worst case when unknown,
+				// for as long as the request's files are being buffered and stored.
+				reserved := r.ContentLength
+				if reserved < 0 || reserved > maxSize {
+					reserved = maxSize
+				}
+				if !acquireMemory(reserved, gfm.memoryBudget) {
+					gfm.log(ctx, slog.LevelWarn, "upload rejected", "error", ErrMemoryBudgetExhausted)
+					gfm.uploadErrorHandler(ErrMemoryBudgetExhausted).ServeHTTP(w, r)
+					return
+				}
+				defer releaseMemory(reserved)
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+			if deadline, ok := ctx.Deadline(); ok {
+				// Best effort: interrupt blocked body reads at the deadline.
+				rc := http.NewResponseController(w)
+				if rc.SetReadDeadline(deadline) == nil {
+					defer rc.SetReadDeadline(time.Time{})
+				}
+				r.Body = contextReader{ctx: ctx, ReadCloser: r.Body}
+			}
 
 			gfm.log(ctx, slog.LevelInfo, "upload started", "bucket", bucket, "fields", keys)
 
-			// Use sync.Map so each goroutine can write its own key concurrently
-			// without any mutex — zero contention, race-detector clean.
-			var sm sync.Map
-			var wg errgroup.Group
-
-			for _, key := range keys {
-
-				wg.Go(func() error {
-					fileHeaders, ok := r.MultipartForm.File[key]
-					if !ok {
-						if gfm.ignoreNonExistentKeys {
-							return nil
-						}
-						return fmt.Errorf("no files found for field %q in the request", key)
-					}
-
-					// Enforce per-field file count limit.
-					if gfm.maxFiles > 0 && len(fileHeaders) > gfm.maxFiles {
-						return &MaxFilesError{Field: key, Got: len(fileHeaders), MaxFiles: gfm.maxFiles}
-					}
-
-					localFiles := make([]File, 0, len(fileHeaders))
-
-					for _, header := range fileHeaders {
-						f, err := header.Open()
-						if err != nil {
-							return fmt.Errorf("could not open file for field %q: %w", key, err)
-						}
-						defer f.Close()
-
-						uploadedFileName := gfm.fileNameGenerator(header.Filename)
-
-						// Detect MIME type from the first 512 bytes.
-						mimeType, err := utils.FetchContentType(f)
-						if err != nil {
-							return fmt.Errorf("could not detect MIME type for field %q: %w", key, err)
-						}
-
-						fileData := File{
-							FieldName:        key,
-							OriginalName:     header.Filename,
-							UploadedFileName: uploadedFileName,
-							MimeType:         mimeType,
-							Size:             header.Size,
-						}
-
-						// Run user-configured validators before touching storage.
-						if err := gfm.fileValidator(fileData); err != nil {
-							return fmt.Errorf("validation failed for field %q: %w", key, err)
-						}
-
-						// Optionally compute SHA-256 before upload (reader is seeked back afterward).
-						if gfm.computeChecksum {
-							checksum, err := utils.ComputeSHA256(f)
-							if err != nil {
-								return fmt.Errorf("could not compute checksum for field %q: %w", key, err)
-							}
-							fileData.ChecksumSHA256 = checksum
-						}
-
-						// Upload to the configured storage backend.
-						metadata, err := gfm.storage.Upload(ctx, f, &UploadFileOptions{
-							FileName: uploadedFileName,
-							Bucket:   bucket,
-						})
-						if err != nil {
-							return fmt.Errorf("storage upload failed for field %q: %w", key, err)
-						}
-
-						fileData.Size = metadata.Size
-						fileData.FolderDestination = metadata.FolderDestination
-						fileData.StorageKey = metadata.Key
-
-						localFiles = append(localFiles, fileData)
-					}
-
-					// Each goroutine owns one unique key — zero contention with sync.Map.
-					sm.Store(key, localFiles)
-					return nil
-				})
+			maxFiles := gfm.maxFiles
+			if o.MaxFiles > 0 {
+				maxFiles = o.MaxFiles
 			}
-
-			if err := wg.Wait(); err != nil {
-				gfm.log(ctx, slog.LevelError, "upload failed", "error", err)
+			var uploadedFiles Files
+			if gfm.streaming && r.MultipartForm == nil {
+				uploadedFiles, err = gfm.streamUpload(ctx, r, bucket, keys, maxSize, maxFiles)
+			} else {
+				uploadedFiles, err = gfm.bufferedUpload(ctx, r, bucket, keys, maxSize, maxFiles)
+			}
+			if err != nil {
+				gfm.log(ctx, errorLogLevel(err), "upload failed", "error", err)
 				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
 				return
 			}
 
-			// Collect results from sync.Map back into a plain Files map (single-threaded).
-			uploadedFiles := make(Files, len(keys))
-			sm.Range(func(k, v any) bool {
-				uploadedFiles[k.(string)] = v.([]File)
-				return true
-			})
-
 			gfm.log(ctx, slog.LevelInfo, "upload completed",
 				"bucket", bucket,
 				"total_files", uploadedFiles.Count(),
 			)
 
-			r = r.WithContext(addFilesToContext(r.Context(), uploadedFiles))
-			next.ServeHTTP(w, r)
+			reqCtx := addFilesToContext(r.Context(), uploadedFiles)
+			if timings != nil {
+				snapshot := timings.snapshot()
+				gfm.log(ctx, slog.LevelDebug, "upload timings", "parse", snapshot.Parse, "files", len(snapshot.Files))
+				reqCtx = context.WithValue(reqCtx, timingsKey{}, snapshot)
+			}
+			r = r.WithContext(reqCtx)
+			if gfm.writeSuccessResponse(w, r, bucket, uploadedFiles) {
+				return
+			}
+			gfm.serveNext(w, r, next, uploadedFiles)
 		})
 	}
 }
 
+// bufferedUpload parses the whole multipart body with ParseMultipartForm, then
+// uploads the files under keys concurrently, at most maxFiles per key when it
+// is positive.
+func (gfm *GFileMux) bufferedUpload(ctx context.Context, r *http.Request, bucket string, keys []string, maxSize int64, maxFiles int) (Files, error) {
+	start := time.Now()
+	err := r.ParseMultipartForm(maxSize)
+	if gfm.debugUploads {
+		gfm.logUploadDebug(ctx, r, formParts(r.MultipartForm), err)
+	}
+	if err != nil {
+		return nil, gfm.parseError(ctx, r, err)
+	}
+	setParse(ctx, time.Since(start))
+
+	// Resolve every field before touching storage so a missing or
+	// oversized field fails the request without a partial upload.
+	fields := make([]fieldSources, 0, len(keys))
+	var missing []string
+	totalFiles := 0
+	var totalSize int64
+	for _, key := range keys {
+		fileHeaders, ok, err := gfm.formFiles(r.MultipartForm, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && gfm.requireFilename && len(r.MultipartForm.Value[key]) > 0 {
+			// Parts without a filename are parsed as plain form values.
+			return nil, &ValidationError{Field: key, Message: "file part has no filename in its Content-Disposition header"}
+		}
+		if !ok {
+			if !gfm.ignoreNonExistentKeys {
+				missing = append(missing, key)
+			}
+			continue
+		}
+
+		// Enforce per-field file count limit.
+		if maxFiles > 0 && len(fileHeaders) > maxFiles {
+			return nil, &MaxFilesError{Field: key, Got: len(fileHeaders), MaxFiles: maxFiles}
+		}
+		totalFiles += len(fileHeaders)
+		if err := gfm.checkTotalFiles(key, totalFiles); err != nil {
+			return nil, err
+		}
+
+		sources := make([]fileSource, len(fileHeaders))
+		for j, header := range fileHeaders {
+			if limit := gfm.fieldMaxSize(key, maxSize); header.Size > limit {
+				return nil, &SizeError{Field: key, Size: header.Size, MaxSize: limit}
+			}
+			totalSize = addSizes(totalSize, header.Size)
+			if gfm.maxTotalSize > 0 && totalSize > gfm.maxTotalSize {
+				return nil, &SizeError{Field: key, Size: totalSize, MaxSize: gfm.maxTotalSize, Total: true}
+			}
+			sources[j] = headerSource(key, header)
+			if sources[j].expectedSHA256, err = gfm.expectedChecksum(r.MultipartForm.Value, key, j); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, fieldSources{field: key, sources: sources})
+	}
+	if len(missing) > 0 {
+		return nil, noFilesError(missing)
+	}
+
+	if err := gfm.checkContextLimits(getFilesFromContext(r.Context()), fields); err != nil {
+		return nil, err
+	}
+	if gfm.quotaChecker != nil {
+		var size int64
+		count := 0
+		for _, field := range fields {
+			count += len(field.sources)
+			for _, src := range field.sources {
+				size = addSizes(size, src.size)
+			}
+		}
+		if err := gfm.checkQuota(ctx, r, size, count); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := gfm.uploadFields(ctx, bucket, fields)
+	if err != nil {
+		return nil, gfm.requestError(ctx, r, err)
+	}
+
+	uploadedFiles := make(Files, len(fields))
+	for i, field := range fields {
+		uploadedFiles[field.field] = results[i]
+	}
+	return uploadedFiles, nil
+}
+
+// fieldMaxSize returns the size limit for each file in field key: its
+// WithFieldMaxFileSize cap, or maxSize for fields without one.
+func (gfm *GFileMux) fieldMaxSize(key string, maxSize int64) int64 {
+	if limit, ok := gfm.fieldMaxSizes[key]; ok {
+		return limit
+	}
+	return maxSize
+}
+
+// errorLogLevel logs client-caused failures as warnings and the rest as errors.
+func errorLogLevel(err error) slog.Level {
+	if ErrorStatusCode(err) < http.StatusInternalServerError {
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// fileSource is one file entering the upload pipeline, whether it came from a
+// multipart part or from UploadFiles. Content comes from open, or from stream
+// for a forward-only part in streaming mode. A negative size means it is not
+// known until the file is opened (or, for a stream, until it is stored).
+type fileSource struct {
+	field  string
+	name   string
+	size   int64
+	open   func() (io.ReadSeekCloser, error)
+	stream io.Reader
+
+	// declaredType is the part's Content-Type header, if any.
+	declaredType string
+
+	// expectedSHA256 is the client-provided hex digest the content must match,
+	// if any. See WithChecksumFieldSuffix.
+	expectedSHA256 string
+
+	// header is the multipart file header, when the file came from one.
+	header *multipart.FileHeader
+}
+
+// fileHeader returns the multipart header of src for the upload hooks,
+// synthesizing one from its name, size and declared type when src did not
+// come from a multipart form.
+func (src fileSource) fileHeader() *multipart.FileHeader {
+	if src.header != nil {
+		return src.header
+	}
+	header := &multipart.FileHeader{Filename: src.name, Size: src.size, Header: textproto.MIMEHeader{}}
+	if src.declaredType != "" {
+		header.Header.Set("Content-Type", src.declaredType)
+	}
+	return header
+}
+
+// headerSource adapts a multipart part to a fileSource.
+func headerSource(key string, header *multipart.FileHeader) fileSource {
+	return fileSource{
+		field:        key,
+		name:         header.Filename,
+		size:         header.Size,
+		open:         func() (io.ReadSeekCloser, error) { return header.Open() },
+		declaredType: header.Header.Get("Content-Type"),
+		header:       header,
+	}
+}
+
+// fieldSources groups the files submitted under one field name.
+type fieldSources struct {
+	field   string
+	sources []fileSource
+}
+
+// uploadFields uploads the files of every field concurrently, at most
+// maxConcurrency at a time, and returns the files for fields[i] in slot i.
+// Every slot is allocated up front and each goroutine writes only to its own
+// results[i][j], so results are race-free and files keep their submission
+// order within a field regardless of goroutine scheduling.
+func (gfm *GFileMux) uploadFields(ctx context.Context, bucket string, fields []fieldSources) ([][]File, error) {
+	results := make([][]File, len(fields))
+	for i, field := range fields {
+		results[i] = make([]File, len(field.sources))
+	}
+	// The first failing file cancels gctx, and with it every other
+	// in-flight file, so a single failure fails the batch promptly.
+	wg, gctx := errgroup.WithContext(ctx)
+	if gfm.maxConcurrency > 0 {
+		wg.SetLimit(gfm.maxConcurrency)
+	}
+
+	for i, field := range fields {
+		for j, src := range field.sources {
+			wg.Go(func() error {
+				fileData, err := gfm.uploadFile(gctx, bucket, src)
+				if err != nil {
+					return err
+				}
+				results[i][j] = fileData
+				return nil
+			})
+		}
+	}
+
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	if gfm.detectDuplicates {
+		markDuplicates(results)
+	}
+	return results, nil
+}
+
+// markDuplicates sets DuplicateOf on every file whose checksum matches an
+// earlier file, walking fields and files in submission order so the first
+// occurrence is always the one referenced.
+func markDuplicates(results [][]File) {
+	first := make(map[string]*FileRef)
+	for _, files := range results {
+		for i := range files {
+			f := &files[i]
+			if ref, ok := first[f.ChecksumSHA256]; ok {
+				f.DuplicateOf = ref
+				continue
+			}
+			first[f.ChecksumSHA256] = &FileRef{FieldName: f.FieldName, OriginalName: f.OriginalName}
+		}
+	}
+}
+
+// uploadFile runs the per-file pipeline for a single file: MIME detection,
+// validation, optional checksum, and the storage write. The work runs under a
+// per-file context; if that context's own deadline expires (rather than the
+// batch's), a *TimeoutError naming the file is returned. The upload hooks
+// are called around it.
+func (gfm *GFileMux) uploadFile(ctx context.Context, bucket string, src fileSource) (File, error) {
+	if gfm.onUploadStart != nil {
+		gfm.onUploadStart(ctx, src.field, src.fileHeader())
+	}
+	fileCtx, cancel := gfm.fileContext(ctx)
+	defer cancel()
+
+	fileData, err := gfm.processFile(fileCtx, bucket, src)
+	if err != nil && ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+		err = &TimeoutError{
+			Op:      fmt.Sprintf("upload of file %q in field %q", src.name, src.field),
+			Timeout: gfm.perFileTimeout,
+			Err:     fileCtx.Err(),
+		}
+	}
+	if err != nil {
+		if gfm.onUploadError != nil {
+			gfm.onUploadError(ctx, src.field, err)
+		}
+		return File{}, err
+	}
+	if gfm.onUploadSuccess != nil {
+		gfm.onUploadSuccess(ctx, fileData)
+	}
+	return fileData, nil
+}
+
+// processFile does the work of uploadFile under the per-file context.
+func (gfm *GFileMux) processFile(ctx context.Context, bucket string, src fileSource) (File, error) {
+	key := src.field
+
+	// body is what gets stored; rs is the same content when it is seekable,
+	// and nil for a forward-only stream.
+	var (
+		body io.Reader
+		rs   io.ReadSeeker
+	)
+	if src.stream != nil {
+		body = src.stream
+	} else {
+		f, err := gfm.openSource(ctx, src)
+		if err != nil {
+			return File{}, fmt.Errorf("could not open file for field %q: %w", key, err)
+		}
+		defer f.Close()
+		body, rs = f, f
+	}
+
+	size := src.size
+	if size < 0 && rs != nil {
+		// Unknown up front (UploadFiles, spooled parts); measure the seekable content.
+		var err error
+		if size, err = rs.Seek(0, io.SeekEnd); err != nil {
+			return File{}, fmt.Errorf("could not determine size for field %q: %w", key, err)
+		}
+	}
+
+	originalName := src.name
+	if gfm.requireFilename && !hasFilename(originalName) {
+		return File{}, &ValidationError{Field: key, Message: "file has no filename"}
+	}
+	if gfm.normalizeUnicodeNames {
+		if !utf8.ValidString(originalName) {
+			return File{}, &ValidationError{Field: key, Message: fmt.Sprintf("file name %q is not valid UTF-8", originalName)}
+		}
+		originalName = norm.NFC.String(originalName)
+	}
+
+	uploadedFileName := gfm.fileNameGenerator(originalName)
+
+	// Detect MIME type from the first 512 bytes, or with the configured
+	// detector. A stream is peeked instead, and body then replays the peeked
+	// bytes ahead of the rest; streams are spooled when a detector is set.
+	timings := FileTimings{FieldName: key, OriginalName: originalName}
+	phaseStart := time.Now()
+	var (
+		mimeType string
+		err      error
+	)
+	if rs != nil {
+		mimeType, err = gfm.detectContentType(rs)
+	} else {
+		mimeType, body, err = utils.PeekContentType(body)
+	}
+	if err != nil {
+		return File{}, fmt.Errorf("could not detect MIME type for field %q: %w", key, err)
+	}
+	mimeType = gfm.resolveMimeType(originalName, mimeType)
+	timings.MimeDetection = time.Since(phaseStart)
+	phaseStart = time.Now()
+
+	fileData := File{
+		FieldName:        key,
+		OriginalName:     originalName,
+		Extension:        FileExtension(originalName),
+		UploadedFileName: uploadedFileName,
+		MimeType:         mimeType,
+		DeclaredMimeType: declaredMimeType(src.declaredType),
+		Size:             size,
+	}
+
+	// Run user-configured validators before touching storage.
+	if err := gfm.fileValidator(fileData); err != nil {
+		return File{}, fmt.Errorf("validation failed for field %q: %w", key, err)
+	}
+	if !gfm.postStoreValidation && rs != nil {
+		if err := gfm.validateFileContent(ctx, fileData, rs); err != nil {
+			return File{}, fmt.Errorf("validation failed for field %q: %w", key, err)
+		}
+	}
+
+	// Optionally compute SHA-256 before upload (reader is seeked back afterward).
+	// A stream cannot be hashed up front, so its expected checksum is instead
+	// verified while it is stored.
+	var streamHash hash.Hash
+	if rs != nil && (gfm.needsChecksum() || src.expectedSHA256 != "") {
+		checksum, err := utils.ComputeSHA256(rs)
+		if err != nil {
+			return File{}, fmt.Errorf("could not compute checksum for field %q: %w", key, err)
+		}
+		if err := checksumMismatch(key, src.expectedSHA256, checksum); err != nil {
+			return File{}, err
+		}
+		if gfm.computeChecksum || gfm.detectDuplicates {
+			fileData.ChecksumSHA256 = checksum
+		}
+		if gfm.nameFromChecksum {
+			fileData.UploadedFileName = checksumFileName(originalName, checksum)
+		}
+	}
+
+	if rs == nil && src.expectedSHA256 != "" {
+		streamHash = sha256.New()
+		body = io.TeeReader(body, streamHash)
+	}
+	// File.Checksum is hashed from the bytes as they are stored.
+	var hasher *hashingReader
+	if gfm.checksumAlgorithm != ChecksumAlgorithmNone {
+		h, err := gfm.checksumAlgorithm.newHash()
+		if err != nil {
+			return File{}, err
+		}
+		body, hasher = newHashingReader(body, h)
+	}
+
+	timings.Validation = time.Since(phaseStart)
+	phaseStart = time.Now()
+
+	// Upload to the configured storage backend.
+	var userMetadata map[string]string
+	if gfm.uploadMetadata != nil {
+		userMetadata = gfm.uploadMetadata(ctx, fileData)
+	}
+	if fileData.ChecksumSHA256 != "" {
+		userMetadata = MergeMetadata(userMetadata, map[string]string{ChecksumMetadataKey: fileData.ChecksumSHA256})
+	}
+	prefix := keyPrefixFromContext(ctx)
+	fileData.UploadedFileName, err = gfm.resolveOverwrite(ctx, key, bucket, prefix, fileData.UploadedFileName)
+	if err != nil {
+		return File{}, err
+	}
+	metadata, err := gfm.storage.Upload(ctx, body, &UploadFileOptions{
+		FileName:    prefix + fileData.UploadedFileName,
+		Bucket:      bucket,
+		ContentType: mimeType,
+		Size:        max(size, 0),
+		Metadata:    userMetadata,
+	})
+	if err != nil {
+		return File{}, fmt.Errorf("storage upload failed for field %q: %w", key, err)
+	}
+	if metadata.Size < 0 {
+		err := fmt.Errorf("storage upload for field %q: %w: got %d", key, ErrNegativeSize, metadata.Size)
+		gfm.discardStored(ctx, bucket, metadata.Key, err)
+		return File{}, err
+	}
+	if streamHash != nil {
+		if err := checksumMismatch(key, src.expectedSHA256, hex.EncodeToString(streamHash.Sum(nil))); err != nil {
+			gfm.discardStored(ctx, bucket, metadata.Key, err)
+			return File{}, err
+		}
+	}
+
+	if hasher != nil {
+		fileData.Checksum, err = gfm.storedChecksum(hasher, rs, metadata.Size)
+		if err != nil {
+			return File{}, fmt.Errorf("could not compute checksum for field %q: %w", key, err)
+		}
+	}
+
+	timings.Storage = time.Since(phaseStart)
+	gfm.recordFileTimings(ctx, timings)
+
+	fileData.Size = metadata.Size
+	fileData.FolderDestination = metadata.FolderDestination
+	fileData.StorageKey = metadata.Key
+
+	if gfm.publicIDGenerator != nil {
+		if err := gfm.assignPublicID(ctx, bucket, &fileData); err != nil {
+			err = fmt.Errorf("field %q: %w", key, err)
+			gfm.discardStored(ctx, bucket, metadata.Key, err)
+			return File{}, err
+		}
+	}
+
+	if gfm.audit != nil {
+		if err := gfm.audit.record(ctx, bucket, fileData); err != nil {
+			gfm.log(ctx, slog.LevelError, "audit log write failed", "error", err)
+		}
+	}
+
+	if gfm.postStoreValidation && gfm.hasContentValidation() {
+		gfm.schedulePostStoreValidation(ctx, bucket, fileData)
+	}
+
+	return fileData, nil
+}
+
+// storedChecksum returns the File.Checksum digest that hasher computed while
+// the file was stored. A backend that skipped over part of a seekable file
+// leaves the digest incomplete; the file is then hashed again from rs. A
+// stream cannot be reread, so its checksum is left empty in that case.
+func (gfm *GFileMux) storedChecksum(hasher *hashingReader, rs io.ReadSeeker, size int64) (string, error) {
+	if sum, ok := hasher.sum(size); ok {
+		return sum, nil
+	}
+	if rs == nil {
+		return "", nil
+	}
+	h, err := gfm.checksumAlgorithm.newHash()
+	if err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// discardStored deletes a file that was stored but then failed the upload
+// because of err, logging the outcome.
+func (gfm *GFileMux) discardStored(ctx context.Context, bucket, key string, err error) {
+	gfm.log(ctx, slog.LevelWarn, "stored file failed the upload, deleting it",
+		"bucket", bucket, "key", key, "error", err)
+	if err := gfm.storage.Delete(ctx, bucket, key); err != nil {
+		gfm.log(ctx, slog.LevelError, "could not delete file that failed the upload",
+			"bucket", bucket, "key", key, "error", err)
+	}
+}
+
+// keyPrefixKey is the context key under which Upload records the prefix
+// computed by WithKeyPrefixFunc.
+type keyPrefixKey struct{}
+
+// requestContext adds what later stages need from r to ctx: the client IP for
+// the audit trail and the key prefix from WithKeyPrefixFunc. An error from the
+// prefix function, or an unsafe prefix, rejects the request.
+func (gfm *GFileMux) requestContext(ctx context.Context, r *http.Request) (context.Context, error) {
+	if gfm.audit != nil {
+		ctx = withClientIP(ctx, r)
+	}
+	if gfm.keyPrefixFunc != nil {
+		prefix, err := gfm.keyPrefixFunc(r)
+		if err == nil {
+			err = checkKeyPrefix(prefix)
+		}
+		if err != nil {
+			return ctx, err
+		}
+		ctx = context.WithValue(ctx, keyPrefixKey{}, prefix)
+	}
+	return ctx, nil
+}
+
+// keyPrefixFromContext returns the storage key prefix for the request, if any.
+func keyPrefixFromContext(ctx context.Context) string {
+	prefix, _ := ctx.Value(keyPrefixKey{}).(string)
+	return prefix
+}
+
+// checkKeyPrefix rejects prefixes that could escape the bucket.
+func checkKeyPrefix(prefix string) error {
+	if strings.HasPrefix(prefix, "/") || slices.Contains(strings.Split(prefix, "/"), "..") {
+		return fmt.Errorf("GFileMux: invalid key prefix %q", prefix)
+	}
+	return nil
+}
+
+// declaredMimeType normalizes a part's Content-Type header to a lowercase
+// media type without parameters, or "" when it is missing or malformed.
+func declaredMimeType(header string) string {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// expectedChecksum returns the client-provided SHA-256 for the i-th file of
+// field key, read from the companion form value named by
+// WithChecksumFieldSuffix, or "" when the option is off.
+func (gfm *GFileMux) expectedChecksum(values map[string][]string, key string, i int) (string, error) {
+	if gfm.checksumFieldSuffix == "" {
+		return "", nil
+	}
+	name := key + gfm.checksumFieldSuffix
+	checksums := values[name]
+	if i >= len(checksums) || strings.TrimSpace(checksums[i]) == "" {
+		return "", &ValidationError{Field: key, Message: fmt.Sprintf("no checksum provided in form field %q", name)}
+	}
+	checksum := strings.ToLower(strings.TrimSpace(checksums[i]))
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return "", &ValidationError{Field: key, Message: fmt.Sprintf("form field %q is not a hex SHA-256 digest", name)}
+	}
+	return checksum, nil
+}
+
+// checksumMismatch reports a file whose content does not hash to the
+// checksum the client provided, if any.
+func checksumMismatch(key, expected, actual string) error {
+	if expected == "" || expected == actual {
+		return nil
+	}
+	return &ValidationError{Field: key, Message: fmt.Sprintf("checksum mismatch: expected SHA-256 %s, got %s", expected, actual)}
+}
+
+// needsChecksum reports whether files must be hashed before they are stored.
+func (gfm *GFileMux) needsChecksum() bool {
+	return gfm.computeChecksum || gfm.nameFromChecksum || gfm.detectDuplicates
+}
+
+// hasContentValidation reports whether any validator needs the file content.
+func (gfm *GFileMux) hasContentValidation() bool {
+	return gfm.contentValidator != nil || gfm.remoteValidator != nil
+}
+
+// validateFileContent runs the validators that read the file content: the
+// content validator and the remote policy service. rs is rewound afterward.
+func (gfm *GFileMux) validateFileContent(ctx context.Context, file File, rs io.ReadSeeker) error {
+	if gfm.contentValidator != nil {
+		if err := validateContent(gfm.contentValidator, file, rs); err != nil {
+			return err
+		}
+	}
+	if gfm.remoteValidator != nil {
+		if err := gfm.remoteValidator.validate(ctx, gfm, file, rs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // UploadSingle is a convenience wrapper around Upload that enforces exactly one
 // file for the given field. If the request contains more than one file for that
-// field, the middleware returns an error before touching storage.
+// field, the middleware returns a *MaxFilesError, and neither next nor a
+// success response (WithResponseEnvelope, WithCreatedResponse,
+// WithUploadSuccessHandlerFunc) runs. Storage is not touched, except that
+// with WithStreaming the first file is stored before the second is read. It
+// is UploadWith(WithBucket(bucket), WithKeys(key), WithMaxFileCount(1)).
 func (gfm *GFileMux) UploadSingle(bucket, key string) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		inner := gfm.Upload(bucket, key)
-		return inner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			files, err := GetUploadedFilesFromContext(r)
-			if err != nil {
-				gfm.uploadErrorHandler(err).ServeHTTP(w, r)
-				return
-			}
-			if len(files[key]) > 1 {
-				gfm.uploadErrorHandler(
-					&MaxFilesError{Field: key, Got: len(files[key]), MaxFiles: 1},
-				).ServeHTTP(w, r)
-				return
+	return gfm.UploadWith(WithBucket(bucket), WithKeys(key), WithMaxFileCount(1))
+}
+
+// NamedReader is a file to upload with UploadFiles.
+type NamedReader struct {
+	// FieldName groups the file in the returned Files, like a multipart field.
+	FieldName string
+	// FileName is the original file name, used for naming and validation.
+	FileName string
+	// Reader supplies the content. An io.ReadSeeker is read from its start;
+	// any other reader is buffered first (see WithSpoolMemoryThreshold).
+	Reader io.Reader
+}
+
+// nopSeekCloser leaves closing a caller-owned io.ReadSeeker to the caller.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// spooledFile is a temporary copy of a non-seekable reader that is removed
+// from disk when closed.
+type spooledFile struct {
+	*os.File
+}
+
+func (sf spooledFile) Close() error {
+	err := sf.File.Close()
+	os.Remove(sf.File.Name())
+	return err
+}
+
+// spool makes r readable more than once. Content of at most
+// spoolMemoryThreshold bytes is kept in memory; anything larger is copied to a
+// temporary file, removed again when the returned reader is closed.
+func (gfm *GFileMux) spool(r io.Reader) (io.ReadSeekCloser, error) {
+	if gfm.spoolMemoryThreshold > 0 {
+		buf, err := io.ReadAll(io.LimitReader(r, gfm.spoolMemoryThreshold+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buf)) <= gfm.spoolMemoryThreshold {
+			return nopSeekCloser{bytes.NewReader(buf)}, nil
+		}
+		r = io.MultiReader(bytes.NewReader(buf), r)
+	}
+	rs, err := utils.ReaderToSeeker(r)
+	if err != nil {
+		return nil, err
+	}
+	return spooledFile{rs.(*os.File)}, nil
+}
+
+// namedReaderSource adapts a NamedReader to a fileSource.
+func (gfm *GFileMux) namedReaderSource(nr NamedReader) fileSource {
+	return fileSource{
+		field: nr.FieldName,
+		name:  nr.FileName,
+		size:  -1,
+		open: func() (io.ReadSeekCloser, error) {
+			if rs, ok := nr.Reader.(io.ReadSeeker); ok {
+				return nopSeekCloser{rs}, nil
 			}
-			next.ServeHTTP(w, r)
-		}))
+			return gfm.spool(nr.Reader)
+		},
+	}
+}
+
+// UploadFiles runs files through the same pipeline as Upload — naming,
+// validation, checksums and the storage write — without an HTTP request, for
+// use from CLIs, scheduled jobs and tests. Files sharing a FieldName are grouped
+// in the result in the order given, and the max-files, max-duration and
+// per-file timeout options apply as they do to Upload. The caller keeps
+// ownership of the readers and is responsible for closing them.
+func (gfm *GFileMux) UploadFiles(ctx context.Context, bucket string, files []NamedReader) (Files, error) {
+	if err := gfm.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	var fields []fieldSources
+	index := make(map[string]int)
+	for _, nr := range files {
+		if nr.Reader == nil {
+			return nil, &ValidationError{Field: nr.FieldName, Message: fmt.Sprintf("file %q has no reader", nr.FileName)}
+		}
+		i, ok := index[nr.FieldName]
+		if !ok {
+			i = len(fields)
+			index[nr.FieldName] = i
+			fields = append(fields, fieldSources{field: nr.FieldName})
+		}
+		fields[i].sources = append(fields[i].sources, gfm.namedReaderSource(nr))
+	}
+	totalFiles := 0
+	for _, field := range fields {
+		if gfm.maxFiles > 0 && len(field.sources) > gfm.maxFiles {
+			return nil, &MaxFilesError{Field: field.field, Got: len(field.sources), MaxFiles: gfm.maxFiles}
+		}
+		totalFiles += len(field.sources)
+		if err := gfm.checkTotalFiles(field.field, totalFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := gfm.batchContext(ctx)
+	defer cancel()
+
+	results, err := gfm.uploadFields(ctx, bucket, fields)
+	if err != nil {
+		if gfm.maxUploadDuration > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = &TimeoutError{Op: "upload", Timeout: gfm.maxUploadDuration, Err: ctx.Err()}
+		}
+		gfm.log(ctx, slog.LevelError, "upload failed", "error", err)
+		return nil, err
+	}
+
+	uploaded := make(Files, len(fields))
+	for i, field := range fields {
+		uploaded[field.field] = results[i]
 	}
+	gfm.log(ctx, slog.LevelInfo, "upload completed", "bucket", bucket, "total_files", uploaded.Count())
+	return uploaded, nil
 }
@@ -3,19 +3,33 @@ package GFileMux
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // MockStorage is a mock implementation of the Storage interface for testing.
 type MockStorage struct {
+	mu            sync.Mutex
 	uploadedFiles map[string]*UploadedFileMetadata
 }
 
 func (ms *MockStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	if ms.uploadedFiles == nil {
 		ms.uploadedFiles = make(map[string]*UploadedFileMetadata)
 	}
@@ -39,6 +53,27 @@ func (ms *MockStorage) Close() error {
 	return nil
 }
 
+// recordingStorage keeps the bytes of every upload, keyed by file name.
+type recordingStorage struct {
+	MockStorage
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (rs *recordingStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	rs.mu.Lock()
+	if rs.files == nil {
+		rs.files = make(map[string][]byte)
+	}
+	rs.files[options.FileName] = data
+	rs.mu.Unlock()
+	return &UploadedFileMetadata{FolderDestination: options.Bucket, Size: int64(len(data)), Key: options.FileName}, nil
+}
+
 func newTestHandler(t *testing.T, opts ...GFileMuxOption) *GFileMux {
 	t.Helper()
 	defaults := []GFileMuxOption{
@@ -70,6 +105,31 @@ func buildMultipartRequest(t *testing.T, field, filename string, content []byte)
 	return req
 }
 
+// formPart describes a single file part for buildMultipartRequestParts.
+type formPart struct {
+	field, filename string
+	content         []byte
+}
+
+// buildMultipartRequestParts builds a multipart request whose file parts appear
+// in the given order.
+func buildMultipartRequestParts(t *testing.T, parts ...formPart) *http.Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for _, p := range parts {
+		part, err := w.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			t.Fatalf("CreateFormFile: %v", err)
+		}
+		part.Write(p.content)
+	}
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
 func TestUpload(t *testing.T) {
 	handler := newTestHandler(t)
 
@@ -113,9 +173,9 @@ func TestUpload_MaxFiles(t *testing.T) {
 		t.Error("handler should not be reached when MaxFiles is exceeded")
 	})).ServeHTTP(rr, req)
 
-	// Default error handler returns 500; check it didn't reach the next handler.
-	if rr.Code == http.StatusOK {
-		t.Fatal("expected non-200 when MaxFiles exceeded")
+	// The default error handler maps MaxFilesError to 400.
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 when MaxFiles exceeded, got %d", rr.Code)
 	}
 }
 
@@ -158,6 +218,184 @@ func TestUpload_Checksum(t *testing.T) {
 	})).ServeHTTP(rr, req)
 }
 
+func TestUpload_ChecksumFieldSuffix(t *testing.T) {
+	const helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	cases := []struct {
+		name     string
+		checksum []string
+		wantCode int
+	}{
+		{"match", []string{helloSHA256}, http.StatusOK},
+		{"match ignores case", []string{strings.ToUpper(helloSHA256)}, http.StatusOK},
+		{"mismatch", []string{strings.Repeat("0", 64)}, http.StatusBadRequest},
+		{"missing", nil, http.StatusBadRequest},
+		{"malformed", []string{"not-a-digest"}, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &recordingStorage{}
+			handler := newTestHandler(t, WithStorage(store), WithChecksumFieldSuffix("_sha256"))
+
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			for _, v := range tc.checksum {
+				mw.WriteField("file1_sha256", v)
+			}
+			part, _ := mw.CreateFormFile("file1", "test.txt")
+			part.Write([]byte("hello world"))
+			mw.Close()
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+
+			rr := httptest.NewRecorder()
+			handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusOK && len(store.files) != 0 {
+				t.Errorf("a rejected file should not be stored, got %d files", len(store.files))
+			}
+		})
+	}
+}
+
+func TestUpload_KeyPrefixFunc(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+		WithKeyPrefixFunc(func(r *http.Request) (string, error) {
+			user := r.Header.Get("X-User")
+			if user == "" {
+				return "", &ValidationError{Message: "no user"}
+			}
+			return "users/" + user + "/", nil
+		}),
+	)
+
+	req := buildMultipartRequest(t, "file1", "a.txt", []byte("hello"))
+	req.Header.Set("X-User", "42")
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if _, ok := store.files["users/42/a.txt"]; !ok {
+		t.Errorf("expected the file stored under the user prefix, got %v", store.files)
+	}
+	if f := files["file1"][0]; f.StorageKey != "users/42/a.txt" || f.UploadedFileName != "a.txt" {
+		t.Errorf("unexpected StorageKey %q / UploadedFileName %q", f.StorageKey, f.UploadedFileName)
+	}
+
+	for name, user := range map[string]string{"resolver error": "", "traversal": ".."} {
+		t.Run(name, func(t *testing.T) {
+			req := buildMultipartRequest(t, "file1", "b.txt", []byte("hello"))
+			req.Header.Set("X-User", user)
+			rr := httptest.NewRecorder()
+			handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("next handler should not run")
+			})).ServeHTTP(rr, req)
+			if rr.Code == http.StatusOK {
+				t.Fatalf("expected an error response, got 200")
+			}
+		})
+	}
+}
+
+func TestUpload_FieldMaxFileSize(t *testing.T) {
+	handler := newTestHandler(t,
+		WithStorage(&recordingStorage{}),
+		WithFieldMaxFileSize(map[string]int64{"avatar": 4}),
+	)
+
+	cases := []struct {
+		name     string
+		part     formPart
+		wantCode int
+	}{
+		{"within cap", formPart{"avatar", "a.png", []byte("1234")}, http.StatusOK},
+		{"over cap", formPart{"avatar", "a.png", []byte("12345")}, http.StatusRequestEntityTooLarge},
+		{"unlisted field", formPart{"document", "d.txt", []byte("a much longer document")}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := buildMultipartRequestParts(t, tc.part)
+			rr := httptest.NewRecorder()
+			handler.Upload("bucket", tc.part.field)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusOK {
+				for _, want := range []string{`\"avatar\"`, "got 5 bytes", "max allowed is 4 bytes"} {
+					if !strings.Contains(rr.Body.String(), want) {
+						t.Errorf("expected the error to contain %s, got %s", want, rr.Body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAddSizes(t *testing.T) {
+	cases := []struct {
+		total, size, want int64
+	}{
+		{0, 10, 10},
+		{10, -1, 10}, // unknown sizes count as zero
+		{math.MaxInt64 - 1, 1, math.MaxInt64},
+		{math.MaxInt64 - 1, 2, math.MaxInt64}, // saturates instead of wrapping
+		{math.MaxInt64, math.MaxInt64, math.MaxInt64},
+	}
+	for _, tc := range cases {
+		if got := addSizes(tc.total, tc.size); got != tc.want {
+			t.Errorf("addSizes(%d, %d) = %d, want %d", tc.total, tc.size, got, tc.want)
+		}
+	}
+}
+
+// negativeSizeStorage reports a negative size for every upload.
+type negativeSizeStorage struct {
+	MockStorage
+	deleted []string
+}
+
+func (s *negativeSizeStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	return &UploadedFileMetadata{Key: options.FileName, Size: -5}, nil
+}
+
+func (s *negativeSizeStorage) Delete(ctx context.Context, bucket, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestUpload_NegativeStoredSize(t *testing.T) {
+	store := &negativeSizeStorage{}
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequest(t, "file1", "a.txt", []byte("hello"))
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler should not run")
+	})).ServeHTTP(rr, req)
+	if !errors.Is(gotErr, ErrNegativeSize) {
+		t.Fatalf("expected ErrNegativeSize, got %v", gotErr)
+	}
+	if ErrorStatusCode(gotErr) != http.StatusInternalServerError {
+		t.Errorf("expected a 500 status, got %d", ErrorStatusCode(gotErr))
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "a.txt" {
+		t.Errorf("expected the stored file to be deleted, got %v", store.deleted)
+	}
+}
+
 func TestUploadSingle(t *testing.T) {
 	handler := newTestHandler(t)
 	req := buildMultipartRequest(t, "avatar", "pic.jpg", []byte("fake-jpeg"))
@@ -178,6 +416,50 @@ func TestUploadSingle(t *testing.T) {
 	}
 }
 
+func TestUploadSingle_TooManyFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []GFileMuxOption
+	}{
+		{"next", nil},
+		{"streaming", []GFileMuxOption{WithStreaming(true)}},
+		{"envelope", []GFileMuxOption{WithResponseEnvelope(func(files Files) any { return files.Count() })}},
+		{"created", []GFileMuxOption{WithCreatedResponse(true)}},
+		{"success handler", []GFileMuxOption{WithUploadSuccessHandlerFunc(func(files Files) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		})}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+			store := &MockStorage{}
+			handler := newTestHandler(t, append([]GFileMuxOption{
+				WithStorage(store),
+				WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+			}, tc.opts...)...)
+			req := buildMultipartRequestParts(t,
+				formPart{"avatar", "a.jpg", []byte("a")},
+				formPart{"avatar", "b.jpg", []byte("b")},
+			)
+			rr := httptest.NewRecorder()
+			called := false
+			handler.UploadSingle("images", "avatar")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})).ServeHTTP(rr, req)
+
+			var mfe *MaxFilesError
+			if !errors.As(gotErr, &mfe) || mfe.Field != "avatar" || mfe.MaxFiles != 1 {
+				t.Fatalf("expected a MaxFilesError for avatar, got %v", gotErr)
+			}
+			if called || rr.Code == http.StatusOK || rr.Code == http.StatusCreated {
+				t.Errorf("expected the upload to be rejected, got %d (next called: %v)", rr.Code, called)
+			}
+			if tc.name != "streaming" && len(store.uploadedFiles) != 0 {
+				t.Errorf("expected nothing stored, got %v", store.uploadedFiles)
+			}
+		})
+	}
+}
+
 func TestUpload_IgnoreNonExistentKey(t *testing.T) {
 	handler := newTestHandler(t, WithIgnoreNonExistentKey(true))
 	req := buildMultipartRequest(t, "file1", "a.txt", []byte("data"))
@@ -192,3 +474,1473 @@ func TestUpload_IgnoreNonExistentKey(t *testing.T) {
 		t.Fatalf("expected 200 when IgnoreNonExistentKey=true, got %d", rr.Code)
 	}
 }
+
+func TestUpload_NoFilesUploaded(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streaming=%v", streaming), func(t *testing.T) {
+			var gotErr error
+			handler := newTestHandler(t, WithStreaming(streaming), WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)))
+			req := buildMultipartRequest(t, "file1", "a.txt", []byte("data"))
+			rr := httptest.NewRecorder()
+
+			handler.Upload("bucket", "file1", "avatar", "document")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Fatal("next handler should not run")
+			})).ServeHTTP(rr, req)
+
+			if !errors.Is(gotErr, ErrNoFilesUploaded) {
+				t.Fatalf("expected ErrNoFilesUploaded, got %v", gotErr)
+			}
+			if !strings.Contains(gotErr.Error(), "no files were provided in fields: avatar, document") {
+				t.Errorf("expected the missing fields listed, got %q", gotErr)
+			}
+			if code := ErrorStatusCode(gotErr); code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", code)
+			}
+		})
+	}
+}
+
+func TestUpload_DuplicateKeys(t *testing.T) {
+	var logs bytes.Buffer
+	store := &MockStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithCaseInsensitiveFields(true),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	req := buildMultipartRequestParts(t,
+		formPart{"file", "a.txt", []byte("a")},
+		formPart{"other", "b.txt", []byte("b")},
+	)
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "file", "other", "file", "FILE")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+	if len(store.uploadedFiles) != 2 || len(files["file"]) != 1 || len(files["other"]) != 1 {
+		t.Errorf("expected each field stored once, got %d uploads and %v", len(store.uploadedFiles), files)
+	}
+	if !strings.Contains(logs.String(), "duplicate keys") {
+		t.Errorf("expected a warning about the duplicates, got %q", logs.String())
+	}
+}
+
+func TestUploadWith_MaxSize(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t, WithStorage(store))
+	content := bytes.Repeat([]byte("x"), 4096)
+
+	for _, tc := range []struct {
+		name string
+		mw   func(http.Handler) http.Handler
+		want int
+	}{
+		{"route limit", handler.UploadWith(WithBucket("small"), WithKeys("file"), WithMaxSize(1024)), http.StatusRequestEntityTooLarge},
+		{"handler limit", handler.UploadWith(WithBucket("large"), WithKeys("file")), http.StatusOK},
+	} {
+		var files Files
+		rr := httptest.NewRecorder()
+		tc.mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ = GetUploadedFilesFromContext(r)
+		})).ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", content))
+		if rr.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, rr.Code, rr.Body)
+		}
+		if tc.want == http.StatusOK && files["file"][0].FolderDestination != "large" {
+			t.Errorf("%s: expected bucket %q, got %q", tc.name, "large", files["file"][0].FolderDestination)
+		}
+	}
+}
+
+func TestUpload_MimeOverrides(t *testing.T) {
+	handler := newTestHandler(t, WithMimeOverrides(map[string]string{"CSV": "text/csv"}))
+
+	req := buildMultipartRequest(t, "data", "report.csv", []byte("a,b,c\n1,2,3\n"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "data")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, err := GetUploadedFilesFromContext(r)
+		if err != nil {
+			t.Fatalf("GetUploadedFilesFromContext: %v", err)
+		}
+		if got := files["data"][0].MimeType; got != "text/csv" {
+			t.Fatalf("expected overridden MIME type text/csv, got %q", got)
+		}
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestUpload_RepeatedFieldKeepsOrder(t *testing.T) {
+	handler := newTestHandler(t)
+	want := []string{"first.txt", "second.txt", "third.txt"}
+
+	// Repeat the request so a scheduling-dependent ordering would show up.
+	for run := 0; run < 20; run++ {
+		req := buildMultipartRequestParts(t,
+			formPart{"files", want[0], []byte("1")},
+			formPart{"other", "x.txt", []byte("x")},
+			formPart{"files", want[1], []byte("2")},
+			formPart{"files", want[2], []byte("3")},
+		)
+		rr := httptest.NewRecorder()
+
+		handler.Upload("bucket", "other", "files")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, err := GetFilesByFieldFromContext(r, "files")
+			if err != nil {
+				t.Fatalf("GetFilesByFieldFromContext: %v", err)
+			}
+			if len(files) != len(want) {
+				t.Fatalf("expected %d files, got %d", len(want), len(files))
+			}
+			for i, f := range files {
+				if f.OriginalName != want[i] {
+					t.Fatalf("run %d: file %d: expected %q, got %q", run, i, want[i], f.OriginalName)
+				}
+			}
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+}
+
+// latencyStorage delays each upload by the duration configured for its
+// original file name, so completion order can be made to differ from
+// submission order.
+type latencyStorage struct {
+	MockStorage
+	delays map[string]time.Duration
+}
+
+func (ls *latencyStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	for name, d := range ls.delays {
+		if strings.HasSuffix(options.FileName, name) {
+			time.Sleep(d)
+		}
+	}
+	return &UploadedFileMetadata{FolderDestination: options.Bucket, Key: options.FileName}, nil
+}
+
+func TestUpload_OrderStableUnderStorageLatency(t *testing.T) {
+	// Earlier files are slowest, so any completion-ordered collection would
+	// come out reversed.
+	store := &latencyStorage{delays: map[string]time.Duration{
+		"a.txt": 6 * time.Millisecond,
+		"b.txt": 3 * time.Millisecond,
+		"c.txt": 0,
+	}}
+	handler := newTestHandler(t, WithStorage(store))
+	want := []string{"a.txt", "b.txt", "c.txt"}
+
+	for run := 0; run < 5; run++ {
+		req := buildMultipartRequestParts(t,
+			formPart{"files", "a.txt", []byte("a")},
+			formPart{"files", "b.txt", []byte("b")},
+			formPart{"other", "c.txt", []byte("x")},
+			formPart{"files", "c.txt", []byte("c")},
+		)
+		rr := httptest.NewRecorder()
+		var files []File
+		handler.Upload("bucket", "files", "other")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ = GetFilesByFieldFromContext(r, "files")
+		})).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+
+		if len(files) != len(want) {
+			t.Fatalf("run %d: expected %d files, got %d", run, len(want), len(files))
+		}
+		for i, f := range files {
+			if f.OriginalName != want[i] {
+				t.Fatalf("run %d: file %d: expected %q, got %q", run, i, want[i], f.OriginalName)
+			}
+		}
+	}
+}
+
+// blockingStorage never completes an upload until its context is cancelled.
+type blockingStorage struct {
+	MockStorage
+}
+
+func (bs *blockingStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// captureErrorHandler records the error passed to the upload error handler.
+func captureErrorHandler(got *error) UploadErrorHandlerFunc {
+	return func(err error) http.HandlerFunc {
+		*got = err
+		return DefaultUploadErrorHandlerFunc(err)
+	}
+}
+
+func TestUpload_MaxUploadDuration_Storage(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(&blockingStorage{}),
+		WithMaxUploadDuration(50*time.Millisecond),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequest(t, "file1", "a.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be reached when the upload times out")
+		})).ServeHTTP(rr, req)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload was not cancelled by WithMaxUploadDuration")
+	}
+
+	var te *TimeoutError
+	if !errors.As(gotErr, &te) {
+		t.Fatalf("expected *TimeoutError, got %T: %v", gotErr, gotErr)
+	}
+	if !errors.Is(gotErr, context.DeadlineExceeded) {
+		t.Fatalf("expected error to wrap context.DeadlineExceeded, got %v", gotErr)
+	}
+}
+
+// slowStorage takes delay to store each file, giving up early when its context
+// is done.
+type slowStorage struct {
+	MockStorage
+	delay time.Duration
+}
+
+func (ss *slowStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	select {
+	case <-time.After(ss.delay):
+		return ss.MockStorage.Upload(ctx, reader, options)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestUpload_UploadTimeout(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(&slowStorage{delay: 5 * time.Second}),
+		WithUploadTimeout(50*time.Millisecond),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequest(t, "file1", "a.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached when the upload times out")
+	})).ServeHTTP(rr, req)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("upload was not cut short by WithUploadTimeout; took %v", elapsed)
+	}
+	if !errors.Is(gotErr, context.DeadlineExceeded) {
+		t.Fatalf("expected error to wrap context.DeadlineExceeded, got %v", gotErr)
+	}
+	if got := ErrorStatusCode(gotErr); got != http.StatusRequestTimeout {
+		t.Errorf("expected status 408, got %d", got)
+	}
+	if rr.Code != http.StatusRequestTimeout {
+		t.Errorf("expected response 408, got %d", rr.Code)
+	}
+}
+
+// slowReader yields its data one byte at a time with a delay between reads.
+type slowReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	if len(sr.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(sr.delay)
+	p[0] = sr.data[0]
+	sr.data = sr.data[1:]
+	return 1, nil
+}
+
+func TestUpload_MaxUploadDuration_Parsing(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithMaxUploadDuration(30*time.Millisecond),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	part, _ := mw.CreateFormFile("file1", "a.txt")
+	part.Write([]byte("some data"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &slowReader{data: body.Bytes(), delay: time.Millisecond})
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached when parsing times out")
+	})).ServeHTTP(rr, req)
+
+	var te *TimeoutError
+	if !errors.As(gotErr, &te) {
+		t.Fatalf("expected *TimeoutError, got %T: %v", gotErr, gotErr)
+	}
+}
+
+func TestUpload_NormalizeUnicodeNames(t *testing.T) {
+	const nfd = "cafe\u0301.txt" // "e" followed by a combining acute accent
+	const nfc = "caf\u00e9.txt"
+
+	var generatorInput string
+	handler := newTestHandler(t,
+		WithNormalizeUnicodeNames(true),
+		WithFileNameGeneratorFunc(func(s string) string {
+			generatorInput = s
+			return s
+		}),
+	)
+
+	req := buildMultipartRequest(t, "file1", nfd, []byte("data"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, err := GetFilesByFieldFromContext(r, "file1")
+		if err != nil {
+			t.Fatalf("GetFilesByFieldFromContext: %v", err)
+		}
+		if files[0].OriginalName != nfc {
+			t.Errorf("expected NFC OriginalName %q, got %q", nfc, files[0].OriginalName)
+		}
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if generatorInput != nfc {
+		t.Errorf("expected generator to receive %q, got %q", nfc, generatorInput)
+	}
+}
+
+func TestUpload_NormalizeUnicodeNames_InvalidUTF8(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithNormalizeUnicodeNames(true),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequest(t, "file1", "bad\xff.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached for an invalid UTF-8 name")
+	})).ServeHTTP(rr, req)
+
+	var ve *ValidationError
+	if !errors.As(gotErr, &ve) {
+		t.Fatalf("expected *ValidationError, got %T: %v", gotErr, gotErr)
+	}
+}
+
+// selectiveBlockingStorage blocks uploads of one file name until cancelled and
+// completes all others immediately.
+type selectiveBlockingStorage struct {
+	MockStorage
+	block string
+}
+
+func (s *selectiveBlockingStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	if options.FileName == s.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.MockStorage.Upload(ctx, reader, options)
+}
+
+func TestUpload_PerFileTimeout(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(&selectiveBlockingStorage{block: "stuck.txt"}),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+		WithPerFileTimeout(50*time.Millisecond),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequestParts(t,
+		formPart{"docs", "ok.txt", []byte("1")},
+		formPart{"docs", "stuck.txt", []byte("2")},
+		formPart{"images", "fine.txt", []byte("3")},
+	)
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "docs", "images")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached when a file times out")
+	})).ServeHTTP(rr, req)
+
+	var te *TimeoutError
+	if !errors.As(gotErr, &te) {
+		t.Fatalf("expected *TimeoutError, got %T: %v", gotErr, gotErr)
+	}
+	if te.Timeout != 50*time.Millisecond {
+		t.Errorf("expected per-file timeout in error, got %s", te.Timeout)
+	}
+	if !strings.Contains(te.Op, "stuck.txt") {
+		t.Errorf("expected error to name the stuck file, got %q", te.Op)
+	}
+}
+
+func TestUpload_ResponseEnvelope(t *testing.T) {
+	type envelope struct {
+		Data []File         `json:"data"`
+		Meta map[string]int `json:"meta"`
+	}
+	handler := newTestHandler(t, WithResponseEnvelope(func(files Files) any {
+		return envelope{Data: files.All(), Meta: map[string]int{"count": files.Count()}}
+	}))
+
+	req := buildMultipartRequest(t, "file1", "a.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler should not be called when an envelope is configured")
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+	var got envelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if got.Meta["count"] != 1 || len(got.Data) != 1 || got.Data[0].OriginalName != "a.txt" {
+		t.Fatalf("unexpected envelope: %+v", got)
+	}
+}
+
+func TestUpload_ContentValidator_RejectsScript(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t,
+		WithContentValidatorFunc(RejectShebangScripts()),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+
+	req := buildMultipartRequest(t, "file1", "notes.txt", []byte("#!/bin/sh\nrm -rf /\n"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached for a shebang script")
+	})).ServeHTTP(rr, req)
+
+	var ve *ValidationError
+	if !errors.As(gotErr, &ve) {
+		t.Fatalf("expected *ValidationError, got %T: %v", gotErr, gotErr)
+	}
+}
+
+func TestUpload_ContentValidator_ReaderRewound(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+		WithContentValidatorFunc(func(f File, r io.ReadSeeker) error {
+			_, err := io.ReadAll(r) // consume everything
+			return err
+		}),
+	)
+
+	content := []byte("the whole file")
+	req := buildMultipartRequest(t, "file1", "a.txt", content)
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := store.files["a.txt"]; !bytes.Equal(got, content) {
+		t.Fatalf("storage should receive the full content, got %q", got)
+	}
+}
+
+func TestUpload_ContentValidator_AfterMetadataValidator(t *testing.T) {
+	content := []byte("%PDF-1.7 the full document")
+	for _, reject := range []bool{false, true} {
+		var calls []string
+		handler := newTestHandler(t,
+			WithFileValidatorFunc(func(f File) error {
+				calls = append(calls, "metadata")
+				if reject {
+					return &ValidationError{Field: f.FieldName, Message: "rejected"}
+				}
+				return nil
+			}),
+			WithContentValidatorFunc(func(f File, r io.ReadSeeker) error {
+				calls = append(calls, "content")
+				if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, content) {
+					t.Errorf("content validator read %q, %v; want the file from its first byte", got, err)
+				}
+				return nil
+			}),
+		)
+
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rr, buildMultipartRequest(t, "file", "doc.pdf", content))
+
+		want := []string{"metadata", "content"}
+		if reject {
+			want = want[:1]
+		}
+		if !slices.Equal(calls, want) {
+			t.Errorf("reject=%v: validators ran as %v, want %v", reject, calls, want)
+		}
+	}
+}
+
+func TestGFileMux_SetAcceptingUploads(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithChunkDir(t.TempDir()),
+		WithUploadErrorHandlerFunc(DefaultUploadErrorHandlerFunc),
+		WithPausedRetryAfter(1500*time.Millisecond),
+	)
+	upload := handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	chunked := handler.ChunkedUpload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	const content = "0123456789"
+	rr := sendChunk(t, chunked, "", content, 0, 4)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("first chunk: expected 202, got %d: %s", rr.Code, rr.Body)
+	}
+	session := rr.Header().Get(ChunkSessionHeader)
+
+	handler.SetAcceptingUploads(false)
+	rr = httptest.NewRecorder()
+	upload.ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("hello")))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("paused: expected 503 with Retry-After 2, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := sendChunk(t, chunked, "", content, 0, 4); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("paused: expected a new chunk session to get 503, got %d", rr.Code)
+	}
+	if rr := sendChunk(t, chunked, session, content, 5, 9); rr.Code != http.StatusOK {
+		t.Errorf("paused: expected the open chunk session to finish, got %d: %s", rr.Code, rr.Body)
+	}
+	if len(store.files) != 1 {
+		t.Fatalf("expected only the chunked file to be stored, got %d files", len(store.files))
+	}
+
+	handler.SetAcceptingUploads(true)
+	rr = httptest.NewRecorder()
+	upload.ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("hello")))
+	if rr.Code != http.StatusOK {
+		t.Errorf("resumed: expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestGFileMux_UploadHooks(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		var (
+			mu        sync.Mutex
+			started   []string
+			succeeded []string
+			failed    []string
+		)
+		handler := newTestHandler(t,
+			WithStreaming(streaming),
+			WithFileValidatorFunc(func(f File) error {
+				if f.OriginalName == "bad.txt" {
+					return errors.New("rejected")
+				}
+				return nil
+			}),
+			WithOnUploadStart(func(ctx context.Context, field string, header *multipart.FileHeader) {
+				mu.Lock()
+				defer mu.Unlock()
+				started = append(started, field+"/"+header.Filename)
+			}),
+			WithOnUploadSuccess(func(ctx context.Context, file File) {
+				mu.Lock()
+				defer mu.Unlock()
+				succeeded = append(succeeded, file.FieldName+"/"+file.OriginalName)
+			}),
+			WithOnUploadError(func(ctx context.Context, field string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, field+": "+err.Error())
+			}),
+		)
+		req := buildMultipartRequestParts(t,
+			formPart{"docs", "good.txt", []byte("fine")},
+			formPart{"docs", "bad.txt", []byte("not fine")},
+		)
+		handler.Upload("bucket", "docs")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(httptest.NewRecorder(), req)
+
+		if want := []string{"docs/bad.txt", "docs/good.txt"}; !slices.Equal(slices.Sorted(slices.Values(started)), want) {
+			t.Errorf("streaming=%v: started = %v, want %v", streaming, started, want)
+		}
+		if !slices.Equal(succeeded, []string{"docs/good.txt"}) {
+			t.Errorf("streaming=%v: succeeded = %v", streaming, succeeded)
+		}
+		if len(failed) != 1 || !strings.Contains(failed[0], "docs: ") || !strings.Contains(failed[0], "rejected") {
+			t.Errorf("streaming=%v: failed = %v", streaming, failed)
+		}
+	}
+
+	// Every hook is optional.
+	rr := httptest.NewRecorder()
+	newTestHandler(t).Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("x")))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 without hooks, got %d", rr.Code)
+	}
+}
+
+// metadataStorage records the metadata each file was uploaded with.
+type metadataStorage struct {
+	MockStorage
+	metadata sync.Map // file name → map[string]string
+}
+
+func (ms *metadataStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	ms.metadata.Store(options.FileName, options.Metadata)
+	return ms.MockStorage.Upload(ctx, reader, options)
+}
+
+func TestGFileMux_UploadMetadata(t *testing.T) {
+	type userKey struct{}
+	store := &metadataStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+		WithChecksumValidation(true),
+		WithUploadMetadata(func(ctx context.Context, file File) map[string]string {
+			return map[string]string{
+				"Uploaded-By":       ctx.Value(userKey{}).(string),
+				"original-name":     file.OriginalName,
+				ChecksumMetadataKey: "spoofed",
+			}
+		}),
+	)
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("hello"))
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, "42"))
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	got, _ := store.metadata.Load("a.txt")
+	want := map[string]string{
+		"uploaded-by":       "42",
+		"original-name":     "a.txt",
+		ChecksumMetadataKey: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	if !maps.Equal(got.(map[string]string), want) {
+		t.Errorf("metadata = %v, want %v", got, want)
+	}
+
+	// Without the option or a checksum, no metadata is sent.
+	plain := &metadataStorage{}
+	newTestHandler(t, WithStorage(plain), WithFileNameGeneratorFunc(func(s string) string { return s })).
+		Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), buildMultipartRequest(t, "file", "b.txt", []byte("x")))
+	if got, ok := plain.metadata.Load("b.txt"); !ok || got.(map[string]string) != nil {
+		t.Errorf("expected nil metadata, got %v (stored %v)", got, ok)
+	}
+}
+
+func TestUpload_ContentTypeDetector(t *testing.T) {
+	// The marker sits past the 512 bytes the built-in detection sniffs.
+	content := append(bytes.Repeat([]byte("PK"), 400), []byte("word/document.xml")...)
+	detector := func(rs io.ReadSeeker) (string, error) {
+		data, err := io.ReadAll(rs)
+		if bytes.Contains(data, []byte("word/")) {
+			return "application/vnd.openxmlformats-officedocument.wordprocessingml.document; charset=binary", err
+		}
+		return "application/zip", err
+	}
+
+	for _, streaming := range []bool{false, true} {
+		store := &readerKindStorage{}
+		handler := newTestHandler(t,
+			WithStorage(store),
+			WithStreaming(streaming),
+			WithContentTypeDetector(detector),
+			WithFileNameGeneratorFunc(func(s string) string { return s }),
+		)
+		rr := httptest.NewRecorder()
+		var files Files
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ = GetUploadedFilesFromContext(r)
+		})).ServeHTTP(rr, buildMultipartRequest(t, "file", "report.docx", content))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("streaming=%v: expected 200, got %d: %s", streaming, rr.Code, rr.Body)
+		}
+		if got := files["file"][0].MimeType; got != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" {
+			t.Errorf("streaming=%v: MimeType = %q", streaming, got)
+		}
+		if !bytes.Equal(store.files["report.docx"], content) {
+			t.Errorf("streaming=%v: storage should receive the full content", streaming)
+		}
+	}
+
+	var gotErr error
+	handler := newTestHandler(t,
+		WithContentTypeDetector(func(io.ReadSeeker) (string, error) { return "", errors.New("detector broke") }),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), buildMultipartRequest(t, "file", "a.txt", []byte("x")))
+	if gotErr == nil || !strings.Contains(gotErr.Error(), "detector broke") {
+		t.Errorf("expected the detector error, got %v", gotErr)
+	}
+}
+
+func TestUpload_ParseErrors(t *testing.T) {
+	oversized := buildMultipartRequest(t, "file1", "big.bin", make([]byte, 4096))
+
+	malformed := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("not a multipart body"))
+	malformed.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+
+	notMultipart := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	notMultipart.Header.Set("Content-Type", "application/json")
+
+	// disconnected simulates a client that drops the connection mid-body:
+	// the request context is cancelled and the body read fails.
+	ctx, cancel := context.WithCancel(context.Background())
+	disconnected := buildMultipartRequest(t, "file1", "a.txt", []byte("data")).WithContext(ctx)
+	disconnected.Body = io.NopCloser(readerFunc(func(p []byte) (int, error) {
+		cancel()
+		return 0, io.ErrUnexpectedEOF
+	}))
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		check  func(error) bool
+	}{
+		{"oversized", oversized, http.StatusRequestEntityTooLarge, func(err error) bool {
+			var se *SizeError
+			return errors.As(err, &se) && se.MaxSize == 1024
+		}},
+		{"malformed", malformed, http.StatusBadRequest, func(err error) bool {
+			var pe *ParseError
+			return errors.As(err, &pe)
+		}},
+		{"not multipart", notMultipart, http.StatusBadRequest, func(err error) bool {
+			var pe *ParseError
+			return errors.As(err, &pe) && errors.Is(err, http.ErrNotMultipart)
+		}},
+		{"client disconnected", disconnected, StatusClientClosedRequest, func(err error) bool {
+			return errors.Is(err, ErrClientDisconnected)
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+			handler := newTestHandler(t,
+				WithMaxFileSize(1024),
+				WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+			)
+			rr := httptest.NewRecorder()
+			handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("handler should not be reached")
+			})).ServeHTTP(rr, tc.req)
+
+			if !tc.check(gotErr) {
+				t.Errorf("unexpected error %T: %v", gotErr, gotErr)
+			}
+			if rr.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rr.Code)
+			}
+		})
+	}
+}
+
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestErrorStatusCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{&ValidationError{Message: "bad"}, http.StatusBadRequest},
+		{&MaxFilesError{Field: "f", Got: 3, MaxFiles: 1}, http.StatusBadRequest},
+		{&ParseError{Err: io.EOF}, http.StatusBadRequest},
+		{&SizeError{Size: 2, MaxSize: 1}, http.StatusRequestEntityTooLarge},
+		{&ContextLimitError{Files: 3, MaxFiles: 2}, http.StatusRequestEntityTooLarge},
+		{&TimeoutError{Op: "upload", Err: context.DeadlineExceeded}, http.StatusRequestTimeout},
+		{fmt.Errorf("%w: boom", ErrClientDisconnected), StatusClientClosedRequest},
+		{ErrMemoryBudgetExhausted, http.StatusServiceUnavailable},
+		{fmt.Errorf("wrapped: %w", &ValidationError{Message: "bad"}), http.StatusBadRequest},
+		{&StorageError{Backend: "disk", Op: "Upload", Err: io.ErrShortWrite}, http.StatusInternalServerError},
+		{errors.New("unknown"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		if got := ErrorStatusCode(tc.err); got != tc.want {
+			t.Errorf("ErrorStatusCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestUpload_FileNameFromChecksum(t *testing.T) {
+	handler := newTestHandler(t, WithUploadedFileNameFromChecksum(true))
+
+	// SHA-256("hello world") = b94d27b9934d3e08a52e52d7da7dabfac484efe04294e576b4e8ad5194123ecf
+	req := buildMultipartRequest(t, "asset", "site.min.css", []byte("hello world"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "asset")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, err := GetFilesByFieldFromContext(r, "asset")
+		if err != nil {
+			t.Fatalf("GetFilesByFieldFromContext: %v", err)
+		}
+		const want = "site.min.b94d27b9934d.css"
+		if files[0].UploadedFileName != want || files[0].StorageKey != want {
+			t.Errorf("expected name %q, got UploadedFileName=%q StorageKey=%q",
+				want, files[0].UploadedFileName, files[0].StorageKey)
+		}
+		if files[0].ChecksumSHA256 != "" {
+			t.Errorf("ChecksumSHA256 should stay empty unless WithChecksumValidation is set")
+		}
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestChecksumFileName(t *testing.T) {
+	const sum = "b94d27b9934d3e08a52e52d7da7dabfac484efe04294e576b4e8ad5194123ecf"
+	cases := map[string]string{
+		"logo.png":       "logo.b94d27b9934d.png",
+		"archive.tar.gz": "archive.tar.b94d27b9934d.gz",
+		"README":         "README.b94d27b9934d",
+		".env":           ".env.b94d27b9934d",
+	}
+	for in, want := range cases {
+		if got := checksumFileName(in, sum); got != want {
+			t.Errorf("checksumFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUpload_FallbackMimeFromExtension(t *testing.T) {
+	binary := []byte{0x00, 0x01, 0x02, 0x03} // sniffs as application/octet-stream
+
+	for _, tc := range []struct {
+		enable bool
+		want   string
+	}{
+		{false, "application/octet-stream"},
+		{true, "application/json"},
+	} {
+		handler := newTestHandler(t, WithFallbackMimeFromExtension(tc.enable))
+		req := buildMultipartRequest(t, "file1", "payload.json", binary)
+		rr := httptest.NewRecorder()
+
+		handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ := GetFilesByFieldFromContext(r, "file1")
+			if got := files[0].MimeType; got != tc.want {
+				t.Errorf("fallback=%v: expected MIME %q, got %q", tc.enable, tc.want, got)
+			}
+		})).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+}
+
+func TestUpload_FallbackMimeFromExtension_KeepsSniffedType(t *testing.T) {
+	handler := newTestHandler(t, WithFallbackMimeFromExtension(true))
+	// Plain text is sniffed successfully, so the .json extension must not win.
+	req := buildMultipartRequest(t, "file1", "notes.json", []byte("just some text"))
+	rr := httptest.NewRecorder()
+
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ := GetFilesByFieldFromContext(r, "file1")
+		if got := files[0].MimeType; got != "text/plain" {
+			t.Errorf("expected sniffed text/plain, got %q", got)
+		}
+	})).ServeHTTP(rr, req)
+}
+
+func TestGFileMux_UploadFiles(t *testing.T) {
+	store := &recordingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(name string) string { return name }),
+	)
+
+	// A plain io.Reader (not seekable) exercises the spooling path.
+	plain := io.MultiReader(strings.NewReader("second "), strings.NewReader("doc"))
+	files, err := handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "docs", FileName: "a.txt", Reader: strings.NewReader("first doc")},
+		{FieldName: "avatar", FileName: "me.txt", Reader: strings.NewReader("avatar")},
+		{FieldName: "docs", FileName: "b.txt", Reader: plain},
+	})
+	if err != nil {
+		t.Fatalf("UploadFiles: %v", err)
+	}
+
+	docs := files["docs"]
+	if len(docs) != 2 || docs[0].OriginalName != "a.txt" || docs[1].OriginalName != "b.txt" {
+		t.Fatalf("unexpected docs: %+v", docs)
+	}
+	if docs[1].Size != int64(len("second doc")) {
+		t.Errorf("expected size %d, got %d", len("second doc"), docs[1].Size)
+	}
+	if len(files["avatar"]) != 1 {
+		t.Fatalf("expected one avatar, got %+v", files["avatar"])
+	}
+	if got := string(store.files["b.txt"]); got != "second doc" {
+		t.Errorf("expected stored content %q, got %q", "second doc", got)
+	}
+}
+
+func TestGFileMux_UploadFiles_Validation(t *testing.T) {
+	handler := newTestHandler(t,
+		WithMaxFiles(1),
+		WithFileValidatorFunc(ValidateFileExtension(".txt")),
+	)
+	ctx := context.Background()
+
+	_, err := handler.UploadFiles(ctx, "bucket", []NamedReader{
+		{FieldName: "f", FileName: "a.txt", Reader: strings.NewReader("a")},
+		{FieldName: "f", FileName: "b.txt", Reader: strings.NewReader("b")},
+	})
+	var mfe *MaxFilesError
+	if !errors.As(err, &mfe) {
+		t.Errorf("expected *MaxFilesError, got %v", err)
+	}
+
+	_, err = handler.UploadFiles(ctx, "bucket", []NamedReader{
+		{FieldName: "f", FileName: "a.exe", Reader: strings.NewReader("a")},
+	})
+	if err == nil {
+		t.Error("expected the file validator to reject a.exe")
+	}
+
+	_, err = handler.UploadFiles(ctx, "bucket", []NamedReader{{FieldName: "f", FileName: "a.txt"}})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Errorf("expected *ValidationError for a missing reader, got %v", err)
+	}
+}
+
+func TestGFileMux_DynamicMaxSize(t *testing.T) {
+	handler := newTestHandler(t,
+		WithMaxFileSize(1<<10),
+		WithDynamicMaxSize(func(r *http.Request) int64 {
+			if r.Header.Get("X-Plan") == "premium" {
+				return 1 << 20
+			}
+			return 0 // fall back to the static limit
+		}),
+	)
+	content := bytes.Repeat([]byte("a"), 4<<10)
+
+	for _, tc := range []struct {
+		plan string
+		want int
+	}{
+		{"premium", http.StatusOK},
+		{"free", http.StatusRequestEntityTooLarge},
+	} {
+		req := buildMultipartRequest(t, "file", "big.txt", content)
+		req.Header.Set("X-Plan", tc.plan)
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("plan %q: expected status %d, got %d", tc.plan, tc.want, rr.Code)
+		}
+	}
+}
+
+func TestGFileMux_DuplicateDetection(t *testing.T) {
+	handler := newTestHandler(t, WithDuplicateDetection(true))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"docs", "a.txt", []byte("same")},
+		formPart{"docs", "b.txt", []byte("other")},
+		formPart{"extra", "c.txt", []byte("same")},
+	)
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "docs", "extra")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	if files["docs"][0].DuplicateOf != nil || files["docs"][1].DuplicateOf != nil {
+		t.Errorf("unique files should not be marked: %+v", files["docs"])
+	}
+	want := FileRef{FieldName: "docs", OriginalName: "a.txt"}
+	if got := files["extra"][0].DuplicateOf; got == nil || *got != want {
+		t.Errorf("expected c.txt to be a duplicate of %+v, got %+v", want, got)
+	}
+}
+
+func TestGFileMux_ContextFileLimitEnforcement(t *testing.T) {
+	store := &MockStorage{}
+	handler := newTestHandler(t, WithStorage(store), WithContextFileLimitEnforcement(2, 0))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"a", "1.txt", []byte("one")},
+		formPart{"a", "2.txt", []byte("two")},
+		formPart{"b", "3.txt", []byte("three")},
+	)
+	rr := httptest.NewRecorder()
+	var reached bool
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true })
+	// The second middleware would push the context to three files.
+	handler.Upload("bucket", "a")(handler.Upload("bucket", "b")(final)).ServeHTTP(rr, req)
+
+	if reached {
+		t.Fatal("expected the chain to stop at the context limit")
+	}
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+	if len(store.uploadedFiles) != 2 {
+		t.Errorf("expected only the first middleware's files to be stored, got %d", len(store.uploadedFiles))
+	}
+}
+
+func TestGFileMux_MaxTotalFiles(t *testing.T) {
+	parts := []formPart{
+		{"photos", "a.jpg", []byte("a")},
+		{"photos", "b.jpg", []byte("b")},
+		{"docs", "c.pdf", []byte("c")},
+		{"docs", "d.pdf", []byte("d")},
+	}
+	for _, streaming := range []bool{false, true} {
+		var gotErr error
+		store := &MockStorage{}
+		handler := newTestHandler(t,
+			WithStorage(store),
+			WithStreaming(streaming),
+			WithMaxFilesPerField(2),
+			WithMaxTotalFiles(3),
+			WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+		)
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "photos", "docs")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rr, buildMultipartRequestParts(t, parts...))
+
+		var mfe *MaxFilesError
+		if !errors.As(gotErr, &mfe) || !mfe.Total || mfe.Field != "docs" || mfe.Got != 4 || mfe.MaxFiles != 3 {
+			t.Fatalf("streaming=%v: expected a total MaxFilesError at docs, got %#v", streaming, gotErr)
+		}
+		if !strings.Contains(mfe.Error(), `too many files in request: got 4, max allowed is 3 (exceeded at field "docs")`) {
+			t.Errorf("streaming=%v: unexpected message %q", streaming, mfe.Error())
+		}
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("streaming=%v: expected 400, got %d", streaming, rr.Code)
+		}
+		if !streaming && len(store.uploadedFiles) != 0 {
+			t.Errorf("expected nothing stored, got %v", store.uploadedFiles)
+		}
+	}
+
+	// The per-field limit is checked as well, and UploadFiles applies both.
+	handler := newTestHandler(t, WithMaxFilesPerField(1), WithMaxTotalFiles(3))
+	_, err := handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "photos", FileName: "a.jpg", Reader: strings.NewReader("a")},
+		{FieldName: "photos", FileName: "b.jpg", Reader: strings.NewReader("b")},
+	})
+	var mfe *MaxFilesError
+	if !errors.As(err, &mfe) || mfe.Total || mfe.MaxFiles != 1 {
+		t.Errorf("expected a per-field MaxFilesError, got %v", err)
+	}
+	_, err = handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "a", FileName: "a.jpg", Reader: strings.NewReader("a")},
+		{FieldName: "b", FileName: "b.jpg", Reader: strings.NewReader("b")},
+		{FieldName: "c", FileName: "c.jpg", Reader: strings.NewReader("c")},
+		{FieldName: "d", FileName: "d.jpg", Reader: strings.NewReader("d")},
+	})
+	if !errors.As(err, &mfe) || !mfe.Total || mfe.Field != "d" {
+		t.Errorf("expected a total MaxFilesError at d, got %v", err)
+	}
+}
+
+func TestGFileMux_ContextFileLimitEnforcement_TotalFiles(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		var gotErr error
+		handler := newTestHandler(t,
+			WithStreaming(streaming),
+			WithMaxFiles(3),
+			WithContextFileLimitEnforcement(4, 0),
+			WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+		)
+		req := buildMultipartRequestParts(t,
+			formPart{"a", "1.txt", []byte("1")},
+			formPart{"a", "2.txt", []byte("2")},
+			formPart{"a", "3.txt", []byte("3")},
+			formPart{"b", "4.txt", []byte("4")},
+			formPart{"b", "5.txt", []byte("5")},
+		)
+		handler.Upload("bucket", "a", "b")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(httptest.NewRecorder(), req)
+
+		var cle *ContextLimitError
+		if !errors.As(gotErr, &cle) || cle.Field != "b" || cle.MaxFiles != 4 {
+			t.Errorf("streaming=%v: expected a *ContextLimitError naming field b, got %v", streaming, gotErr)
+		}
+	}
+}
+
+func TestGFileMux_ContextFileLimitEnforcement_Size(t *testing.T) {
+	handler := newTestHandler(t, WithContextFileLimitEnforcement(0, 4))
+	req := buildMultipartRequest(t, "f", "big.txt", []byte("too large"))
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "f")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+}
+
+func TestGFileMux_MaxTotalUploadSize(t *testing.T) {
+	parts := []formPart{
+		{"photos", "a.jpg", []byte("aaaa")},
+		{"photos", "b.jpg", []byte("bbbb")},
+		{"docs", "c.pdf", []byte("cccc")},
+	}
+	for _, streaming := range []bool{false, true} {
+		var gotErr error
+		store := &recordingStorage{}
+		handler := newTestHandler(t,
+			WithStorage(store),
+			WithStreaming(streaming),
+			WithMaxTotalUploadSize(10),
+			WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+		)
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "photos", "docs")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rr, buildMultipartRequestParts(t, parts...))
+
+		var se *SizeError
+		if !errors.As(gotErr, &se) || !se.Total || se.Field != "docs" || se.Size <= 10 || se.MaxSize != 10 {
+			t.Fatalf("streaming=%v: expected a total SizeError at docs, got %#v", streaming, gotErr)
+		}
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("streaming=%v: expected 413, got %d", streaming, rr.Code)
+		}
+		if !streaming && len(store.files) != 0 {
+			t.Errorf("expected nothing stored, got %v", store.files)
+		}
+	}
+
+	// Files within the total, however many fields they span, are accepted.
+	rr := httptest.NewRecorder()
+	newTestHandler(t, WithMaxTotalUploadSize(12)).Upload("bucket", "photos", "docs")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rr, buildMultipartRequestParts(t, parts...))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 at the limit, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestGFileMux_ContextFileLimitEnforcement_SizeAcrossFields(t *testing.T) {
+	// Each file fits on its own; together they exceed the cap, so none is stored.
+	store := &recordingStorage{}
+	var gotErr error
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithContextFileLimitEnforcement(0, 10),
+		WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+	)
+	req := buildMultipartRequestParts(t,
+		formPart{"a", "one.txt", []byte("123456")},
+		formPart{"b", "two.txt", []byte("123456")},
+	)
+	handler.Upload("bucket", "a", "b")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), req)
+
+	var cle *ContextLimitError
+	if !errors.As(gotErr, &cle) || cle.Size != 12 || cle.MaxSize != 10 || cle.Field != "b" {
+		t.Fatalf("expected a *ContextLimitError for 12 of 10 bytes at field b, got %v", gotErr)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("expected nothing stored, got %d files", len(store.files))
+	}
+}
+
+func TestGFileMux_RequireFilename(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t, WithRequireFilename(true), WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)))
+
+	// A file part whose Content-Disposition carries no filename.
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"`)
+	h.Set("Content-Type", "application/octet-stream")
+	part, _ := mw.CreatePart(h)
+	part.Write([]byte("data"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called")
+	})).ServeHTTP(rr, req)
+
+	var ve *ValidationError
+	if !errors.As(gotErr, &ve) || !strings.Contains(ve.Message, "no filename") {
+		t.Errorf("expected a missing-filename *ValidationError, got %v", gotErr)
+	}
+
+	_, err := handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "file", Reader: strings.NewReader("data")},
+	})
+	if !errors.As(err, &ve) {
+		t.Errorf("expected *ValidationError for an empty FileName, got %v", err)
+	}
+}
+
+func TestGFileMux_CaseInsensitiveFields(t *testing.T) {
+	handler := newTestHandler(t, WithCaseInsensitiveFields(true))
+
+	req := buildMultipartRequest(t, "File1", "a.txt", []byte("a"))
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || len(files["file1"]) != 1 {
+		t.Fatalf("expected File1 to match file1, got status %d and %v", rr.Code, files)
+	}
+}
+
+func TestGFileMux_CaseInsensitiveFields_Ambiguous(t *testing.T) {
+	var gotErr error
+	handler := newTestHandler(t, WithCaseInsensitiveFields(true), WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"File1", "a.txt", []byte("a")},
+		formPart{"FILE1", "b.txt", []byte("b")},
+	)
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	var ve *ValidationError
+	if !errors.As(gotErr, &ve) || rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an ambiguity *ValidationError with 400, got %d: %v", rr.Code, gotErr)
+	}
+}
+
+func TestGFileMux_EmptyBucket(t *testing.T) {
+	// MockStorage declares no capabilities, so an empty bucket is accepted.
+	handler := newTestHandler(t)
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("a"))
+	rr := httptest.NewRecorder()
+	handler.Upload("", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 without a bucket, got %d: %s", rr.Code, rr.Body)
+	}
+
+	store := &readerKindStorage{requireBucket: true}
+	handler = newTestHandler(t, WithStorage(store))
+	req = buildMultipartRequest(t, "file", "a.txt", []byte("a"))
+	rr = httptest.NewRecorder()
+	handler.Upload("", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called")
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError || len(store.files) != 0 {
+		t.Errorf("expected 500 and nothing stored, got %d with %d files", rr.Code, len(store.files))
+	}
+
+	if _, err := handler.UploadFiles(context.Background(), "", []NamedReader{
+		{FieldName: "file", FileName: "a.txt", Reader: strings.NewReader("a")},
+	}); err == nil || !strings.Contains(err.Error(), "bucket is required") {
+		t.Errorf("expected a missing-bucket error, got %v", err)
+	}
+}
+
+func TestGFileMux_CreatedResponse(t *testing.T) {
+	handler := newTestHandler(t,
+		WithCreatedResponse(true),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler should not be called for a single created file")
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rr.Code)
+	}
+	if loc := rr.Header().Get("Location"); loc != "mock/path/a.txt" {
+		t.Errorf("expected Location from storage Path, got %q", loc)
+	}
+	var got File
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil || got.OriginalName != "a.txt" {
+		t.Errorf("expected the file as the body, got %q (%v)", rr.Body, err)
+	}
+
+	// Several files fall back to the normal success path.
+	req = buildMultipartRequestParts(t,
+		formPart{"file", "a.txt", []byte("a")},
+		formPart{"file", "b.txt", []byte("b")},
+	)
+	rr = httptest.NewRecorder()
+	var reached bool
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})).ServeHTTP(rr, req)
+	if !reached || rr.Code != http.StatusOK || rr.Header().Get("Location") != "" {
+		t.Errorf("expected the next handler with no Location, got reached=%v status %d", reached, rr.Code)
+	}
+}
+
+func TestGFileMux_DeclaredMimeType(t *testing.T) {
+	handler := newTestHandler(t)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="a.png"`)
+	h.Set("Content-Type", "Image/PNG; charset=binary")
+	part, _ := mw.CreatePart(h)
+	part.Write([]byte("plain text"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+
+	got := files["file"][0]
+	if got.DeclaredMimeType != "image/png" || got.MimeType != "text/plain" {
+		t.Errorf("expected declared image/png and detected text/plain, got %q and %q", got.DeclaredMimeType, got.MimeType)
+	}
+}
+
+// peakStorage tracks the largest number of uploads in flight at once.
+type peakStorage struct {
+	MockStorage
+	mu             sync.Mutex
+	inFlight, peak int
+}
+
+func (ps *peakStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	ps.mu.Lock()
+	ps.inFlight++
+	ps.peak = max(ps.peak, ps.inFlight)
+	ps.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	ps.mu.Lock()
+	ps.inFlight--
+	ps.mu.Unlock()
+	return &UploadedFileMetadata{Key: options.FileName}, nil
+}
+
+func TestGFileMux_MaxConcurrency(t *testing.T) {
+	store := &peakStorage{}
+	handler := newTestHandler(t, WithStorage(store), WithMaxConcurrency(3))
+
+	var parts []formPart
+	for i := 0; i < 9; i++ {
+		parts = append(parts, formPart{"files", fmt.Sprintf("%d.txt", i), []byte("x")})
+	}
+	req := buildMultipartRequestParts(t, parts...)
+	rr := httptest.NewRecorder()
+	var files []File
+	handler.Upload("bucket", "files")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetFilesByFieldFromContext(r, "files")
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	if store.peak < 2 || store.peak > 3 {
+		t.Errorf("expected files of one field to upload concurrently, at most 3 at once; peak was %d", store.peak)
+	}
+	for i, f := range files {
+		if want := fmt.Sprintf("%d.txt", i); f.OriginalName != want {
+			t.Fatalf("file %d: expected %q, got %q", i, want, f.OriginalName)
+		}
+	}
+}
+
+func TestGFileMux_MaxConcurrency_UnlimitedByDefault(t *testing.T) {
+	store := &peakStorage{}
+	handler := newTestHandler(t, WithStorage(store))
+
+	var parts []formPart
+	for i := 0; i < 16; i++ {
+		parts = append(parts, formPart{"files", fmt.Sprintf("%d.txt", i), []byte("x")})
+	}
+	req := buildMultipartRequestParts(t, parts...)
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "files")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	if store.peak <= 8 {
+		t.Errorf("expected more than 8 files to upload at once by default; peak was %d", store.peak)
+	}
+}
+
+func TestNew_RequireExplicitValidation(t *testing.T) {
+	if _, err := New(WithStorage(&MockStorage{}), WithRequireExplicitValidation(true)); err == nil {
+		t.Error("expected an error when no validator is configured")
+	}
+	if _, err := New(
+		WithStorage(&MockStorage{}),
+		WithRequireExplicitValidation(true),
+		WithFileValidatorFunc(DefaultFileValidator),
+	); err != nil {
+		t.Errorf("an explicit allow-all validator should be accepted, got %v", err)
+	}
+	if _, err := New(
+		WithStorage(&MockStorage{}),
+		WithRequireExplicitValidation(true),
+		WithContentValidatorFunc(RejectShebangScripts()),
+	); err != nil {
+		t.Errorf("a content validator should satisfy the requirement, got %v", err)
+	}
+}
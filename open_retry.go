@@ -0,0 +1,40 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+)
+
+// fileOpenBackoff is the delay before the first retry of a failed open; it
+// doubles on each further attempt.
+const fileOpenBackoff = 10 * time.Millisecond
+
+// openSource opens src, retrying transient failures up to fileOpenAttempts
+// times with exponential backoff. Other errors are returned at once.
+func (gfm *GFileMux) openSource(ctx context.Context, src fileSource) (io.ReadSeekCloser, error) {
+	delay := fileOpenBackoff
+	for attempt := 1; ; attempt++ {
+		f, err := src.open()
+		if err == nil || attempt >= gfm.fileOpenAttempts || !isTransientOpenError(err) {
+			return f, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientOpenError reports whether err is a failure to open a file that
+// may succeed on retry, such as running out of file descriptors under load.
+func isTransientOpenError(err error) bool {
+	return errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR)
+}
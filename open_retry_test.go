@@ -0,0 +1,54 @@
+package GFileMux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+// flakySource returns a fileSource whose open fails with failures in order
+// before succeeding, and a pointer to the number of open calls.
+func flakySource(failures ...error) (fileSource, *int) {
+	calls := 0
+	return fileSource{
+		field: "file",
+		name:  "a.txt",
+		size:  4,
+		open: func() (io.ReadSeekCloser, error) {
+			calls++
+			if calls <= len(failures) {
+				return nil, failures[calls-1]
+			}
+			return nopSeekCloser{bytes.NewReader([]byte("data"))}, nil
+		},
+	}, &calls
+}
+
+func TestGFileMux_FileOpenRetry(t *testing.T) {
+	handler := newTestHandler(t, WithFileOpenRetry(3))
+
+	src, calls := flakySource(syscall.EMFILE, syscall.EMFILE)
+	if _, err := handler.uploadFile(context.Background(), "bucket", src); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 open attempts, got %d", *calls)
+	}
+
+	src, calls = flakySource(syscall.EMFILE, syscall.EMFILE, syscall.EMFILE)
+	if _, err := handler.uploadFile(context.Background(), "bucket", src); !errors.Is(err, syscall.EMFILE) {
+		t.Errorf("expected the open error once attempts run out, got %v", err)
+	}
+
+	src, calls = flakySource(fs.ErrNotExist)
+	if _, err := handler.uploadFile(context.Background(), "bucket", src); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a non-transient error, got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected a non-transient error not to be retried, got %d attempts", *calls)
+	}
+}
@@ -1,22 +1,50 @@
 package GFileMux
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // FileValidatorFunc validates a File during upload, returning an error if the file is invalid.
 type FileValidatorFunc func(f File) error
 
+// FileContentValidatorFunc validates a File using its content. The reader is
+// positioned at the start of the file when the validator is called and is
+// rewound by the handler afterward, so validators may read as much as they need.
+type FileContentValidatorFunc func(f File, r io.ReadSeeker) error
+
 // UploadErrorHandlerFunc handles upload errors by returning an http.HandlerFunc
 // that writes an appropriate response to the client.
 type UploadErrorHandlerFunc func(err error) http.HandlerFunc
 
+// UploadSuccessHandlerFunc builds the HTTP response for a successful upload
+// from the files it stored. See WithUploadSuccessHandlerFunc.
+type UploadSuccessHandlerFunc func(files Files) http.HandlerFunc
+
 // FileNameGeneratorFunc generates a storage filename from the original filename.
 type FileNameGeneratorFunc func(s string) string
 
+// ContentTypeDetectorFunc detects the MIME type of a file's content. The
+// reader is positioned at the start of the file and may be read as far as
+// needed; the handler rewinds it afterward. See WithContentTypeDetector.
+type ContentTypeDetectorFunc func(rs io.ReadSeeker) (string, error)
+
+// QuotaCheckerFunc decides whether a request may store fileCount more files
+// totalling incomingBytes bytes, e.g. against a per-user quota. It returns an
+// error wrapping ErrQuotaExceeded to reject the request; other errors are
+// treated as failures of the quota system. See WithQuotaChecker.
+type QuotaCheckerFunc func(ctx context.Context, r *http.Request, incomingBytes int64, fileCount int) error
+
 var (
 	// DefaultMaxFileUploadSize is the default maximum allowed file size (5 MB).
 	DefaultMaxFileUploadSize int64 = 1024 * 1024 * 5
@@ -24,6 +52,10 @@ var (
 	// DefaultMaxFiles is the default maximum number of files per field (unlimited).
 	DefaultMaxFiles int = 0
 
+	// DefaultMaxConcurrency is the default number of files uploaded at once
+	// within a request (unlimited).
+	DefaultMaxConcurrency int = 0
+
 	// DefaultFileValidator accepts every file without validation.
 	DefaultFileValidator FileValidatorFunc = func(file File) error {
 		return nil
@@ -34,11 +66,21 @@ var (
 		return fmt.Sprintf("GFileMux-%d-%s", time.Now().Unix(), s)
 	}
 
-	// DefaultUploadErrorHandlerFunc returns a JSON error response for upload failures.
+	// DefaultPausedRetryAfter is the Retry-After sent while uploads are
+	// paused with SetAcceptingUploads, unless WithPausedRetryAfter is used.
+	DefaultPausedRetryAfter = 30 * time.Second
+
+	// DefaultUploadErrorHandlerFunc returns a JSON error response for upload
+	// failures, with the status code chosen by ErrorStatusCode. A
+	// *PausedError also sets the Retry-After header.
 	DefaultUploadErrorHandlerFunc UploadErrorHandlerFunc = func(err error) http.HandlerFunc {
 		return func(w http.ResponseWriter, _ *http.Request) {
+			var pe *PausedError
+			if errors.As(err, &pe) && pe.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(pe.RetryAfter.Seconds()))))
+			}
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(ErrorStatusCode(err))
 			fmt.Fprintf(w, `{"status":"error","message":"GFileMux: File upload failed","error":%q}`, err.Error())
 		}
 	}
@@ -51,7 +93,34 @@ func WithStorage(store Storage) GFileMuxOption {
 	}
 }
 
-// WithMaxFileSize sets the maximum allowed file size in bytes.
+// WithStorageBySizeThreshold sets a storage backend that routes each file by
+// size: files of at most threshold bytes go to small (e.g. a fast store) and
+// larger ones to large (e.g. cheap cold storage). Streamed files, whose size is
+// unknown when they are stored, go to large. It replaces WithStorage.
+//
+// The File.StorageKey and File.FolderDestination of each file are prefixed
+// with "small:" or "large:", and Storage() returns the routing backend, whose
+// Path, Delete, Open, Stat and Exists use that prefix to reach the backend
+// that stored the file. Exists with an unprefixed key, as WithOverwritePolicy
+// checks, asks both backends, and List merges both with prefixed keys. Options
+// that need one of these methods require both backends to support it: New
+// fails for WithOverwritePolicy unless both implement Exister, and for
+// WithPostStoreValidation unless both implement Opener.
+//
+//	GFileMux.WithStorageBySizeThreshold(1<<20, memStore, s3Store) // ≤ 1 MB in memory
+func WithStorageBySizeThreshold(threshold int64, small, large Storage) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		if small == nil || large == nil {
+			cfg.storage = nil
+			return
+		}
+		cfg.storage = &sizeRouter{threshold: threshold, small: small, large: large}
+	}
+}
+
+// WithMaxFileSize sets the maximum allowed file size in bytes. It also bounds
+// the raw request body, multipart overhead included; to cap the sum of the
+// file sizes themselves, use WithMaxTotalUploadSize.
 //
 //	GFileMux.WithMaxFileSize(10 << 20) // 10 MB
 func WithMaxFileSize(size int64) GFileMuxOption {
@@ -60,6 +129,54 @@ func WithMaxFileSize(size int64) GFileMuxOption {
 	}
 }
 
+// WithFieldMaxFileSize caps the size of each file in the listed fields, in
+// bytes, so that one form can accept a small avatar and a large document.
+// Fields that are not listed are limited only by WithMaxFileSize. A file over
+// its field's cap fails the upload with a *SizeError naming the field. Under
+// WithStreaming the cap is enforced as the file is read, and the reported size
+// is the number of bytes read when the cap was crossed.
+//
+//	GFileMux.WithFieldMaxFileSize(map[string]int64{
+//	    "avatar":   1 << 20,  // 1 MB
+//	    "document": 50 << 20, // 50 MB
+//	})
+func WithFieldMaxFileSize(limits map[string]int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.fieldMaxSizes = maps.Clone(limits)
+	}
+}
+
+// WithGlobalMemoryBudget caps the request-body bytes that may be buffered at
+// once across the whole process. Each request reserves its Content-Length (or
+// the size limit, when the length is unknown) before parsing and releases it
+// when the upload finishes; a request that does not fit is rejected with
+// ErrMemoryBudgetExhausted (503). The counter is shared by every GFileMux in
+// the process, and each handler admits requests against its own budget.
+//
+//	GFileMux.WithGlobalMemoryBudget(2 << 30) // 2 GB in flight at most
+func WithGlobalMemoryBudget(n int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.memoryBudget = n
+	}
+}
+
+// WithDynamicMaxSize computes the request body size limit per request, e.g. to
+// give premium users a larger limit based on a claim set by upstream auth
+// middleware. It overrides WithMaxFileSize; when fn returns 0 or a negative
+// size, the static limit is used instead.
+//
+//	GFileMux.WithDynamicMaxSize(func(r *http.Request) int64 {
+//		if r.Header.Get("X-Plan") == "premium" {
+//			return 1 << 30 // 1 GB
+//		}
+//		return 0 // use WithMaxFileSize
+//	})
+func WithDynamicMaxSize(fn func(*http.Request) int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.dynamicMaxSize = fn
+	}
+}
+
 // WithMaxFiles limits the number of files accepted per form field. When set to
 // 0 (the default), there is no limit.
 //
@@ -70,6 +187,71 @@ func WithMaxFiles(n int) GFileMuxOption {
 	}
 }
 
+// WithMaxFilesPerField limits the number of files accepted per form field. It
+// sets the same limit as WithMaxFiles, under the name that pairs with
+// WithMaxTotalFiles; 0 (the default) means no limit.
+//
+//	GFileMux.WithMaxFilesPerField(5)
+func WithMaxFilesPerField(n int) GFileMuxOption {
+	return WithMaxFiles(n)
+}
+
+// WithMaxTotalFiles limits the number of files accepted across all the fields
+// of a request; 0 (the default) means no limit. Going over it fails the
+// request with a *MaxFilesError whose Total is set and whose Field names the
+// field that crossed the limit. Like WithMaxFiles, it is checked before any
+// file is opened, or, with WithStreaming, before the extra file is read. It
+// counts only the files of the request, unlike WithContextFileLimitEnforcement,
+// which also counts files that earlier middleware put in the context.
+//
+//	GFileMux.WithMaxTotalFiles(20)
+func WithMaxTotalFiles(n int) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.maxTotalFiles = n
+	}
+}
+
+// WithMaxTotalUploadSize caps the combined size of the files in a request at
+// n bytes; 0 (the default) means no limit. Unlike WithMaxFileSize, which caps
+// the raw body, it counts file content only, not multipart overhead or form
+// values. Going over it fails the request with a *SizeError (413) whose Total
+// is set and whose Field names the field that crossed the limit. File sizes
+// are summed across fields before anything is stored. With WithStreaming,
+// sizes are only known as files are read, so the file that crosses the limit
+// fails while it is being stored, and files stored before it are kept.
+//
+//	GFileMux.WithMaxTotalUploadSize(50 << 20) // 50 MB of files per request
+func WithMaxTotalUploadSize(n int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.maxTotalSize = n
+	}
+}
+
+// WithMaxConcurrency sets how many files of a request are processed and
+// stored at once, across all fields. 0, the default, means unlimited. Files
+// keep their submission order within a field regardless.
+//
+// The limit also bounds per-file resources. Each file being stored holds an
+// open file descriptor when ParseMultipartForm spilled it to a temporary file,
+// and S3Store buffers up to PartSize × Concurrency bytes of it in memory, so a
+// request can use roughly n times that at peak. With WithStreaming, files are
+// stored one at a time and the limit does not apply.
+func WithMaxConcurrency(n int) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.maxConcurrency = n
+	}
+}
+
+// WithFileOpenRetry retries opening an uploaded file's multipart temp file up
+// to attempts times in total when it fails transiently, e.g. with "too many
+// open files" under heavy load, backing off exponentially from 10ms. Other
+// errors, such as a missing file, fail at once. Values below 2 disable retries.
+func WithFileOpenRetry(attempts int) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.fileOpenAttempts = attempts
+	}
+}
+
 // WithFileValidatorFunc sets the file validation function.
 //
 //	GFileMux.WithFileValidatorFunc(GFileMux.ValidateMimeType("image/jpeg"))
@@ -79,6 +261,53 @@ func WithFileValidatorFunc(validator FileValidatorFunc) GFileMuxOption {
 	}
 }
 
+// WithRequireExplicitValidation makes New return an error when no validator
+// is configured with WithFileValidatorFunc, WithContentValidatorFunc or
+// WithRemoteValidator, instead of silently accepting every file. Use it for
+// public endpoints; to accept every file anyway, say so explicitly with
+// WithFileValidatorFunc(GFileMux.DefaultFileValidator).
+func WithRequireExplicitValidation(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.requireExplicitValidation = enable
+	}
+}
+
+// WithContentValidatorFunc sets a validator that inspects file content. It runs
+// after the metadata validator set by WithFileValidatorFunc and before the file
+// is stored.
+//
+//	GFileMux.WithContentValidatorFunc(GFileMux.RejectShebangScripts())
+func WithContentValidatorFunc(validator FileContentValidatorFunc) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.contentValidator = validator
+	}
+}
+
+// WithRemoteValidator delegates approval of each file to a policy service. The
+// file's metadata (and, with RemoteValidatorContentSample, its leading bytes) is
+// POSTed as JSON to endpoint after the local validators pass. A 200 response
+// accepts the file; any other 2xx-4xx status rejects it with a *ValidationError
+// whose message is taken from the response body. Network errors, timeouts and
+// 5xx responses reject the file too, unless RemoteValidatorFailOpen is set.
+// A nil client means http.DefaultClient.
+//
+//	GFileMux.WithRemoteValidator("https://policy.internal/uploads", nil,
+//		GFileMux.RemoteValidatorTimeout(2*time.Second),
+//		GFileMux.RemoteValidatorFailOpen(true),
+//	)
+func WithRemoteValidator(endpoint string, client *http.Client, opts ...RemoteValidatorOption) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		if client == nil {
+			client = http.DefaultClient
+		}
+		rv := &remoteValidator{endpoint: endpoint, client: client, timeout: DefaultRemoteValidatorTimeout}
+		for _, opt := range opts {
+			opt(rv)
+		}
+		cfg.remoteValidator = rv
+	}
+}
+
 // WithFileNameGeneratorFunc sets the function used to generate storage filenames.
 //
 //	GFileMux.WithFileNameGeneratorFunc(func(orig string) string {
@@ -90,6 +319,84 @@ func WithFileNameGeneratorFunc(generator FileNameGeneratorFunc) GFileMuxOption {
 	}
 }
 
+// WithOnUploadStart registers a hook called as each file starts through the
+// upload pipeline, e.g. to count uploads or log them. header describes the
+// file as submitted; use it for its metadata only, not to read the content.
+// Files from a stream (WithStreaming) have Size -1, and files not submitted
+// as multipart parts (UploadFiles, ChunkedUpload) get a header built from
+// their name and size.
+//
+// The upload hooks are called from the goroutines that process files, so they
+// may run concurrently and must be safe for concurrent use. They should
+// return quickly, as the upload waits for them.
+//
+//	GFileMux.WithOnUploadStart(func(ctx context.Context, field string, header *multipart.FileHeader) {
+//	    uploadsStarted.WithLabelValues(field).Inc()
+//	})
+func WithOnUploadStart(hook func(ctx context.Context, field string, header *multipart.FileHeader)) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.onUploadStart = hook
+	}
+}
+
+// WithOnUploadSuccess registers a hook called with each file once it has been
+// validated and stored. File.DuplicateOf is not set yet, as duplicates are
+// detected once the whole batch is stored. See WithOnUploadStart.
+func WithOnUploadSuccess(hook func(ctx context.Context, file File)) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.onUploadSuccess = hook
+	}
+}
+
+// WithOnUploadError registers a hook called with the error of each file that
+// fails, including files cancelled because another file of the batch failed
+// first. Errors that fail a request before any file starts, such as a
+// malformed body, are reported only to the upload error handler. See
+// WithOnUploadStart.
+func WithOnUploadError(hook func(ctx context.Context, field string, err error)) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.onUploadError = hook
+	}
+}
+
+// WithUploadMetadata sets a function returning user metadata to store with
+// each file, e.g. who uploaded it, passed to the storage backend as
+// UploadFileOptions.Metadata. It runs after validation, so file has its MIME
+// type, extension and checksum; ctx is the request's context. The checksum
+// recorded by WithChecksumValidation is added under ChecksumMetadataKey and
+// wins over a returned key of that name. S3 and GCS store the metadata with
+// the object, memory storage with the file, and disk storage in a sidecar
+// file; all report it back through Open.
+//
+//	GFileMux.WithUploadMetadata(func(ctx context.Context, file GFileMux.File) map[string]string {
+//	    return map[string]string{"uploaded-by": userID(ctx), "original-name": file.OriginalName}
+//	})
+func WithUploadMetadata(metadata func(ctx context.Context, file File) map[string]string) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.uploadMetadata = metadata
+	}
+}
+
+// WithUploadSuccessHandlerFunc sets a handler that answers successful uploads
+// in place of the next handler, symmetric to WithUploadErrorHandlerFunc. The
+// request it receives carries the files in its context, as next's would.
+// WithResponseEnvelope and WithCreatedResponse take precedence; without a
+// success handler, next is called. Since next is skipped, checks it would
+// make never run; set per-route limits with UploadWith options such as
+// WithMaxFileCount, which apply before anything is stored.
+//
+//	GFileMux.WithUploadSuccessHandlerFunc(func(files GFileMux.Files) http.HandlerFunc {
+//	    return func(w http.ResponseWriter, r *http.Request) {
+//	        w.WriteHeader(http.StatusCreated)
+//	        json.NewEncoder(w).Encode(files.All())
+//	    }
+//	})
+func WithUploadSuccessHandlerFunc(handler UploadSuccessHandlerFunc) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.uploadSuccessHandler = handler
+	}
+}
+
 // WithIgnoreNonExistentKey controls whether missing form fields cause an error.
 // When true, fields not present in the multipart form are silently skipped.
 func WithIgnoreNonExistentKey(ignore bool) GFileMuxOption {
@@ -124,6 +431,8 @@ func WithAllowedBuckets(buckets ...string) GFileMuxOption {
 
 // WithLogger attaches a structured logger that GFileMux will use to emit
 // lifecycle events (upload started, completed, failed). Pass nil to disable logging.
+// GFileMux logs only through log/slog; to use another logging library, such
+// as zap or zerolog, wrap it in a slog.Handler and pass slog.New(handler).
 //
 //	GFileMux.WithLogger(slog.Default())
 func WithLogger(logger *slog.Logger) GFileMuxOption {
@@ -140,16 +449,504 @@ func WithChecksumValidation(enable bool) GFileMuxOption {
 	}
 }
 
-// WithBucket sets the bucket option for UploadOptions.
+// WithFilenamePolicy sets how unsafe original file names are handled:
+// FilenamePolicyReject fails the upload with a *ValidationError before any
+// other validator runs, and FilenamePolicySanitize rewrites the name with
+// SanitizeFilename before the name generator sees it. It composes with
+// WithFileValidatorFunc and WithFileNameGeneratorFunc in any order.
+//
+//	GFileMux.WithFilenamePolicy(GFileMux.FilenamePolicySanitize)
+func WithFilenamePolicy(policy FilenamePolicy) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.filenamePolicy = policy
+	}
+}
+
+// WithOverwritePolicy sets what happens when a file's storage key is already
+// taken: OverwriteAllow (the default) replaces the stored file, OverwriteError
+// fails the upload with ErrFileExists (409 Conflict by default), and
+// OverwriteRename appends "-1", "-2", ... to the name until it is free. Any
+// policy other than OverwriteAllow requires a storage backend that implements
+// Exister; New fails otherwise. The check is made just before the upload and
+// is not atomic with it, so concurrent uploads of the same name can still race.
+//
+//	GFileMux.WithOverwritePolicy(GFileMux.OverwriteRename)
+func WithOverwritePolicy(policy OverwritePolicy) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.overwritePolicy = policy
+	}
+}
+
+// WithKeyPrefixFunc computes, for each request, a prefix prepended to the
+// storage key of every file the request uploads, e.g. "users/<id>/" from the
+// authenticated user, to keep each user's files apart. File.UploadedFileName
+// stays unprefixed; File.StorageKey carries the full key. An error from fn, or
+// a prefix that is absolute or contains a ".." segment, fails the request
+// through the upload error handler before the body is read.
+//
+//	GFileMux.WithKeyPrefixFunc(func(r *http.Request) (string, error) {
+//	    user, ok := auth.UserFrom(r.Context())
+//	    if !ok {
+//	        return "", errors.New("unauthenticated")
+//	    }
+//	    return "users/" + user.ID + "/", nil
+//	})
+func WithKeyPrefixFunc(fn func(*http.Request) (string, error)) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.keyPrefixFunc = fn
+	}
+}
+
+// WithChecksumFieldSuffix verifies each file against a SHA-256 hex digest the
+// client sends in a companion form value, named by appending suffix to the
+// file's field name: with suffix "_sha256", files in field "file" are checked
+// against the "file_sha256" values, the i-th value for the i-th file. A file
+// whose checksum is missing, malformed or different fails the upload with a
+// *ValidationError.
+//
+// Buffered uploads are hashed before they are stored. Under WithStreaming the
+// hash is computed while the file streams to storage, and a mismatching file is
+// deleted again; the checksum value must precede its file in the body.
+//
+//	GFileMux.WithChecksumFieldSuffix("_sha256")
+func WithChecksumFieldSuffix(suffix string) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.checksumFieldSuffix = suffix
+	}
+}
+
+// WithChecksumAlgorithm records a digest of every uploaded file in
+// File.Checksum, hex-encoded. The hash is computed from the bytes as the
+// storage backend reads them, so it works with WithStreaming and needs no
+// second read of the file, unlike WithChecksumValidation, which hashes each
+// file before it is stored. The default, ChecksumAlgorithmNone, computes
+// nothing; New fails for an unsupported algorithm.
+//
+//	GFileMux.WithChecksumAlgorithm(GFileMux.ChecksumAlgorithmSHA256)
+func WithChecksumAlgorithm(algorithm ChecksumAlgorithm) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.checksumAlgorithm = algorithm
+	}
+}
+
+// WithMimeOverrides replaces the sniffed MIME type for files with the given
+// extensions. Keys are file extensions, with or without the leading dot, and
+// are matched case-insensitively. The override is applied after detection, so
+// validators and storage backends see the corrected type. This is useful for
+// formats http.DetectContentType cannot identify (e.g. CSV).
+//
+//	GFileMux.WithMimeOverrides(map[string]string{".csv": "text/csv"})
+func WithMimeOverrides(overrides map[string]string) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		if cfg.mimeOverrides == nil {
+			cfg.mimeOverrides = make(map[string]string, len(overrides))
+		}
+		for ext, mimeType := range overrides {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			cfg.mimeOverrides[ext] = mimeType
+		}
+	}
+}
+
+// WithMaxUploadDuration puts a hard ceiling on the wall-clock time of an entire
+// Upload batch, covering multipart parsing and every storage write. When the
+// limit is exceeded all in-flight work is cancelled and a *TimeoutError is passed
+// to the upload error handler. Storage backends get the deadline through the
+// context passed to Upload, and the bundled ones stop writing once it passes.
+// A value <= 0 disables the limit.
+//
+//	GFileMux.WithMaxUploadDuration(30 * time.Second)
+func WithMaxUploadDuration(d time.Duration) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.maxUploadDuration = d
+	}
+}
+
+// WithUploadTimeout is an alias for WithMaxUploadDuration: the upload context
+// gets a deadline of d before any file is stored, and an upload that exceeds it
+// fails with a *TimeoutError, which wraps context.DeadlineExceeded and maps to
+// 408 Request Timeout in ErrorStatusCode.
+func WithUploadTimeout(d time.Duration) GFileMuxOption {
+	return WithMaxUploadDuration(d)
+}
+
+// WithNormalizeUnicodeNames applies Unicode NFC normalization to each file's
+// original name before it reaches the filename generator, validators and the
+// File struct. Clients such as macOS often send decomposed (NFD) names, which
+// differ byte-wise from the NFC form used elsewhere and break later lookups.
+// When enabled, names that are not valid UTF-8 are rejected with a *ValidationError.
+func WithNormalizeUnicodeNames(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.normalizeUnicodeNames = enable
+	}
+}
+
+// WithPerFileTimeout bounds the time spent processing each individual file,
+// the storage write included. Every file runs under its own context derived
+// from the batch context, so a single stuck storage call is cancelled on its
+// own deadline; the resulting *TimeoutError fails the batch and cancels the
+// remaining files. A value <= 0 disables the limit.
+//
+//	GFileMux.WithPerFileTimeout(10 * time.Second)
+func WithPerFileTimeout(d time.Duration) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.perFileTimeout = d
+	}
+}
+
+// WithResponseEnvelope makes the Upload middleware answer successful uploads
+// itself: the files uploaded by the request are passed to envelope and the
+// returned value is written as a JSON response with status 200. The next
+// handler is not called. Use it to match an API's response shape without
+// writing a handler.
+//
+//	GFileMux.WithResponseEnvelope(func(files GFileMux.Files) any {
+//	    return map[string]any{
+//	        "data": files.All(),
+//	        "meta": map[string]any{"count": files.Count()},
+//	    }
+//	})
+func WithResponseEnvelope(envelope func(Files) any) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.responseEnvelope = envelope
+	}
+}
+
+// WithCreatedResponse makes the Upload middleware answer a request that
+// uploaded exactly one file with 201 Created and a Location header set to the
+// file's storage Path. The body is the WithResponseEnvelope value when one is
+// configured, and the File as JSON otherwise; the next handler is not called.
+// Uploads of several files, or whose Path cannot be resolved, get the normal
+// success response.
+func WithCreatedResponse(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.createdResponse = enable
+	}
+}
+
+// WithPausedRetryAfter sets how long clients are told to wait, in the
+// Retry-After header, while uploads are paused with SetAcceptingUploads.
+// Defaults to DefaultPausedRetryAfter; 0 omits the header.
+func WithPausedRetryAfter(d time.Duration) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.pausedRetryAfter = d
+	}
+}
+
+// WithAutoResponse makes the Upload middleware answer successful uploads with
+// the uploaded Files as JSON (see WriteUploadedFilesJSON) whenever the next
+// handler writes nothing. The next handler is still called, so it can record
+// the files and then either leave the response to GFileMux or write its own.
+// WithResponseEnvelope and WithCreatedResponse take precedence.
+func WithAutoResponse(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.autoResponse = enable
+	}
+}
+
+// WithUploadedFileNameFromChecksum stores each file under a content-addressed
+// but human-readable name of the form "<original-base>.<short-hash><ext>", e.g.
+// "logo.3f2a1b9c0d4e.png", where the hash is the first 12 hex digits of the
+// file's SHA-256. Updated content therefore gets a new name (and URL), which
+// makes long CDN cache lifetimes safe. The name replaces the output of the
+// filename generator once validation has passed.
+func WithUploadedFileNameFromChecksum(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.nameFromChecksum = enable
+	}
+}
+
+// WithFallbackMimeFromExtension makes the handler fall back to the MIME type
+// registered for the file's extension (mime.TypeByExtension) when content
+// sniffing returns application/octet-stream. This avoids false rejections by
+// ValidateMimeType for formats the 512-byte sniff cannot classify. Overrides set
+// with WithMimeOverrides still take precedence.
+func WithFallbackMimeFromExtension(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.fallbackMimeFromExtension = enable
+	}
+}
+
+// WithCaseInsensitiveFields makes Upload match multipart field names ignoring
+// case, so Upload("bucket", "file1") also accepts a "File1" field. Files are
+// reported under the key passed to Upload. An exact match always wins; if no
+// field matches exactly and several differ from the key only by case (e.g.
+// "File1" and "FILE1"), the request is rejected as ambiguous with a
+// *ValidationError rather than picking one arbitrarily.
+func WithCaseInsensitiveFields(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.caseInsensitiveFields = enable
+	}
+}
+
+// WithPostStoreValidation stores files before running the content validators
+// (WithContentValidatorFunc and WithRemoteValidator), so the request completes
+// without waiting for them. Validation then runs in the background against the
+// stored copy, read back through the backend's Opener; a file a validator
+// rejects is deleted from storage and the failure is logged. A file that
+// cannot be read back is kept and the error logged. This trades a wasted write
+// for lower latency on the happy path. Metadata validators set with
+// WithFileValidatorFunc still run before storage. New returns an error when the
+// storage backend does not implement Opener. Call WaitForValidations to drain
+// pending validations, e.g. on shutdown.
+func WithPostStoreValidation(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.postStoreValidation = enable
+	}
+}
+
+// WithRequireFilename rejects files that arrive without a filename with a
+// *ValidationError instead of passing an empty name to the filename generator.
+// This covers multipart file parts whose Content-Disposition has no filename
+// (which net/http otherwise parses as plain form values) and, for UploadFiles,
+// NamedReaders with an empty FileName.
+func WithRequireFilename(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.requireFilename = enable
+	}
+}
+
+// WithDuplicateDetection hashes every file in a batch and sets File.DuplicateOf
+// on files whose content is byte-identical to an earlier file in the same
+// request, e.g. to warn a user who attached the same document twice. The
+// request still succeeds. Enabling it also populates File.ChecksumSHA256.
+func WithDuplicateDetection(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.detectDuplicates = enable
+	}
+}
+
+// WithContextFileLimitEnforcement caps the files retained in a request's
+// context across every Upload middleware in the chain: at most maxFiles files
+// and maxTotalSize bytes in total. A request that would exceed either cap fails
+// with a *ContextLimitError (413) before anything is stored. 0 disables a cap.
+//
+//	GFileMux.WithContextFileLimitEnforcement(50, 500<<20) // 50 files, 500 MB
+func WithContextFileLimitEnforcement(maxFiles int, maxTotalSize int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.contextMaxFiles = maxFiles
+		cfg.contextMaxSize = maxTotalSize
+	}
+}
+
+// WithUploadTimings records how long each phase of an Upload request took:
+// multipart parsing, and per file MIME detection, validation and the storage
+// write. The timings are logged at debug level through WithLogger and stored in
+// the request context for the next handler, retrieved with
+// GetUploadTimingsFromContext.
+func WithUploadTimings(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.uploadTimings = enable
+	}
+}
+
+// WithAuditSink writes an append-only audit trail to w: one JSON line per
+// successfully stored file with the timestamp, bucket, field, original name,
+// storage key, size, checksum, MIME type and client IP (from the request's
+// RemoteAddr; empty for UploadFiles). Files that fail are not recorded. Writes
+// are serialized, so w need not be goroutine-safe. Write errors are logged and
+// do not fail the upload.
+//
+//	f, _ := os.OpenFile("uploads.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+//	GFileMux.WithAuditSink(f)
+func WithAuditSink(w io.Writer) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		if w == nil {
+			cfg.audit = nil
+			return
+		}
+		cfg.audit = &auditSink{w: w}
+	}
+}
+
+// WithStreaming makes Upload read multipart parts as they arrive with
+// r.MultipartReader instead of buffering the whole form with
+// ParseMultipartForm first, so a large file is not held in memory or spooled
+// to disk before it reaches storage. Parts are processed one at a time in
+// submission order.
+//
+// Each part is handed to the backend as a forward-only reader, and its
+// File.Size is -1 until it has been stored. A part is instead buffered to a
+// temporary file (or memory, see WithSpoolMemoryThreshold) when something must
+// read it before storage: a backend whose Capabilities report
+// RequiresSeekableReader, a content or remote validator (unless
+// WithPostStoreValidation is on), checksums, or WithContentTypeDetector. New
+// logs the reason when that applies. Because files are stored as they arrive, a
+// later failure such as a missing field can leave earlier files of the request
+// in storage. The body can only be read once, so a later Upload in the same
+// chain finds no files.
+func WithStreaming(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.streaming = enable
+	}
+}
+
+// WithSpoolMemoryThreshold keeps files of at most n bytes in memory when they
+// must be made seekable, instead of copying them to a temporary file: streamed
+// parts buffered under WithStreaming, non-seekable readers passed to
+// UploadFiles, and stored files read back by WithPostStoreValidation. Larger
+// files still spill to disk. This saves a file create and remove per upload
+// when most files are small. Each file in flight may hold up to n bytes, so
+// keep n modest under high concurrency. 0, the default, always uses a
+// temporary file.
+//
+//	GFileMux.WithSpoolMemoryThreshold(256 << 10) // 256 KiB
+func WithSpoolMemoryThreshold(n int64) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.spoolMemoryThreshold = n
+	}
+}
+
+// WithChunkSessionStore sets where ChunkedUpload keeps its sessions. It
+// defaults to a MemoryChunkSessionStore; pass a shared store, e.g. backed by
+// Redis, when the requests of one upload may reach different instances.
+func WithChunkSessionStore(store ChunkSessionStore) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.chunkSessions = store
+	}
+}
+
+// WithChunkDir sets the directory where ChunkedUpload keeps the bytes received
+// for each session until the file is complete. It defaults to os.TempDir().
+func WithChunkDir(dir string) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.chunkDir = dir
+	}
+}
+
+// WithContentTypeDetector replaces the built-in MIME detection,
+// utils.FetchContentType, which sniffs only the first 512 bytes with any
+// registered utils.Sniffer and http.DetectContentType. Use it to plug in a
+// library that reads further and recognizes more formats, e.g. telling DOCX
+// from other ZIP containers. Parameters such as charset are dropped from the
+// result, and WithMimeOverrides and WithFallbackMimeFromExtension still apply.
+// Under WithStreaming, parts are buffered so the detector can seek.
+//
+//	GFileMux.WithContentTypeDetector(func(rs io.ReadSeeker) (string, error) {
+//	    m, err := mimetype.DetectReader(rs)
+//	    if err != nil {
+//	        return "", err
+//	    }
+//	    return m.String(), nil
+//	})
+func WithContentTypeDetector(detector ContentTypeDetectorFunc) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.contentTypeDetector = detector
+	}
+}
+
+// WithQuotaChecker consults fn before files are stored, so a request that
+// would exceed a user's file-count or byte quota fails without writing
+// anything. For a buffered upload fn is called once, after parsing, with the
+// number and total size of the files about to be stored. Under WithStreaming
+// a part's size is unknown until it is stored, so fn is called before each
+// part with the files so far including it, and the bytes of the parts already
+// stored; earlier parts stay stored when a later one is rejected. ChunkedUpload
+// calls fn when a session starts, with the declared total size and one file.
+// An error wrapping ErrQuotaExceeded is reported as 413 by the default error
+// handler; a custom handler can answer 402 instead.
+//
+//	GFileMux.WithQuotaChecker(func(ctx context.Context, r *http.Request, incomingBytes int64, fileCount int) error {
+//	    used, limit := quotas.Usage(ctx, userID(r))
+//	    if used+incomingBytes > limit {
+//	        return fmt.Errorf("%w: %d of %d bytes used", GFileMux.ErrQuotaExceeded, used, limit)
+//	    }
+//	    return nil
+//	})
+func WithQuotaChecker(fn QuotaCheckerFunc) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.quotaChecker = fn
+	}
+}
+
+// WithFileHeaderSizeLimit rejects multipart parts whose headers take more than
+// n bytes (0, the default, means no limit beyond mime/multipart's own). The
+// size counts each header line as sent, "Key: value\r\n". A part over the limit
+// fails the request with a HeaderSizeError before its body is read.
+//
+// It only applies with WithStreaming: ParseMultipartForm, used otherwise,
+// reads every part before the handler sees any of them.
+//
+//	GFileMux.WithFileHeaderSizeLimit(8 << 10) // 8 KB of headers per part
+func WithFileHeaderSizeLimit(n int) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.maxPartHeaderBytes = n
+	}
+}
+
+// WithPublicIDGenerator issues every stored file a public ID from fn, exposed
+// as File.PublicID, so APIs need not reveal storage keys. Each ID is recorded
+// in the store set with WithPublicIDStore, or an in-memory store when none is
+// set, and ResolvePublicID maps it back to the file's bucket and key.
+//
+//	GFileMux.WithPublicIDGenerator(GFileMux.DefaultPublicIDGenerator)
+func WithPublicIDGenerator(fn PublicIDGeneratorFunc) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.publicIDGenerator = fn
+	}
+}
+
+// WithPublicIDStore sets where WithPublicIDGenerator records public IDs. Use a
+// persistent store, e.g. backed by your database, when IDs must outlive the
+// process or be resolved by other instances.
+func WithPublicIDStore(store PublicIDStore) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.publicIDStore = store
+	}
+}
+
+// WithDebugUploads logs, at Info level, the multipart layout of every request
+// to help diagnose client encoding problems: the boundary, the number of
+// parts, and each part's field name, declared content type and size. File
+// contents and names are never logged. With WithStreaming a part that was
+// not read to the end is logged with size -1.
+//
+//	GFileMux.WithDebugUploads(true)
+func WithDebugUploads(enable bool) GFileMuxOption {
+	return func(cfg *GFileMux) {
+		cfg.debugUploads = enable
+	}
+}
+
+// WithBucket sets the bucket UploadWith stores files in.
 func WithBucket(bucket string) Option {
 	return func(o *UploadOptions) {
 		o.Bucket = bucket
 	}
 }
 
-// WithKeys sets the keys option for UploadOptions.
+// WithKeys sets the form fields UploadWith reads files from.
 func WithKeys(keys ...string) Option {
 	return func(o *UploadOptions) {
 		o.Keys = keys
 	}
 }
+
+// WithMaxSize overrides the handler's WithMaxFileSize limit on the request
+// body for one route; n <= 0 keeps the handler's limit. WithDynamicMaxSize
+// still takes precedence when its function returns a positive size, and
+// WithFieldMaxFileSize caps still apply.
+//
+//	handler.UploadWith(GFileMux.WithBucket("avatars"), GFileMux.WithKeys("file"), GFileMux.WithMaxSize(2<<20))
+func WithMaxSize(n int64) Option {
+	return func(o *UploadOptions) {
+		o.MaxSize = n
+	}
+}
+
+// WithMaxFileCount overrides the handler's WithMaxFiles limit on the files
+// per form field for one route; n <= 0 keeps the handler's limit. Like the
+// handler's limit, it is checked before anything is stored.
+//
+//	handler.UploadWith(GFileMux.WithBucket("avatars"), GFileMux.WithKeys("file"), GFileMux.WithMaxFileCount(1))
+func WithMaxFileCount(n int) Option {
+	return func(o *UploadOptions) {
+		o.MaxFiles = n
+	}
+}
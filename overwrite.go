@@ -0,0 +1,56 @@
+package GFileMux
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// OverwritePolicy selects what WithOverwritePolicy does when a file's storage
+// key is already taken.
+type OverwritePolicy int
+
+const (
+	// OverwriteAllow stores the file regardless, replacing any existing file
+	// with the same key. It is the default.
+	OverwriteAllow OverwritePolicy = iota
+	// OverwriteError fails the upload with an error wrapping ErrFileExists.
+	OverwriteError
+	// OverwriteRename stores the file under a free key, made by appending
+	// "-1", "-2", ... to the name before its extension.
+	OverwriteRename
+)
+
+// maxRenameAttempts bounds the suffixes OverwriteRename tries before giving up.
+const maxRenameAttempts = 1000
+
+// resolveOverwrite applies the overwrite policy to name, stored under prefix in
+// bucket, returning the name to upload as. The check and the upload are not
+// atomic, so two concurrent uploads can still pick the same name.
+func (gfm *GFileMux) resolveOverwrite(ctx context.Context, field, bucket, prefix, name string) (string, error) {
+	if gfm.overwritePolicy == OverwriteAllow {
+		return name, nil
+	}
+	exister := gfm.storage.(Exister)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		exists, err := exister.Exists(ctx, bucket, prefix+candidate)
+		if err != nil {
+			return "", fmt.Errorf("could not check whether %q exists for field %q: %w", prefix+candidate, field, err)
+		}
+		if !exists {
+			return candidate, nil
+		}
+		if gfm.overwritePolicy == OverwriteError {
+			return "", fmt.Errorf("field %q: %w: %q", field, ErrFileExists, prefix+candidate)
+		}
+		if i > maxRenameAttempts {
+			return "", fmt.Errorf("field %q: %w: no free name for %q after %d attempts", field, ErrFileExists, prefix+name, maxRenameAttempts)
+		}
+		candidate = base + "-" + strconv.Itoa(i) + ext
+	}
+}
@@ -0,0 +1,76 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// existingStorage is a recordingStorage that reports which keys it holds.
+type existingStorage struct {
+	recordingStorage
+}
+
+func (s *existingStorage) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[key]
+	return ok, nil
+}
+
+func TestGFileMux_OverwritePolicy(t *testing.T) {
+	cases := []struct {
+		policy   OverwritePolicy
+		wantCode int
+		wantKey  string
+	}{
+		{OverwriteAllow, http.StatusOK, "report.txt"},
+		{OverwriteError, http.StatusConflict, ""},
+		{OverwriteRename, http.StatusOK, "report-2.txt"},
+	}
+	for _, tc := range cases {
+		store := &existingStorage{}
+		store.files = map[string][]byte{"report.txt": []byte("old"), "report-1.txt": []byte("old")}
+		var uploadErr error
+		handler := newTestHandler(t,
+			WithStorage(store),
+			WithOverwritePolicy(tc.policy),
+			WithFileNameGeneratorFunc(func(s string) string { return s }),
+			WithUploadErrorHandlerFunc(captureErrorHandler(&uploadErr)),
+		)
+
+		req := buildMultipartRequest(t, "file", "report.txt", []byte("new"))
+		rr := httptest.NewRecorder()
+		var files Files
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files, _ = GetUploadedFilesFromContext(r)
+		})).ServeHTTP(rr, req)
+
+		if tc.wantKey == "" {
+			if !errors.Is(uploadErr, ErrFileExists) || ErrorStatusCode(uploadErr) != tc.wantCode {
+				t.Errorf("policy %d: expected ErrFileExists (%d), got %v", tc.policy, tc.wantCode, uploadErr)
+			}
+			if string(store.files["report.txt"]) != "old" {
+				t.Errorf("policy %d: existing file was overwritten", tc.policy)
+			}
+			continue
+		}
+		if rr.Code != tc.wantCode {
+			t.Fatalf("policy %d: expected %d, got %d (%v)", tc.policy, tc.wantCode, rr.Code, uploadErr)
+		}
+		if f := files["file"][0]; f.StorageKey != tc.wantKey || f.UploadedFileName != tc.wantKey {
+			t.Errorf("policy %d: stored as %q (%q), want %q", tc.policy, f.StorageKey, f.UploadedFileName, tc.wantKey)
+		}
+		if string(store.files[tc.wantKey]) != "new" {
+			t.Errorf("policy %d: expected the new content under %q", tc.policy, tc.wantKey)
+		}
+	}
+}
+
+func TestNew_OverwritePolicyRequiresExister(t *testing.T) {
+	if _, err := New(WithStorage(&MockStorage{}), WithOverwritePolicy(OverwriteError)); err == nil {
+		t.Fatal("expected New to reject a backend without Exists")
+	}
+}
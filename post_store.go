@@ -0,0 +1,67 @@
+package GFileMux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// schedulePostStoreValidation validates a stored file in the background and
+// deletes it when a validator rejects it. A file that cannot be read back is
+// kept, and the error logged, since it may well be valid. It detaches from
+// ctx's cancellation so the work outlives the request, keeping ctx's values
+// for logging.
+func (gfm *GFileMux) schedulePostStoreValidation(ctx context.Context, bucket string, file File) {
+	ctx = context.WithoutCancel(ctx)
+	gfm.pendingValidations.Add(1)
+	go func() {
+		defer gfm.pendingValidations.Done()
+		rejected, err := gfm.validateStored(ctx, bucket, file)
+		if err == nil {
+			return
+		}
+		if !rejected {
+			gfm.log(ctx, slog.LevelError, "post-store validation could not run, keeping file",
+				"bucket", bucket, "key", file.StorageKey, "error", err)
+			return
+		}
+		gfm.log(ctx, slog.LevelWarn, "post-store validation failed, deleting file",
+			"bucket", bucket, "key", file.StorageKey, "error", err)
+		if err := gfm.storage.Delete(ctx, bucket, file.StorageKey); err != nil {
+			gfm.log(ctx, slog.LevelError, "could not delete file that failed validation",
+				"bucket", bucket, "key", file.StorageKey, "error", err)
+		}
+	}()
+}
+
+// validateStored reads the stored copy of file back and runs the content
+// validators on it. rejected reports whether the error came from the
+// validators, rather than from reading the file.
+func (gfm *GFileMux) validateStored(ctx context.Context, bucket string, file File) (rejected bool, err error) {
+	rc, _, err := gfm.storage.(Opener).Open(ctx, bucket, file.StorageKey)
+	if err != nil {
+		return false, fmt.Errorf("could not read stored file: %w", err)
+	}
+	defer rc.Close()
+
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		spooled, err := gfm.spool(rc)
+		if err != nil {
+			return false, fmt.Errorf("could not buffer stored file: %w", err)
+		}
+		defer spooled.Close()
+		rs = spooled
+	}
+	if err := gfm.validateFileContent(ctx, file, rs); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// WaitForValidations blocks until every background validation started by
+// WithPostStoreValidation has finished.
+func (gfm *GFileMux) WaitForValidations() {
+	gfm.pendingValidations.Wait()
+}
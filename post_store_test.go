@@ -0,0 +1,131 @@
+package GFileMux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// openableStorage is an in-memory Storage that also implements Opener.
+type openableStorage struct {
+	MockStorage
+	mu      sync.Mutex
+	files   map[string][]byte
+	deleted []string
+}
+
+func (s *openableStorage) Upload(ctx context.Context, r io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[options.FileName] = data
+	return &UploadedFileMetadata{Key: options.FileName, Size: int64(len(data))}, nil
+}
+
+func (s *openableStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *UploadedFileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), &UploadedFileMetadata{Key: key, Size: int64(len(data))}, nil
+}
+
+func (s *openableStorage) Delete(ctx context.Context, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, key)
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestGFileMux_PostStoreValidation(t *testing.T) {
+	store := &openableStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(name string) string { return name }),
+		WithContentValidatorFunc(RejectShebangScripts()),
+		WithPostStoreValidation(true),
+	)
+
+	req := buildMultipartRequestParts(t,
+		formPart{"f", "ok.txt", []byte("plain text")},
+		formPart{"f", "run.sh", []byte("#!/bin/sh\nrm -rf /")},
+	)
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "f")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the request to succeed before validation, got %d", rr.Code)
+	}
+
+	handler.WaitForValidations()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if strings.Join(store.deleted, ",") != "run.sh" {
+		t.Errorf("expected only run.sh to be deleted, got %v", store.deleted)
+	}
+	if _, ok := store.files["ok.txt"]; !ok {
+		t.Error("expected ok.txt to be kept")
+	}
+}
+
+func TestGFileMux_PostStoreValidation_RequiresOpener(t *testing.T) {
+	_, err := New(WithStorage(&MockStorage{}), WithPostStoreValidation(true))
+	if err == nil {
+		t.Fatal("expected New to reject a backend without Open")
+	}
+}
+
+// failingOpenStorage stores files but cannot read them back.
+type failingOpenStorage struct {
+	openableStorage
+}
+
+func (s *failingOpenStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *UploadedFileMetadata, error) {
+	return nil, nil, errors.New("connection reset")
+}
+
+func TestGFileMux_PostStoreValidation_OpenFailureKeepsFile(t *testing.T) {
+	var logs bytes.Buffer
+	store := &failingOpenStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithFileNameGeneratorFunc(func(name string) string { return name }),
+		WithContentValidatorFunc(RejectShebangScripts()),
+		WithPostStoreValidation(true),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "f")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rr, buildMultipartRequest(t, "f", "ok.txt", []byte("plain text")))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	handler.WaitForValidations()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.deleted) != 0 {
+		t.Errorf("expected the file to be kept when it cannot be read back, deleted %v", store.deleted)
+	}
+	if !strings.Contains(logs.String(), "connection reset") {
+		t.Errorf("expected the read error to be logged, got %q", logs.String())
+	}
+}
@@ -0,0 +1,120 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// PublicIDGeneratorFunc returns the public ID for a stored file. The file has
+// its StorageKey and FolderDestination set. IDs must be unique; an empty ID
+// fails the upload.
+type PublicIDGeneratorFunc func(file File) string
+
+// DefaultPublicIDGenerator returns 32 random hex characters (128 bits), which
+// reveal nothing about the file or where it is stored.
+var DefaultPublicIDGenerator PublicIDGeneratorFunc = func(File) string {
+	id, _ := randomID()
+	return id
+}
+
+// PublicIDStore maps public IDs to the bucket and key of the files they were
+// issued for. Implementations must be safe for concurrent use.
+type PublicIDStore interface {
+	// SavePublicID records that id refers to key in bucket.
+	SavePublicID(ctx context.Context, id, bucket, key string) error
+
+	// ResolvePublicID returns the bucket and key recorded for id. An unknown
+	// id is reported with an error wrapping fs.ErrNotExist.
+	ResolvePublicID(ctx context.Context, id string) (bucket, key string, err error)
+}
+
+// MemoryPublicIDStore is a PublicIDStore held in memory. Its mappings are lost
+// when the process exits, so it suits tests and single-instance deployments
+// whose files are short-lived.
+type MemoryPublicIDStore struct {
+	mu  sync.RWMutex
+	ids map[string]PathOptions
+}
+
+// NewMemoryPublicIDStore returns an empty MemoryPublicIDStore.
+func NewMemoryPublicIDStore() *MemoryPublicIDStore {
+	return &MemoryPublicIDStore{ids: make(map[string]PathOptions)}
+}
+
+// SavePublicID records that id refers to key in bucket. An id that is already
+// in use is rejected.
+func (s *MemoryPublicIDStore) SavePublicID(ctx context.Context, id, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return fmt.Errorf("public ID %q is already in use", id)
+	}
+	s.ids[id] = PathOptions{Bucket: bucket, Key: key}
+	return nil
+}
+
+// ResolvePublicID returns the bucket and key recorded for id.
+func (s *MemoryPublicIDStore) ResolvePublicID(ctx context.Context, id string) (string, string, error) {
+	s.mu.RLock()
+	loc, ok := s.ids[id]
+	s.mu.RUnlock()
+	if !ok {
+		return "", "", fmt.Errorf("unknown public ID %q: %w", id, fs.ErrNotExist)
+	}
+	return loc.Bucket, loc.Key, nil
+}
+
+// assignPublicID sets file.PublicID and records it in the public ID store.
+func (gfm *GFileMux) assignPublicID(ctx context.Context, bucket string, file *File) error {
+	id := gfm.publicIDGenerator(*file)
+	if id == "" {
+		return errors.New("public ID generator returned an empty ID")
+	}
+	if err := gfm.publicIDStore.SavePublicID(ctx, id, bucket, file.StorageKey); err != nil {
+		return fmt.Errorf("could not save public ID: %w", err)
+	}
+	file.PublicID = id
+	return nil
+}
+
+// ResolvePublicID returns the bucket and storage key of the file issued the
+// public ID id, ready to pass to the storage backend's Path or Open. An
+// unknown id is reported with an error wrapping fs.ErrNotExist, as is any id
+// when WithPublicIDGenerator is not configured.
+func (gfm *GFileMux) ResolvePublicID(ctx context.Context, id string) (PathOptions, error) {
+	if gfm.publicIDStore == nil || id == "" {
+		return PathOptions{}, fmt.Errorf("unknown public ID %q: %w", id, fs.ErrNotExist)
+	}
+	bucket, key, err := gfm.publicIDStore.ResolvePublicID(ctx, id)
+	if err != nil {
+		return PathOptions{}, err
+	}
+	return PathOptions{Bucket: bucket, Key: key}, nil
+}
+
+// PublicIDKeyFunc adapts ResolvePublicID for DownloadHandler: idFromRequest
+// extracts the public ID from the request, and IDs that do not resolve
+// respond 404.
+//
+// Example:
+//
+//	http.Handle("GET /files/{id}", GFileMux.DownloadHandler(store, handler.PublicIDKeyFunc(func(r *http.Request) string {
+//	    return r.PathValue("id")
+//	})))
+func (gfm *GFileMux) PublicIDKeyFunc(idFromRequest func(*http.Request) string) func(*http.Request) PathOptions {
+	return func(r *http.Request) PathOptions {
+		opts, err := gfm.ResolvePublicID(r.Context(), idFromRequest(r))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				gfm.log(r.Context(), slog.LevelError, "could not resolve public ID", "error", err)
+			}
+			return PathOptions{}
+		}
+		return opts
+	}
+}
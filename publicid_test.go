@@ -0,0 +1,83 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGFileMux_PublicID(t *testing.T) {
+	store := &openableStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithPublicIDGenerator(DefaultPublicIDGenerator),
+		WithFileNameGeneratorFunc(func(s string) string { return "tenants/7/" + s }),
+	)
+
+	req := buildMultipartRequest(t, "file", "report.txt", []byte("quarterly numbers"))
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("docs", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	file := files["file"][0]
+	if len(file.PublicID) != 32 || file.PublicID == file.StorageKey {
+		t.Fatalf("expected a 32-character opaque public ID, got %q", file.PublicID)
+	}
+	opts, err := handler.ResolvePublicID(context.Background(), file.PublicID)
+	if err != nil || opts.Bucket != "docs" || opts.Key != "tenants/7/report.txt" {
+		t.Fatalf("ResolvePublicID = %+v, %v", opts, err)
+	}
+	if _, err := handler.ResolvePublicID(context.Background(), "nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for an unknown ID, got %v", err)
+	}
+
+	download := DownloadHandler(store, handler.PublicIDKeyFunc(func(r *http.Request) string {
+		return r.URL.Query().Get("id")
+	}))
+	for id, want := range map[string]int{file.PublicID: http.StatusOK, "nope": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		download.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?id="+id, nil))
+		if rr.Code != want {
+			t.Errorf("download of %q: expected %d, got %d", id, want, rr.Code)
+		}
+		if want == http.StatusOK && rr.Body.String() != "quarterly numbers" {
+			t.Errorf("unexpected body %q", rr.Body)
+		}
+	}
+}
+
+// failingPublicIDStore rejects every public ID.
+type failingPublicIDStore struct{ *MemoryPublicIDStore }
+
+func (failingPublicIDStore) SavePublicID(ctx context.Context, id, bucket, key string) error {
+	return errors.New("database unavailable")
+}
+
+func TestGFileMux_PublicID_StoreFailure(t *testing.T) {
+	store := &openableStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithPublicIDGenerator(DefaultPublicIDGenerator),
+		WithPublicIDStore(failingPublicIDStore{NewMemoryPublicIDStore()}),
+	)
+
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("x"))
+	rr := httptest.NewRecorder()
+	handler.Upload("docs", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not run")
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	if len(store.deleted) != 1 {
+		t.Errorf("expected the stored file to be deleted, got %v", store.deleted)
+	}
+}
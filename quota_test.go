@@ -0,0 +1,92 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// quotaRecorder is a QuotaCheckerFunc allowing at most limit bytes, recording
+// each call.
+type quotaRecorder struct {
+	limit int64
+	err   error
+	calls [][2]int64
+}
+
+func (q *quotaRecorder) check(ctx context.Context, r *http.Request, incomingBytes int64, fileCount int) error {
+	q.calls = append(q.calls, [2]int64{incomingBytes, int64(fileCount)})
+	if q.err != nil {
+		return q.err
+	}
+	if incomingBytes > q.limit {
+		return fmt.Errorf("%w: %d bytes over a limit of %d", ErrQuotaExceeded, incomingBytes, q.limit)
+	}
+	return nil
+}
+
+func TestGFileMux_QuotaChecker(t *testing.T) {
+	cases := []struct {
+		name      string
+		limit     int64
+		err       error
+		wantCode  int
+		wantCalls [][2]int64
+	}{
+		{"within quota", 100, nil, http.StatusOK, [][2]int64{{8, 2}}},
+		{"over quota", 7, nil, http.StatusRequestEntityTooLarge, [][2]int64{{8, 2}}},
+		{"quota system down", 100, errors.New("connection refused"), http.StatusInternalServerError, [][2]int64{{8, 2}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quota := &quotaRecorder{limit: tc.limit, err: tc.err}
+			store := &MockStorage{}
+			handler := newTestHandler(t, WithStorage(store), WithQuotaChecker(quota.check))
+
+			req := buildMultipartRequestParts(t,
+				formPart{"file", "a.txt", []byte("abc")},
+				formPart{"file", "b.txt", []byte("defgh")},
+			)
+			rr := httptest.NewRecorder()
+			handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if fmt.Sprint(quota.calls) != fmt.Sprint(tc.wantCalls) {
+				t.Errorf("checker calls = %v, want %v", quota.calls, tc.wantCalls)
+			}
+			if tc.wantCode != http.StatusOK && len(store.uploadedFiles) != 0 {
+				t.Errorf("expected nothing stored, got %d files", len(store.uploadedFiles))
+			}
+		})
+	}
+}
+
+func TestGFileMux_QuotaChecker_Streaming(t *testing.T) {
+	quota := &quotaRecorder{limit: 4}
+	store := &recordingStorage{}
+	handler := newTestHandler(t, WithStorage(store), WithStreaming(true), WithQuotaChecker(quota.check),
+		WithFileNameGeneratorFunc(func(s string) string { return s }))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"file", "a.txt", []byte("abc")},
+		formPart{"file", "b.txt", []byte("defgh")},
+		formPart{"file", "c.txt", []byte("ij")},
+	)
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rr.Code, rr.Body)
+	}
+	if want := "[[0 1] [3 2] [8 3]]"; fmt.Sprint(quota.calls) != want {
+		t.Errorf("checker calls = %v, want %s", quota.calls, want)
+	}
+	if _, ok := store.files["c.txt"]; ok || len(store.files) != 2 {
+		t.Errorf("expected the parts before the rejected one to be stored, got %v", store.files)
+	}
+}
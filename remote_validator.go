@@ -0,0 +1,138 @@
+package GFileMux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRemoteValidatorTimeout bounds each policy service call unless
+// RemoteValidatorTimeout says otherwise.
+const DefaultRemoteValidatorTimeout = 5 * time.Second
+
+// remoteValidator asks an external policy service whether a file may be stored.
+type remoteValidator struct {
+	endpoint   string
+	client     *http.Client
+	timeout    time.Duration
+	failOpen   bool
+	sampleSize int
+}
+
+// RemoteValidatorOption configures WithRemoteValidator.
+type RemoteValidatorOption func(*remoteValidator)
+
+// RemoteValidatorTimeout sets the per-call timeout; 0 disables it. Defaults to
+// DefaultRemoteValidatorTimeout.
+func RemoteValidatorTimeout(d time.Duration) RemoteValidatorOption {
+	return func(rv *remoteValidator) {
+		rv.timeout = d
+	}
+}
+
+// RemoteValidatorFailOpen accepts files when the policy service cannot be
+// reached or answers with a 5xx status. By default such files are rejected.
+func RemoteValidatorFailOpen(enable bool) RemoteValidatorOption {
+	return func(rv *remoteValidator) {
+		rv.failOpen = enable
+	}
+}
+
+// RemoteValidatorContentSample sends up to n leading bytes of each file along
+// with its metadata. By default no content is sent.
+func RemoteValidatorContentSample(n int) RemoteValidatorOption {
+	return func(rv *remoteValidator) {
+		rv.sampleSize = n
+	}
+}
+
+// remoteValidationRequest is the JSON body POSTed to the policy service.
+// ContentSample is base64-encoded by encoding/json.
+type remoteValidationRequest struct {
+	File          File   `json:"file"`
+	ContentSample []byte `json:"content_sample,omitempty"`
+}
+
+// maxRemoteMessage caps how much of a rejection body is used as the message.
+const maxRemoteMessage = 1 << 10
+
+// validate posts f to the policy service. rs is rewound before returning.
+func (rv *remoteValidator) validate(ctx context.Context, gfm *GFileMux, f File, rs io.ReadSeeker) error {
+	payload := remoteValidationRequest{File: f}
+	if rv.sampleSize > 0 {
+		sample, err := io.ReadAll(io.LimitReader(rs, int64(rv.sampleSize)))
+		if err != nil {
+			return err
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		payload.ContentSample = sample
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if rv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rv.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rv.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := rv.client.Do(req)
+	if err != nil {
+		return rv.unavailable(ctx, gfm, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode >= 500:
+		return rv.unavailable(ctx, gfm, fmt.Errorf("policy service returned %s", resp.Status))
+	}
+	return &ValidationError{Field: f.FieldName, Message: rejectionMessage(resp)}
+}
+
+// unavailable applies the fail-open/fail-closed policy to a service failure.
+func (rv *remoteValidator) unavailable(ctx context.Context, gfm *GFileMux, err error) error {
+	if rv.failOpen {
+		gfm.log(ctx, slog.LevelWarn, "policy service unavailable, accepting file", "error", err)
+		return nil
+	}
+	return fmt.Errorf("policy service unavailable: %w", err)
+}
+
+// rejectionMessage extracts a human-readable reason from a rejection: the
+// "message" or "error" field of a JSON body, else the body text, else the status.
+func rejectionMessage(resp *http.Response) string {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxRemoteMessage))
+	var parsed struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(data, &parsed) == nil {
+		if parsed.Message != "" {
+			return parsed.Message
+		}
+		if parsed.Error != "" {
+			return parsed.Error
+		}
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return msg
+	}
+	return "rejected by policy service: " + resp.Status
+}
@@ -0,0 +1,74 @@
+package GFileMux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteValidator(t *testing.T) {
+	var got remoteValidationRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if strings.HasSuffix(got.File.OriginalName, ".exe") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"executables are not allowed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	handler := newTestHandler(t, WithRemoteValidator(srv.URL, srv.Client(), RemoteValidatorContentSample(4)))
+	ctx := context.Background()
+
+	_, err := handler.UploadFiles(ctx, "bucket", []NamedReader{
+		{FieldName: "f", FileName: "a.txt", Reader: strings.NewReader("hello world")},
+	})
+	if err != nil {
+		t.Fatalf("expected approval, got %v", err)
+	}
+	if string(got.ContentSample) != "hell" || got.File.FieldName != "f" {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+
+	_, err = handler.UploadFiles(ctx, "bucket", []NamedReader{
+		{FieldName: "f", FileName: "a.exe", Reader: strings.NewReader("MZ")},
+	})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Message != "executables are not allowed" {
+		t.Errorf("expected rejection with the service's message, got %v", err)
+	}
+}
+
+func TestRemoteValidator_Unavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	files := func() []NamedReader {
+		return []NamedReader{{FieldName: "f", FileName: "a.txt", Reader: strings.NewReader("x")}}
+	}
+
+	closed := newTestHandler(t, WithRemoteValidator(srv.URL, srv.Client(), RemoteValidatorTimeout(20*time.Millisecond)))
+	_, err := closed.UploadFiles(context.Background(), "bucket", files())
+	var ve *ValidationError
+	if err == nil || errors.As(err, &ve) {
+		t.Errorf("fail-closed: expected a non-validation error, got %v", err)
+	}
+
+	open := newTestHandler(t, WithRemoteValidator(srv.URL, srv.Client(),
+		RemoteValidatorTimeout(20*time.Millisecond),
+		RemoteValidatorFailOpen(true),
+	))
+	if _, err := open.UploadFiles(context.Background(), "bucket", files()); err != nil {
+		t.Errorf("fail-open: expected the file to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package GFileMux
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// WriteUploadedFilesJSON writes files as a 200 OK JSON response: an object
+// mapping each form field to its uploaded files, with their names, sizes,
+// checksums and storage keys. It is the body WithAutoResponse sends, for
+// handlers that want the same shape after doing work of their own.
+//
+//	files, _ := GFileMux.GetUploadedFilesFromContext(r)
+//	if err := GFileMux.WriteUploadedFilesJSON(w, files); err != nil {
+//	    log.Println(err)
+//	}
+func WriteUploadedFilesJSON(w http.ResponseWriter, files Files) error {
+	if files == nil {
+		files = Files{}
+	}
+	body, err := json.Marshal(files)
+	if err != nil {
+		return fmt.Errorf("could not encode uploaded files: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	return err
+}
+
+// serveNext hands a completed upload to next, or to the success handler when
+// one is configured. With autoResponse it then writes files as JSON if that
+// handler did not write a response of its own.
+func (gfm *GFileMux) serveNext(w http.ResponseWriter, r *http.Request, next http.Handler, files Files) {
+	if gfm.uploadSuccessHandler != nil {
+		next = gfm.uploadSuccessHandler(files)
+	}
+	if !gfm.autoResponse {
+		next.ServeHTTP(w, r)
+		return
+	}
+	tw := &writeTracker{ResponseWriter: w}
+	next.ServeHTTP(tw, r)
+	if tw.wrote {
+		return
+	}
+	if err := WriteUploadedFilesJSON(w, files); err != nil {
+		gfm.log(r.Context(), slog.LevelError, "could not write upload response", "error", err)
+	}
+}
+
+// writeTracker records whether a handler started a response.
+type writeTracker struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (tw *writeTracker) WriteHeader(code int) {
+	tw.wrote = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *writeTracker) Write(p []byte) (int, error) {
+	tw.wrote = true
+	return tw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *writeTracker) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
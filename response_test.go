@@ -0,0 +1,91 @@
+package GFileMux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGFileMux_AutoResponse(t *testing.T) {
+	handler := newTestHandler(t,
+		WithAutoResponse(true),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	t.Run("next writes nothing", func(t *testing.T) {
+		called := false
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})).ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("hello")))
+
+		if !called {
+			t.Error("expected the next handler to be called")
+		}
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("expected a 200 JSON response, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		var files Files
+		if err := json.Unmarshal(rr.Body.Bytes(), &files); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		got := files["file"]
+		if len(got) != 1 || got[0].OriginalName != "a.txt" || got[0].StorageKey != "a.txt" || got[0].MimeType != "text/plain" {
+			t.Errorf("unexpected files in response: %+v", files)
+		}
+	})
+
+	t.Run("next writes its own response", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})).ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("hello")))
+
+		if rr.Code != http.StatusAccepted || rr.Body.Len() != 0 {
+			t.Errorf("expected the handler's empty 202 to be kept, got %d %q", rr.Code, rr.Body)
+		}
+	})
+}
+
+func TestWriteUploadedFilesJSON_Nil(t *testing.T) {
+	rr := httptest.NewRecorder()
+	if err := WriteUploadedFilesJSON(rr, nil); err != nil {
+		t.Fatalf("WriteUploadedFilesJSON: %v", err)
+	}
+	if rr.Body.String() != "{}" {
+		t.Errorf("expected an empty object, got %q", rr.Body)
+	}
+}
+
+func TestGFileMux_UploadSuccessHandler(t *testing.T) {
+	var (
+		handlerFiles Files
+		contextFiles Files
+	)
+	handler := newTestHandler(t,
+		WithUploadSuccessHandlerFunc(func(files Files) http.HandlerFunc {
+			handlerFiles = files
+			return func(w http.ResponseWriter, r *http.Request) {
+				contextFiles, _ = GetUploadedFilesFromContext(r)
+				w.WriteHeader(http.StatusCreated)
+			}
+		}),
+	)
+
+	nextCalled := false
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+	})).ServeHTTP(rr, buildMultipartRequest(t, "file", "a.txt", []byte("hello")))
+
+	if nextCalled {
+		t.Error("the next handler should not be called when a success handler is set")
+	}
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected the success handler's 201, got %d", rr.Code)
+	}
+	if handlerFiles.Count() != 1 || contextFiles.Count() != 1 {
+		t.Errorf("expected the success handler to see 1 file, got %d (context %d)", handlerFiles.Count(), contextFiles.Count())
+	}
+}
@@ -0,0 +1,194 @@
+package GFileMux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Tier prefixes that sizeRouter adds to the keys and folder destinations it
+// reports, so later calls can be routed back to the backend that stored a file.
+const (
+	smallTier = "small:"
+	largeTier = "large:"
+)
+
+// sizeRouter is a Storage that sends files up to threshold bytes to small and
+// larger ones, or ones of unknown size, to large. See WithStorageBySizeThreshold.
+type sizeRouter struct {
+	threshold int64
+	small     Storage
+	large     Storage
+}
+
+// Upload stores the file in the backend chosen by options.Size and prefixes
+// the returned Key and FolderDestination with that backend's tier.
+func (sr *sizeRouter) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	tier, store := largeTier, sr.large
+	if options != nil && options.Size > 0 && options.Size <= sr.threshold {
+		tier, store = smallTier, sr.small
+	}
+	metadata, err := store.Upload(ctx, reader, options)
+	if err != nil {
+		return nil, err
+	}
+	return tagMetadata(tier, metadata), nil
+}
+
+// implements reports whether s supports the optional interface T. A
+// sizeRouter implements every optional interface but only forwards to its
+// backends, so it supports T when both of them do.
+func implements[T any](s Storage) bool {
+	if sr, ok := s.(*sizeRouter); ok {
+		return implements[T](sr.small) && implements[T](sr.large)
+	}
+	_, ok := s.(T)
+	return ok
+}
+
+// tagMetadata returns a copy of metadata with tier prefixed to its Key and
+// FolderDestination.
+func tagMetadata(tier string, metadata *UploadedFileMetadata) *UploadedFileMetadata {
+	tagged := *metadata
+	tagged.Key = tier + metadata.Key
+	tagged.FolderDestination = tier + metadata.FolderDestination
+	return &tagged
+}
+
+// route resolves a key issued by Upload to its tier, backend and untagged key.
+func (sr *sizeRouter) route(key string) (string, Storage, string, error) {
+	if k, ok := strings.CutPrefix(key, smallTier); ok {
+		return smallTier, sr.small, k, nil
+	}
+	if k, ok := strings.CutPrefix(key, largeTier); ok {
+		return largeTier, sr.large, k, nil
+	}
+	return "", nil, "", fmt.Errorf("key %q has no %q or %q storage tier prefix", key, smallTier, largeTier)
+}
+
+func (sr *sizeRouter) Path(ctx context.Context, options PathOptions) (string, error) {
+	_, store, key, err := sr.route(options.Key)
+	if err != nil {
+		return "", err
+	}
+	options.Key = key
+	return store.Path(ctx, options)
+}
+
+func (sr *sizeRouter) Delete(ctx context.Context, bucket, key string) error {
+	_, store, key, err := sr.route(key)
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, bucket, key)
+}
+
+// Open streams a file back from the backend that stored it, which must
+// implement Opener.
+func (sr *sizeRouter) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *UploadedFileMetadata, error) {
+	tier, store, untagged, err := sr.route(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	opener, ok := store.(Opener)
+	if !ok {
+		return nil, nil, errors.New("storage backend does not implement Opener")
+	}
+	rc, metadata, err := opener.Open(ctx, bucket, untagged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, tagMetadata(tier, metadata), nil
+}
+
+// Stat describes a file using the backend that stored it, which must
+// implement Statter.
+func (sr *sizeRouter) Stat(ctx context.Context, bucket, key string) (*UploadedFileMetadata, error) {
+	tier, store, untagged, err := sr.route(key)
+	if err != nil {
+		return nil, err
+	}
+	statter, ok := store.(Statter)
+	if !ok {
+		return nil, errors.New("storage backend does not implement Statter")
+	}
+	metadata, err := statter.Stat(ctx, bucket, untagged)
+	if err != nil {
+		return nil, err
+	}
+	return tagMetadata(tier, metadata), nil
+}
+
+// Exists reports whether key is stored. A key issued by Upload is looked up in
+// the backend that stored it. An untagged key, such as the name an overwrite
+// policy checks before storing, exists if either backend has it, since the
+// file may have gone to either tier. Both backends must implement Exister.
+func (sr *sizeRouter) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	stores := []Storage{sr.small, sr.large}
+	if _, store, untagged, err := sr.route(key); err == nil {
+		stores, key = []Storage{store}, untagged
+	}
+	for _, store := range stores {
+		exister, ok := store.(Exister)
+		if !ok {
+			return false, errors.New("storage backend does not implement Exister")
+		}
+		exists, err := exister.Exists(ctx, bucket, key)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// List lists both backends and returns their files with tier-prefixed keys,
+// sorted by key. Prefix matches those keys, so "small:users/" lists one
+// backend and "" lists both. Both backends must implement Lister.
+func (sr *sizeRouter) List(ctx context.Context, options ListOptions) ([]UploadedFileMetadata, error) {
+	var files []UploadedFileMetadata
+	for _, tier := range []struct {
+		prefix string
+		store  Storage
+	}{{smallTier, sr.small}, {largeTier, sr.large}} {
+		tierOptions := options
+		if rest, ok := strings.CutPrefix(options.Prefix, tier.prefix); ok {
+			tierOptions.Prefix = rest
+		} else if strings.HasPrefix(tier.prefix, options.Prefix) {
+			tierOptions.Prefix = ""
+		} else {
+			continue
+		}
+		lister, ok := tier.store.(Lister)
+		if !ok {
+			return nil, errors.New("storage backend does not implement Lister")
+		}
+		listed, err := lister.List(ctx, tierOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range listed {
+			files = append(files, *tagMetadata(tier.prefix, &f))
+		}
+	}
+	slices.SortFunc(files, func(a, b UploadedFileMetadata) int { return strings.Compare(a.Key, b.Key) })
+	if options.Limit > 0 && len(files) > options.Limit {
+		files = files[:options.Limit]
+	}
+	return files, nil
+}
+
+// Capabilities combines the requirements of both backends.
+func (sr *sizeRouter) Capabilities() StorageCapabilities {
+	small, large := storageCapabilities(sr.small), storageCapabilities(sr.large)
+	return StorageCapabilities{
+		RequiresSeekableReader: small.RequiresSeekableReader || large.RequiresSeekableReader,
+		RequiresBucket:         small.RequiresBucket || large.RequiresBucket,
+	}
+}
+
+func (sr *sizeRouter) Close() error {
+	return errors.Join(sr.small.Close(), sr.large.Close())
+}
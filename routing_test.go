@@ -0,0 +1,144 @@
+package GFileMux
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGFileMux_StorageBySizeThreshold(t *testing.T) {
+	small, large := &openableStorage{}, &openableStorage{}
+	handler := newTestHandler(t,
+		WithStorageBySizeThreshold(4, small, large),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	files, err := handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "f", FileName: "tiny.txt", Reader: strings.NewReader("abcd")},
+		{FieldName: "f", FileName: "big.txt", Reader: strings.NewReader("abcdefgh")},
+	})
+	if err != nil {
+		t.Fatalf("UploadFiles: %v", err)
+	}
+
+	tiny, big := files["f"][0], files["f"][1]
+	if tiny.StorageKey != "small:tiny.txt" || !strings.HasPrefix(tiny.FolderDestination, "small:") {
+		t.Errorf("expected tiny.txt in the small tier, got key %q folder %q", tiny.StorageKey, tiny.FolderDestination)
+	}
+	if big.StorageKey != "large:big.txt" || !strings.HasPrefix(big.FolderDestination, "large:") {
+		t.Errorf("expected big.txt in the large tier, got key %q folder %q", big.StorageKey, big.FolderDestination)
+	}
+	if _, ok := small.files["tiny.txt"]; !ok {
+		t.Error("tiny.txt should be stored in the small backend")
+	}
+	if _, ok := large.files["big.txt"]; !ok {
+		t.Error("big.txt should be stored in the large backend")
+	}
+
+	// Downstream calls through Storage() reach the backend that stored the file.
+	rc, meta, err := handler.Storage().(Opener).Open(context.Background(), "bucket", big.StorageKey)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "abcdefgh" || meta.Key != big.StorageKey {
+		t.Errorf("unexpected content %q / key %q", data, meta.Key)
+	}
+	if path, err := handler.Storage().Path(context.Background(), PathOptions{Key: tiny.StorageKey}); err != nil || path != "mock/path/tiny.txt" {
+		t.Errorf("expected the small backend's path, got %q (%v)", path, err)
+	}
+	if _, err := handler.Storage().Path(context.Background(), PathOptions{Key: "tiny.txt"}); err == nil {
+		t.Error("expected an error for a key without a tier prefix")
+	}
+}
+
+// listingStorage is an existingStorage that can also list its files.
+type listingStorage struct {
+	existingStorage
+}
+
+func (s *listingStorage) List(ctx context.Context, options ListOptions) ([]UploadedFileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var files []UploadedFileMetadata
+	for _, key := range slices.Sorted(maps.Keys(s.files)) {
+		if strings.HasPrefix(key, options.Prefix) {
+			files = append(files, UploadedFileMetadata{Key: key, Size: int64(len(s.files[key]))})
+		}
+	}
+	return files, nil
+}
+
+func TestGFileMux_StorageBySizeThreshold_ExistsAndList(t *testing.T) {
+	small, large := &listingStorage{}, &listingStorage{}
+	small.files = map[string][]byte{"a.txt": []byte("old")}
+	handler := newTestHandler(t,
+		WithStorageBySizeThreshold(4, small, large),
+		WithOverwritePolicy(OverwriteRename),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	// The name is taken in the small tier, so a large file is renamed too.
+	files, err := handler.UploadFiles(context.Background(), "bucket", []NamedReader{
+		{FieldName: "f", FileName: "a.txt", Reader: strings.NewReader("abcdefgh")},
+	})
+	if err != nil {
+		t.Fatalf("UploadFiles: %v", err)
+	}
+	if key := files["f"][0].StorageKey; key != "large:a-1.txt" {
+		t.Fatalf("expected large:a-1.txt, got %q", key)
+	}
+
+	exister := handler.Storage().(Exister)
+	for key, want := range map[string]bool{"large:a-1.txt": true, "small:a-1.txt": false, "a.txt": true, "b.txt": false} {
+		if got, err := exister.Exists(context.Background(), "bucket", key); err != nil || got != want {
+			t.Errorf("Exists(%q) = %v, %v; want %v", key, got, err, want)
+		}
+	}
+
+	lister := handler.Storage().(Lister)
+	listed, err := lister.List(context.Background(), ListOptions{Bucket: "bucket"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var keys []string
+	for _, f := range listed {
+		keys = append(keys, f.Key)
+	}
+	if !slices.Equal(keys, []string{"large:a-1.txt", "small:a.txt"}) {
+		t.Errorf("List keys = %v", keys)
+	}
+	if listed, _ := lister.List(context.Background(), ListOptions{Prefix: "small:"}); len(listed) != 1 || listed[0].Key != "small:a.txt" {
+		t.Errorf("expected only the small tier, got %+v", listed)
+	}
+
+	// An overwrite policy needs Exists on both backends.
+	if _, err := New(WithStorageBySizeThreshold(4, small, &MockStorage{}), WithOverwritePolicy(OverwriteError)); err == nil {
+		t.Error("expected New to reject a tier without Exists")
+	}
+}
+
+func TestNew_StorageBySizeThreshold_RequiresBothBackends(t *testing.T) {
+	cases := []struct {
+		name         string
+		small, large Storage
+		opt          GFileMuxOption
+		wantErr      bool
+	}{
+		{"post-store, both openers", &openableStorage{}, &openableStorage{}, WithPostStoreValidation(true), false},
+		{"post-store, large not an opener", &openableStorage{}, &MockStorage{}, WithPostStoreValidation(true), true},
+		{"overwrite policy, small not an exister", &MockStorage{}, &existingStorage{}, WithOverwritePolicy(OverwriteError), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(WithStorageBySizeThreshold(4, tc.small, tc.large), tc.opt)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package GFileMux
 import (
 	"context"
 	"io"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -14,13 +16,77 @@ type UploadFileOptions struct {
 	// Bucket specifies the storage bucket to upload the file to.
 	// If not provided, the default bucket will be used.
 	Bucket string `json:"bucket,omitempty"`
+
+	// ContentType is the MIME type of the file, as detected (and possibly
+	// overridden) by the handler. Backends that store a content type use it.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Size is the content length in bytes, when known, or 0. Backends may use
+	// it as a hint, but report the number of bytes they actually stored;
+	// S3Store sends it as the ContentLength of single-part uploads.
+	// 0 means unknown.
+	Size int64 `json:"size,omitempty"`
+
+	// ObjectLockMode and RetainUntil write the object as WORM-protected until
+	// the given time. Both must be set together. Only backends with object-lock
+	// support (S3 on buckets with Object Lock enabled) honour them.
+	ObjectLockMode ObjectLockMode `json:"object_lock_mode,omitempty"`
+	RetainUntil    *time.Time     `json:"retain_until,omitempty"`
 }
 
+// ObjectLockMode is the retention mode applied to an object-locked upload.
+type ObjectLockMode string
+
+const (
+	// ObjectLockGovernance allows users with special permissions to shorten or
+	// remove the retention period.
+	ObjectLockGovernance ObjectLockMode = "GOVERNANCE"
+
+	// ObjectLockCompliance prevents anyone, including the root account, from
+	// deleting or overwriting the object before the retention date.
+	ObjectLockCompliance ObjectLockMode = "COMPLIANCE"
+)
+
 // UploadedFileMetadata contains metadata about a file after it has been uploaded.
 type UploadedFileMetadata struct {
 	FolderDestination string `json:"folder_destination,omitempty"`
 	Key               string `json:"key,omitempty"`
 	Size              int64  `json:"size,omitempty"`
+
+	// ContentType is the stored MIME type, when the backend knows it.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Metadata is the user metadata stored with the file, when the backend
+	// keeps it. Keys are lowercase; see MergeMetadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// ModTime is when the file was last written, when the backend knows it.
+	// It is reported by Open and Stat.
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ChecksumMetadataKey is the user metadata key under which the handler stores
+// a file's hex-encoded SHA-256 checksum when it computes one (see
+// WithChecksumValidation). DownloadHandler serves it as the ETag.
+const ChecksumMetadataKey = "checksum-sha256"
+
+// MergeMetadata combines metadata maps into a new map, with later maps winning
+// on conflicting keys. Keys are lowercased first, since backends such as S3
+// store user metadata keys case-insensitively and return them in lowercase;
+// normalizing up front keeps "Team" and "team" from silently shadowing each
+// other and lets metadata read back through Stat match what was uploaded.
+// It returns nil when there is nothing to merge.
+func MergeMetadata(maps ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, m := range maps {
+		for k, v := range m {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[strings.ToLower(k)] = v
+		}
+	}
+	return merged
 }
 
 // PathOptions holds options for generating the file's path.
@@ -35,6 +101,42 @@ type PathOptions struct {
 	IsSecure bool `json:"is_secure,omitempty"`
 }
 
+// NormalizeLocation trims surrounding whitespace from a bucket and key, so
+// values that picked some up from config or templates address the same file
+// on upload and retrieval. It returns ErrEmptyKey when nothing is left of the
+// key. The built-in backends apply it to every bucket and key they receive.
+func NormalizeLocation(bucket, key string) (string, string, error) {
+	bucket, key = strings.TrimSpace(bucket), strings.TrimSpace(key)
+	if key == "" {
+		return "", "", ErrEmptyKey
+	}
+	return bucket, key, nil
+}
+
+// Normalized returns a copy of o with Bucket and FileName passed through
+// NormalizeLocation.
+func (o *UploadFileOptions) Normalized() (*UploadFileOptions, error) {
+	if o == nil {
+		return nil, ErrEmptyKey
+	}
+	n := *o
+	var err error
+	if n.Bucket, n.FileName, err = NormalizeLocation(o.Bucket, o.FileName); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Normalized returns a copy of o with Bucket and Key passed through
+// NormalizeLocation.
+func (o PathOptions) Normalized() (PathOptions, error) {
+	var err error
+	if o.Bucket, o.Key, err = NormalizeLocation(o.Bucket, o.Key); err != nil {
+		return PathOptions{}, err
+	}
+	return o, nil
+}
+
 // Storage defines the interface for interacting with file storage systems.
 type Storage interface {
 	// Upload uploads a file from the provided reader and returns metadata about the uploaded file.
@@ -49,3 +151,102 @@ type Storage interface {
 	// Closer interface to close any resources after use.
 	io.Closer
 }
+
+// Opener is implemented by backends that can stream a stored file back. Along
+// with the content it returns the file's metadata, including its content type
+// and size, so a download handler can set Content-Type and Content-Length
+// without a separate lookup. The caller must close the returned reader. A
+// missing file is reported with an error wrapping fs.ErrNotExist.
+type Opener interface {
+	Open(ctx context.Context, bucket, key string) (io.ReadCloser, *UploadedFileMetadata, error)
+}
+
+// Statter is implemented by backends that can report a stored file's metadata
+// without reading its content.
+type Statter interface {
+	Stat(ctx context.Context, bucket, key string) (*UploadedFileMetadata, error)
+}
+
+// Exister is implemented by backends that can report whether a file is
+// stored, as WithOverwritePolicy requires. A missing file is not an error.
+type Exister interface {
+	Exists(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// ListOptions selects the files returned by Lister.List.
+type ListOptions struct {
+	// Bucket to list. An empty bucket lists from the backend's root, where
+	// the backend has one.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Prefix keeps only keys that start with it, e.g. "users/42/".
+	Prefix string `json:"prefix,omitempty"`
+
+	// Limit caps the number of files returned; 0 means no limit.
+	Limit int `json:"limit,omitempty"`
+}
+
+// Lister is implemented by backends that can enumerate stored files, e.g. for
+// an admin view. List returns the files under options.Bucket whose keys start
+// with options.Prefix, sorted by key, with at least Key, Size and
+// FolderDestination set as Upload reports them.
+type Lister interface {
+	List(ctx context.Context, options ListOptions) ([]UploadedFileMetadata, error)
+}
+
+// PresignUploadOptions describes a file a client is authorized to upload
+// directly with UploadPresigner.PresignUpload.
+type PresignUploadOptions struct {
+	Bucket string `json:"bucket,omitempty"`
+
+	Key string `json:"key,omitempty"`
+
+	// ContentType, when set, is signed like Metadata: the client must send it
+	// in the returned headers, and the upload fails with any other type.
+	ContentType string `json:"content_type,omitempty"`
+
+	// Metadata is stored as the object's user metadata. It is signed, so the
+	// client must send it in the returned headers.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// ExpirationTime is how long the URL stays valid; zero uses the
+	// backend's default.
+	ExpirationTime time.Duration `json:"expiration_time,omitempty"`
+}
+
+// UploadPresigner is implemented by backends that can authorize a client to
+// upload a file straight to storage, e.g. a browser sending a large file to
+// S3 without proxying the bytes through the server. PresignUpload returns a
+// short-lived URL for an HTTP PUT of the file's content and the headers the
+// client must send with it. Such uploads bypass the handler, so none of its
+// validation applies.
+type UploadPresigner interface {
+	PresignUpload(ctx context.Context, options PresignUploadOptions) (string, http.Header, error)
+}
+
+// StorageCapabilities describes what a backend needs from the readers passed
+// to Upload.
+type StorageCapabilities struct {
+	// RequiresSeekableReader means Upload must be given an io.ReadSeeker,
+	// e.g. because the backend rewinds the content to retry a write.
+	RequiresSeekableReader bool
+
+	// RequiresBucket means every upload must name a bucket. Backends that
+	// leave it unset accept an empty bucket, e.g. storing files at their root.
+	RequiresBucket bool
+}
+
+// CapabilityReporter is implemented by backends that declare their
+// StorageCapabilities. Backends that do not implement it are assumed to accept
+// any io.Reader.
+type CapabilityReporter interface {
+	Capabilities() StorageCapabilities
+}
+
+// storageCapabilities returns the capabilities s declares, or the zero value.
+func storageCapabilities(s Storage) StorageCapabilities {
+	if cr, ok := s.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+	return StorageCapabilities{}
+}
@@ -1,14 +1,20 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"mime"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/ghulamazad/GFileMux"
+	"github.com/ghulamazad/GFileMux/utils"
 )
 
 // DiskStorage saves uploaded files to the local filesystem.
@@ -16,21 +22,70 @@ import (
 // allowing logical separation of files (e.g. by tenant or file type).
 type DiskStorage struct {
 	Directory string
+
+	// BaseURL, when set, makes Path return "<BaseURL>/<bucket>/<key>" with each
+	// segment URL-escaped, matching a file server rooted at Directory, instead
+	// of the filesystem path.
+	BaseURL string
+
+	// RejectSymlinkEscapes resolves symlinks in every destination path and
+	// rejects paths that end up outside Directory, so a symlinked bucket
+	// directory or file can't redirect reads and writes elsewhere.
+	RejectSymlinkEscapes bool
+
+	dirPerm os.FileMode // see DiskOptions.DirPerm
+}
+
+// DiskOptions configures NewDiskStorageWithOptions.
+type DiskOptions struct {
+	// CreateDir creates the directory, and any missing parents, when it does
+	// not exist. Without it the directory must already exist.
+	CreateDir bool
+
+	// DirPerm is the permission used for every directory the storage creates:
+	// the root with CreateDir, and bucket and key-prefix directories on
+	// upload. Defaults to 0o755.
+	DirPerm os.FileMode
 }
 
 // NewDiskStorage initializes a new DiskStorage instance. If the directory does
 // not exist it is created automatically (including any parent directories).
 func NewDiskStorage(directory string) (*DiskStorage, error) {
+	return NewDiskStorageWithOptions(directory, DiskOptions{CreateDir: true})
+}
+
+// NewDiskStorageWithOptions initializes a new DiskStorage instance rooted at
+// directory, creating it only when opts.CreateDir is set.
+func NewDiskStorageWithOptions(directory string, opts DiskOptions) (*DiskStorage, error) {
 	directory = strings.TrimSpace(directory)
 	if directory == "" {
 		return nil, fmt.Errorf("directory path is empty or only whitespace")
 	}
 
-	if err := os.MkdirAll(directory, 0o755); err != nil {
-		return nil, fmt.Errorf("could not create directory '%s': %v", directory, err)
+	ds := &DiskStorage{Directory: directory, dirPerm: opts.DirPerm}
+	if opts.CreateDir {
+		if err := os.MkdirAll(directory, ds.perm()); err != nil {
+			return nil, fmt.Errorf("could not create directory '%s': %v", directory, err)
+		}
+		return ds, nil
 	}
 
-	return &DiskStorage{Directory: directory}, nil
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not use directory '%s': %v", directory, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("'%s' is not a directory", directory)
+	}
+	return ds, nil
+}
+
+// perm returns the permission for directories the storage creates.
+func (ds *DiskStorage) perm() os.FileMode {
+	if ds.dirPerm == 0 {
+		return 0o755
+	}
+	return ds.dirPerm
 }
 
 // bucketDir returns the resolved directory for the given bucket, creating it
@@ -40,71 +95,516 @@ func (ds *DiskStorage) bucketDir(bucket string) (string, error) {
 	if bucket != "" {
 		dir = filepath.Join(ds.Directory, filepath.Clean(bucket))
 	}
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	if err := os.MkdirAll(dir, ds.perm()); err != nil {
 		return "", fmt.Errorf("could not create bucket directory '%s': %v", dir, err)
 	}
 	return dir, nil
 }
 
+// checkContained returns an error when RejectSymlinkEscapes is set and path,
+// once symlinks are resolved, lies outside Directory. path need not exist yet;
+// its deepest existing ancestor is resolved instead.
+func (ds *DiskStorage) checkContained(path string) error {
+	if !ds.RejectSymlinkEscapes {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(ds.Directory)
+	if err != nil {
+		return fmt.Errorf("could not resolve storage directory '%s': %v", ds.Directory, err)
+	}
+
+	resolved, rest := path, ""
+	for {
+		r, err := filepath.EvalSymlinks(resolved)
+		if err == nil {
+			resolved = filepath.Join(r, rest)
+			break
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("could not resolve path '%s': %v", path, err)
+		}
+		parent := filepath.Dir(resolved)
+		if parent == resolved {
+			break
+		}
+		rest = filepath.Join(filepath.Base(resolved), rest)
+		resolved = parent
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path '%s' resolves outside the storage directory", path)
+	}
+	return nil
+}
+
+// ErrInvalidFileName is returned by DiskStorage when a bucket or key is an
+// absolute path or climbs out of its directory with "..".
+var ErrInvalidFileName = errors.New("invalid file name: resolves outside the storage directory")
+
+// ErrReservedFileName is returned by DiskStorage for keys whose file name,
+// ".<name>.meta.json", is reserved for metadata sidecars.
+var ErrReservedFileName = errors.New("invalid file name: reserved for metadata")
+
+// filePath returns where the file for bucket and key lives under Directory.
+// Names that would escape, or escape their bucket, are rejected with
+// ErrInvalidFileName, and sidecar names with ErrReservedFileName; symlinks
+// are checked as configured by RejectSymlinkEscapes.
+func (ds *DiskStorage) filePath(bucket, key string) (string, error) {
+	for _, name := range []string{bucket, key} {
+		if !isLocalName(name) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidFileName, name)
+		}
+	}
+	if isMetadata(key[strings.LastIndexAny(key, `/\`)+1:]) {
+		return "", fmt.Errorf("%w: %q", ErrReservedFileName, key)
+	}
+	path := filepath.Join(ds.Directory, bucket, key)
+	if err := ds.checkContained(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// isLocalName reports whether name is a relative path that stays within its
+// root. Both '/' and '\' count as separators on every OS, so Windows-style
+// "..\" sequences are caught too.
+func isLocalName(name string) bool {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(name, `\`) {
+		return false
+	}
+	depth := 0
+	for _, seg := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch seg {
+		case ".":
+		case "..":
+			if depth--; depth < 0 {
+				return false
+			}
+		default:
+			depth++
+		}
+	}
+	return true
+}
+
 // Upload saves a file to disk. If a non-empty Bucket is provided in options it
 // is used as a subdirectory under the root Directory.
+//
+// The data is written to a temporary file in the destination directory and
+// renamed to the final name once complete, so readers never see a partial
+// file. The temporary file is removed if the upload fails. Use Resume for
+// uploads that should survive an interruption.
+//
+// options.Metadata is kept in a hidden sidecar file next to the stored file,
+// ".<name>.meta.json", and reported by Open.
 func (ds *DiskStorage) Upload(ctx context.Context, reader io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
-	if options == nil || options.FileName == "" {
-		return nil, fmt.Errorf("invalid upload options: file name is required")
+	options, dir, destPath, err := ds.prepare(options)
+	if err != nil {
+		return nil, err
 	}
 
-	dir, err := ds.bucketDir(options.Bucket)
+	// Same directory, so the rename below never crosses filesystems and
+	// stays atomic.
+	file, err := os.CreateTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".*.tmp")
 	if err != nil {
+		return nil, fmt.Errorf("could not create file for '%s': %v", destPath, err)
+	}
+	tmpPath := file.Name()
+
+	// The sidecar is written first, so a failure leaves any earlier file
+	// and its metadata untouched.
+	n, err := copyAndPromote(file, contextReader{ctx, reader}, tmpPath, destPath, func() error {
+		return writeMetadata(destPath, options.Metadata)
+	})
+	if err != nil {
+		os.Remove(tmpPath)
 		return nil, err
 	}
 
-	destPath := filepath.Join(dir, options.FileName)
-	file, err := os.Create(destPath)
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: dir,
+		Size:              n,
+		Key:               options.FileName,
+	}, nil
+}
+
+// Resume appends reader to the partial upload of options.FileName, kept in
+// "<key>.part", starting at offset, and renames it to the final name once
+// complete. A new resumable upload starts at offset 0. If the copy fails the
+// .part file is kept, so the upload can continue from the offset reported
+// by Offset. offset must equal the current Offset, or Resume returns
+// ErrOffsetMismatch.
+func (ds *DiskStorage) Resume(ctx context.Context, reader io.Reader, options *GFileMux.UploadFileOptions, offset int64) (*GFileMux.UploadedFileMetadata, error) {
+	options, dir, destPath, err := ds.prepare(options)
 	if err != nil {
-		return nil, fmt.Errorf("could not create file '%s': %v", destPath, err)
+		return nil, err
 	}
-	defer file.Close()
 
-	n, err := io.Copy(file, reader)
+	partPath := destPath + partSuffix
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0o644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to copy data to file '%s': %v", destPath, err)
+		return nil, fmt.Errorf("could not create file '%s': %v", partPath, err)
+	}
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not seek in file '%s': %v", partPath, err)
+	}
+	if end != offset {
+		file.Close()
+		return nil, fmt.Errorf("%w: requested %d, partial upload has %d bytes", ErrOffsetMismatch, offset, end)
+	}
+
+	n, err := copyAndPromote(file, contextReader{ctx, reader}, partPath, destPath, func() error {
+		return writeMetadata(destPath, options.Metadata)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &GFileMux.UploadedFileMetadata{
 		FolderDestination: dir,
-		Size:              n,
+		Size:              offset + n,
 		Key:               options.FileName,
 	}, nil
 }
 
-// Path returns the full filesystem path of a stored file.
+// Offset returns the number of bytes written so far for a partial upload of
+// key started with Resume, i.e. where Resume should continue. It is 0 when
+// no partial upload exists.
+func (ds *DiskStorage) Offset(ctx context.Context, bucket, key string) (int64, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	path, err := ds.filePath(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path + partSuffix)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, &GFileMux.StorageError{Backend: "disk", Op: "Offset", Err: err}
+	}
+	return info.Size(), nil
+}
+
+// ErrOffsetMismatch is returned by DiskStorage.Resume when the requested
+// offset is not where the partial upload ends.
+var ErrOffsetMismatch = errors.New("resume offset does not match the partial upload")
+
+// partSuffix marks resumable uploads that are still being written.
+const partSuffix = ".part"
+
+// prepare normalizes and checks options for a write, creating the
+// directories it needs, and returns the bucket directory and final path.
+func (ds *DiskStorage) prepare(options *GFileMux.UploadFileOptions) (*GFileMux.UploadFileOptions, string, string, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Check containment before bucketDir creates any directories.
+	if _, err := ds.filePath(options.Bucket, options.FileName); err != nil {
+		return nil, "", "", err
+	}
+
+	dir, err := ds.bucketDir(options.Bucket)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	destPath := filepath.Join(dir, options.FileName)
+	// File names may carry a key prefix such as "users/42/".
+	if err := os.MkdirAll(filepath.Dir(destPath), ds.perm()); err != nil {
+		return nil, "", "", fmt.Errorf("could not create directory for '%s': %v", destPath, err)
+	}
+	return options, dir, destPath, nil
+}
+
+// copyAndPromote copies reader into file, which lives at path, closes it,
+// calls beforeRename when it is set, and renames it to destPath. file is
+// closed whatever happens, and is not renamed if beforeRename fails.
+func copyAndPromote(file *os.File, reader io.Reader, path, destPath string, beforeRename func() error) (int64, error) {
+	n, err := io.Copy(file, reader)
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to copy data to file '%s': %w", destPath, err)
+	}
+	// CreateTemp makes files 0600; stored files are readable by others, as
+	// they were before uploads went through a temporary file.
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("could not set permissions on '%s': %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("could not write file '%s': %v", path, err)
+	}
+	if beforeRename != nil {
+		if err := beforeRename(); err != nil {
+			return 0, err
+		}
+	}
+	if err := os.Rename(path, destPath); err != nil {
+		return 0, fmt.Errorf("could not move '%s' into place: %v", path, err)
+	}
+	return n, nil
+}
+
+// metadataPath returns the sidecar file that holds the user metadata of the
+// file at path.
+func metadataPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+metadataSuffix)
+}
+
+// metadataSuffix ends the name of every metadata sidecar file.
+const metadataSuffix = ".meta.json"
+
+// writeMetadata stores metadata in the sidecar of the file at path, or
+// removes a stale sidecar left by an earlier file of the same name when there
+// is none. Like the file itself, the sidecar is renamed into place.
+func writeMetadata(path string, metadata map[string]string) error {
+	metaPath := metadataPath(path)
+	metadata = GFileMux.MergeMetadata(metadata)
+	if len(metadata) == 0 {
+		if err := os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("could not remove metadata '%s': %v", metaPath, err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("could not encode metadata for '%s': %v", path, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(metaPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create metadata for '%s': %v", path, err)
+	}
+	if _, err := copyAndPromote(file, bytes.NewReader(data), file.Name(), metaPath, nil); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// readMetadata returns the user metadata stored with the file at path, or nil
+// when it has none.
+func readMetadata(path string) (map[string]string, error) {
+	data, err := os.ReadFile(metadataPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("could not decode metadata for '%s': %v", path, err)
+	}
+	return metadata, nil
+}
+
+// contextReader fails reads once ctx is done, so a write stops promptly when
+// its upload is cancelled or times out instead of running to the end of the
+// reader.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// Path returns the full filesystem path of a stored file, or its URL when
+// BaseURL is set.
 func (ds *DiskStorage) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
-	if options.Key == "" {
-		return "", fmt.Errorf("invalid path options: key is required")
+	options, err := options.Normalized()
+	if err != nil {
+		return "", err
 	}
-	dir := ds.Directory
-	if options.Bucket != "" {
-		dir = filepath.Join(ds.Directory, filepath.Clean(options.Bucket))
+	path, err := ds.filePath(options.Bucket, options.Key)
+	if err != nil {
+		return "", err
+	}
+	if ds.BaseURL != "" {
+		key := options.Key
+		if options.Bucket != "" {
+			key = options.Bucket + "/" + key
+		}
+		return strings.TrimRight(ds.BaseURL, "/") + "/" + escapeKeyPath(filepath.ToSlash(key)), nil
 	}
-	return filepath.Join(dir, options.Key), nil
+	return path, nil
 }
 
 // Delete removes the file identified by key from the given bucket.
 func (ds *DiskStorage) Delete(ctx context.Context, bucket, key string) error {
-	if key == "" {
-		return fmt.Errorf("key is required")
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return err
 	}
-	dir := ds.Directory
-	if bucket != "" {
-		dir = filepath.Join(ds.Directory, filepath.Clean(bucket))
+	path, err := ds.filePath(bucket, key)
+	if err != nil {
+		return err
 	}
-	path := filepath.Join(dir, key)
 	if err := os.Remove(path); err != nil {
 		return &GFileMux.StorageError{Backend: "disk", Op: "Delete", Err: err}
 	}
+	if err := os.Remove(metadataPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return &GFileMux.StorageError{Backend: "disk", Op: "Delete", Err: err}
+	}
 	return nil
 }
 
+// Exists reports whether a file is stored under key in bucket.
+func (ds *DiskStorage) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return false, err
+	}
+	path, err := ds.filePath(bucket, key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, &GFileMux.StorageError{Backend: "disk", Op: "Exists", Err: err}
+	}
+	return true, nil
+}
+
+// List walks the bucket directory and returns the files whose keys, the
+// slash-separated paths below it, start with options.Prefix. Files still
+// being written by Upload or Resume are skipped, as are metadata sidecars.
+// A missing bucket directory lists as empty.
+func (ds *DiskStorage) List(ctx context.Context, options GFileMux.ListOptions) ([]GFileMux.UploadedFileMetadata, error) {
+	bucket := strings.TrimSpace(options.Bucket)
+	if !isLocalName(bucket) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFileName, bucket)
+	}
+	root := filepath.Join(ds.Directory, bucket)
+	if err := ds.checkContained(root); err != nil {
+		return nil, err
+	}
+
+	var files []GFileMux.UploadedFileMetadata
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isInProgress(d.Name()) || isMetadata(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, options.Prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, GFileMux.UploadedFileMetadata{
+			FolderDestination: root,
+			Key:               key,
+			Size:              info.Size(),
+			ModTime:           info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "disk", Op: "List", Err: err}
+	}
+	return limitFiles(files, options.Limit), nil
+}
+
+// isInProgress reports whether name is a file Upload or Resume is still
+// writing.
+func isInProgress(name string) bool {
+	return strings.HasSuffix(name, partSuffix) || (strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp"))
+}
+
+// isMetadata reports whether name is a metadata sidecar written by
+// writeMetadata.
+func isMetadata(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, metadataSuffix)
+}
+
+// Open opens the stored file for reading. The content type is sniffed from the
+// file's first bytes, falling back to its extension. Metadata is read from the
+// file's sidecar, if it has one.
+func (ds *DiskStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Not Path, which returns a URL when BaseURL is set.
+	path, err := ds.filePath(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, &GFileMux.StorageError{Backend: "disk", Op: "Open", Err: err}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, &GFileMux.StorageError{Backend: "disk", Op: "Open", Err: err}
+	}
+	contentType, err := detectContentType(key, f)
+	if err != nil {
+		f.Close()
+		return nil, nil, &GFileMux.StorageError{Backend: "disk", Op: "Open", Err: err}
+	}
+	metadata, err := readMetadata(path)
+	if err != nil {
+		f.Close()
+		return nil, nil, &GFileMux.StorageError{Backend: "disk", Op: "Open", Err: err}
+	}
+	return f, &GFileMux.UploadedFileMetadata{
+		FolderDestination: filepath.Dir(path),
+		Key:               key,
+		Size:              info.Size(),
+		ContentType:       contentType,
+		Metadata:          metadata,
+		ModTime:           info.ModTime(),
+	}, nil
+}
+
+// detectContentType sniffs the MIME type of rs, using the type registered for
+// name's extension when the content cannot be classified. rs is left at the start.
+func detectContentType(name string, rs io.ReadSeeker) (string, error) {
+	contentType, err := utils.FetchContentType(rs)
+	if err != nil {
+		return "", err
+	}
+	if contentType == "application/octet-stream" {
+		if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name))); err == nil {
+			return byExt, nil
+		}
+	}
+	return contentType, nil
+}
+
 // Close is a no-op for DiskStorage but satisfies the Storage interface.
 func (ds *DiskStorage) Close() error {
 	return nil
@@ -3,8 +3,12 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
 
 	GFileMux "github.com/ghulamazad/GFileMux"
 )
@@ -20,6 +24,33 @@ func TestDiskStorage_AutoCreateDir(t *testing.T) {
 	}
 }
 
+func TestNewDiskStorageWithOptions(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := NewDiskStorageWithOptions(missing, DiskOptions{}); err == nil {
+		t.Fatal("expected an error for a missing directory without CreateDir")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("the directory should not have been created, got %v", err)
+	}
+
+	ds, err := NewDiskStorageWithOptions(missing, DiskOptions{CreateDir: true, DirPerm: 0o700})
+	if err != nil {
+		t.Fatalf("NewDiskStorageWithOptions: %v", err)
+	}
+	if _, err := ds.Upload(context.Background(), bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt"}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	for _, dir := range []string{missing, filepath.Join(missing, "b")} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", dir, err)
+		}
+		if info.Mode().Perm() != 0o700 {
+			t.Errorf("expected %s created with 0700, got %v", dir, info.Mode().Perm())
+		}
+	}
+}
+
 func TestDiskStorage_Upload(t *testing.T) {
 	dir := t.TempDir()
 	ds, err := NewDiskStorage(dir)
@@ -101,3 +132,388 @@ func TestDiskStorage_Delete_NonExistent(t *testing.T) {
 		t.Fatal("expected error when deleting non-existent file")
 	}
 }
+
+func TestDiskStorage_Open(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	content := []byte("%PDF-1.7 body")
+	ds.Upload(ctx, bytes.NewReader(content), &GFileMux.UploadFileOptions{FileName: "doc.pdf", Bucket: "b"})
+
+	rc, meta, err := ds.Open(ctx, "b", "doc.pdf")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if !bytes.Equal(data, content) {
+		t.Errorf("expected %q, got %q", content, data)
+	}
+	if meta.Size != int64(len(content)) || meta.ContentType != "application/pdf" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
+
+func TestDiskStorage_RejectSymlinkEscapes(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	ds, _ := NewDiskStorage(root)
+	ds.RejectSymlinkEscapes = true
+	ctx := context.Background()
+
+	_, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{FileName: "a.txt", Bucket: "escape"})
+	if err == nil {
+		t.Fatal("expected upload through a symlink outside the root to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("file should not have been written outside the root")
+	}
+	if _, err := ds.Path(ctx, GFileMux.PathOptions{Bucket: "escape", Key: "a.txt"}); err == nil {
+		t.Error("expected Path through a symlink outside the root to fail")
+	}
+
+	// Regular buckets still work.
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{FileName: "a.txt", Bucket: "ok"}); err != nil {
+		t.Errorf("Upload to a regular bucket: %v", err)
+	}
+}
+
+func TestDiskStorage_RejectsPathTraversal(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	ds, _ := NewDiskStorage(root)
+	ctx := context.Background()
+
+	cases := []struct{ bucket, key string }{
+		{"", "../secret"},
+		{"b", "../../secret"},
+		{"b", "a/../../secret"},
+		{"", "/etc/passwd"},
+		{"", `..\secret`},
+		{"b", `a\..\..\secret`},
+		{"../outside", "a.txt"},
+		{"/tmp", "a.txt"},
+	}
+	for _, tc := range cases {
+		_, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: tc.bucket, FileName: tc.key})
+		if !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("Upload(%q, %q): expected ErrInvalidFileName, got %v", tc.bucket, tc.key, err)
+		}
+		if _, err := ds.Path(ctx, GFileMux.PathOptions{Bucket: tc.bucket, Key: tc.key}); !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("Path(%q, %q): expected ErrInvalidFileName, got %v", tc.bucket, tc.key, err)
+		}
+		if err := ds.Delete(ctx, tc.bucket, tc.key); !errors.Is(err, ErrInvalidFileName) {
+			t.Errorf("Delete(%q, %q): expected ErrInvalidFileName, got %v", tc.bucket, tc.key, err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(root)); len(entries) != 1 {
+		t.Errorf("nothing should be written next to the storage directory, found %d entries", len(entries))
+	}
+
+	// Dots that stay inside the bucket are fine.
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a/../ok.txt"}); err != nil {
+		t.Errorf("Upload with an inner '..': %v", err)
+	}
+}
+
+func TestDiskStorage_SymlinksFollowedByDefault(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	ds, _ := NewDiskStorage(root)
+
+	_, err := ds.Upload(context.Background(), bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{FileName: "a.txt", Bucket: "linked"})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.txt")); err != nil {
+		t.Errorf("expected file written through the symlink: %v", err)
+	}
+}
+
+func TestDiskStorage_Path_BaseURL(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ds.BaseURL = "https://cdn.example.com/files/"
+
+	path, err := ds.Path(context.Background(), GFileMux.PathOptions{Bucket: "avatars", Key: "my photo#1.jpg"})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	const want = "https://cdn.example.com/files/avatars/my%20photo%231.jpg"
+	if path != want {
+		t.Errorf("expected %q, got %q", want, path)
+	}
+}
+
+func TestDiskStorage_Open_BaseURL(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ds.BaseURL = "https://cdn.example.com/files"
+	ctx := context.Background()
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("hello")), &GFileMux.UploadFileOptions{Bucket: "avatars", FileName: "a.txt"}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	rc, meta, err := ds.Open(ctx, "avatars", "a.txt")
+	if err != nil {
+		t.Fatalf("Open with BaseURL: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "hello" || meta.Size != 5 || meta.FolderDestination != filepath.Join(ds.Directory, "avatars") {
+		t.Errorf("unexpected file %q, %+v", data, meta)
+	}
+}
+
+func TestDiskStorage_Resume(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	opts := &GFileMux.UploadFileOptions{Bucket: "b", FileName: "big.bin"}
+
+	// The connection drops after the first half.
+	broken := io.MultiReader(bytes.NewReader([]byte("hello, ")), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := ds.Resume(ctx, broken, opts, 0); err == nil {
+		t.Fatal("expected the interrupted upload to fail")
+	}
+	offset, err := ds.Offset(ctx, "b", "big.bin")
+	if err != nil || offset != 7 {
+		t.Fatalf("Offset = %d, %v; want 7", offset, err)
+	}
+	if _, err := os.Stat(filepath.Join(ds.Directory, "b", "big.bin")); !os.IsNotExist(err) {
+		t.Fatalf("the final name must not exist before the upload completes, got %v", err)
+	}
+
+	if _, err := ds.Resume(ctx, bytes.NewReader([]byte("x")), opts, 3); !errors.Is(err, ErrOffsetMismatch) {
+		t.Fatalf("expected ErrOffsetMismatch, got %v", err)
+	}
+
+	meta, err := ds.Resume(ctx, bytes.NewReader([]byte("resumed")), opts, offset)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if meta.Size != 14 {
+		t.Errorf("expected size 14, got %d", meta.Size)
+	}
+	got, _ := os.ReadFile(filepath.Join(ds.Directory, "b", "big.bin"))
+	if string(got) != "hello, resumed" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if offset, _ := ds.Offset(ctx, "b", "big.bin"); offset != 0 {
+		t.Errorf("expected no partial upload after completion, got offset %d", offset)
+	}
+}
+
+func TestDiskStorage_TrimsBucketAndKey(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: " b", FileName: "file.txt "}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ds.Directory, "b", "file.txt")); err != nil {
+		t.Fatalf("expected the file stored under the trimmed name: %v", err)
+	}
+	rc, _, err := ds.Open(ctx, "b\t", " file.txt")
+	if err != nil {
+		t.Fatalf("Open with padded names: %v", err)
+	}
+	rc.Close()
+	if _, err := ds.Path(ctx, GFileMux.PathOptions{Bucket: "b", Key: " "}); !errors.Is(err, GFileMux.ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey for a blank key, got %v", err)
+	}
+}
+
+func TestDiskStorage_Upload_Atomic(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	opts := &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt"}
+
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("old")), opts); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	broken := io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := ds.Upload(ctx, broken, opts); err == nil {
+		t.Fatal("expected the interrupted upload to fail")
+	}
+
+	got, _ := os.ReadFile(filepath.Join(ds.Directory, "b", "a.txt"))
+	if string(got) != "old" {
+		t.Errorf("a failed upload must not touch the existing file, got %q", got)
+	}
+	entries, _ := os.ReadDir(filepath.Join(ds.Directory, "b"))
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file removed, found %d entries", len(entries))
+	}
+	if info, _ := os.Stat(filepath.Join(ds.Directory, "b", "a.txt")); info.Mode().Perm() != 0o644 {
+		t.Errorf("expected the stored file to be 0644, got %v", info.Mode().Perm())
+	}
+}
+
+// cancelAfterReader cancels its context once its first chunk has been read,
+// like an upload whose deadline passes mid-write.
+type cancelAfterReader struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (r cancelAfterReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p[:min(len(p), 4)])
+	r.cancel()
+	return n, err
+}
+
+func TestDiskStorage_Upload_Cancelled(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := cancelAfterReader{Reader: bytes.NewReader(bytes.Repeat([]byte("x"), 1024)), cancel: cancel}
+	_, err := ds.Upload(ctx, r, &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the write to stop with context.Canceled, got %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(ds.Directory, "b")); len(entries) != 0 {
+		t.Errorf("expected nothing left behind, found %d entries", len(entries))
+	}
+}
+
+func TestDiskStorage_List(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	for _, name := range []string{"users/2/c.txt", "users/1/a.txt", "users/1-b.txt"} {
+		ds.Upload(ctx, bytes.NewReader([]byte(name)), &GFileMux.UploadFileOptions{Bucket: "b", FileName: name})
+	}
+	// An interrupted resumable upload is not listed.
+	ds.Resume(ctx, iotest.ErrReader(io.ErrUnexpectedEOF), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "users/1/partial.txt"}, 0)
+
+	files, err := ds.List(ctx, GFileMux.ListOptions{Bucket: "b", Prefix: "users/1"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 || files[0].Key != "users/1-b.txt" || files[1].Key != "users/1/a.txt" {
+		t.Fatalf("unexpected listing %+v", files)
+	}
+	if files[1].Size != int64(len("users/1/a.txt")) || files[1].FolderDestination != filepath.Join(ds.Directory, "b") {
+		t.Errorf("unexpected metadata %+v", files[1])
+	}
+
+	if files, _ := ds.List(ctx, GFileMux.ListOptions{Bucket: "b", Limit: 1}); len(files) != 1 {
+		t.Errorf("expected 1 file with Limit 1, got %d", len(files))
+	}
+	if files, err := ds.List(ctx, GFileMux.ListOptions{Bucket: "missing"}); err != nil || len(files) != 0 {
+		t.Errorf("expected an empty listing for a missing bucket, got %+v, %v", files, err)
+	}
+	if _, err := ds.List(ctx, GFileMux.ListOptions{Bucket: "../x"}); !errors.Is(err, ErrInvalidFileName) {
+		t.Errorf("expected ErrInvalidFileName, got %v", err)
+	}
+}
+
+func TestDiskStorage_Metadata(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	upload := func(metadata map[string]string) {
+		t.Helper()
+		_, err := ds.Upload(ctx, bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt", Metadata: metadata})
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+	}
+	opened := func() map[string]string {
+		t.Helper()
+		rc, meta, err := ds.Open(ctx, "b", "a.txt")
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		rc.Close()
+		return meta.Metadata
+	}
+
+	upload(map[string]string{"Uploaded_By": "42"})
+	if got := opened(); len(got) != 1 || got["uploaded_by"] != "42" {
+		t.Errorf("expected the uploaded metadata with a lowercase key, got %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(ds.Directory, "b", ".a.txt.meta.json")); err != nil {
+		t.Errorf("expected a sidecar file: %v", err)
+	}
+	if files, _ := ds.List(ctx, GFileMux.ListOptions{Bucket: "b"}); len(files) != 1 || files[0].Key != "a.txt" {
+		t.Errorf("expected the sidecar to be left out of List, got %+v", files)
+	}
+
+	// Overwriting without metadata drops the old metadata.
+	upload(nil)
+	if got := opened(); got != nil {
+		t.Errorf("expected no metadata after overwrite, got %v", got)
+	}
+
+	upload(map[string]string{"k": "v"})
+	if err := ds.Delete(ctx, "b", "a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(ds.Directory, "b")); len(entries) != 0 {
+		t.Errorf("expected Delete to remove the sidecar too, found %v", entries)
+	}
+}
+
+func TestDiskStorage_Metadata_ReservedName(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	ds.Upload(ctx, bytes.NewReader([]byte("pdf")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "report.pdf", Metadata: map[string]string{"owner": "alice"}})
+
+	for _, name := range []string{".report.pdf.meta.json", "sub/.x.meta.json", `sub\.x.meta.json`} {
+		_, err := ds.Upload(ctx, bytes.NewReader([]byte(`{"owner":"mallory"}`)), &GFileMux.UploadFileOptions{Bucket: "b", FileName: name})
+		if !errors.Is(err, ErrReservedFileName) {
+			t.Errorf("Upload(%q): expected ErrReservedFileName, got %v", name, err)
+		}
+	}
+	if _, _, err := ds.Open(ctx, "b", ".report.pdf.meta.json"); !errors.Is(err, ErrReservedFileName) {
+		t.Errorf("Open: expected ErrReservedFileName, got %v", err)
+	}
+	rc, meta, err := ds.Open(ctx, "b", "report.pdf")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	rc.Close()
+	if meta.Metadata["owner"] != "alice" {
+		t.Errorf("expected the original metadata, got %v", meta.Metadata)
+	}
+}
+
+func TestDiskStorage_Metadata_WriteFailureKeepsFile(t *testing.T) {
+	ds, _ := NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+	dir := filepath.Join(ds.Directory, "b")
+	ds.Upload(ctx, bytes.NewReader([]byte("old")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt"})
+	// A non-empty directory where the sidecar belongs makes writing it fail.
+	os.MkdirAll(filepath.Join(dir, ".a.txt.meta.json", "x"), 0o755)
+
+	_, err := ds.Upload(ctx, bytes.NewReader([]byte("new")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt", Metadata: map[string]string{"k": "v"}})
+	if err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "old" {
+		t.Errorf("expected the earlier file to be kept, got %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected no temporary files left behind, found %v", entries)
+	}
+}
+
+func TestDiskStorage_Exists(t *testing.T) {
+	ds, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := ds.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "b", FileName: "a.txt"}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	for key, want := range map[string]bool{"a.txt": true, "missing.txt": false} {
+		if got, err := ds.Exists(ctx, "b", key); err != nil || got != want {
+			t.Errorf("Exists(%q) = %v, %v; want %v", key, got, err, want)
+		}
+	}
+	if _, err := ds.Exists(ctx, "b", "../escape.txt"); !errors.Is(err, ErrInvalidFileName) {
+		t.Errorf("expected ErrInvalidFileName, got %v", err)
+	}
+}
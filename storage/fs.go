@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/ghulamazad/GFileMux"
+)
+
+// FileSystem is the minimal contract FSStorage needs from a filesystem. Any
+// value with these two methods can be used, e.g. a thin wrapper around an
+// afero.Fs, an embedded test filesystem, or a virtual store.
+//
+// If the value also implements Remove(name string) error, FSStorage.Delete uses
+// it; if it implements MkdirAll(path string, perm os.FileMode) error, bucket
+// directories are created before writing.
+type FileSystem interface {
+	WriteFile(name string, data []byte) error
+	ReadFile(name string) ([]byte, error)
+}
+
+// FSStorage adapts a FileSystem to the GFileMux Storage interface. Files are
+// stored at "<bucket>/<filename>" using forward slashes, as in io/fs.
+type FSStorage struct {
+	fsys FileSystem
+}
+
+// NewFSStorage wraps fsys as a Storage backend.
+func NewFSStorage(fsys FileSystem) (*FSStorage, error) {
+	if fsys == nil {
+		return nil, fmt.Errorf("file system is required")
+	}
+	return &FSStorage{fsys: fsys}, nil
+}
+
+// fsName returns the slash-separated name for a bucket+key pair, rejecting
+// names that are not valid io/fs paths (absolute, containing "..", etc.).
+func fsName(bucket, key string) (string, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	name := key
+	if bucket != "" {
+		name = bucket + "/" + key
+	}
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return name, nil
+}
+
+// Upload reads the file and writes it to the underlying FileSystem.
+func (s *FSStorage) Upload(ctx context.Context, r io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, err
+	}
+	name, err := fsName(options.Bucket, options.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(contextReader{ctx, r})
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "fs", Op: "Upload", Err: err}
+	}
+
+	if mk, ok := s.fsys.(interface {
+		MkdirAll(path string, perm os.FileMode) error
+	}); ok {
+		if dir := path.Dir(name); dir != "." {
+			if err := mk.MkdirAll(dir, 0o755); err != nil {
+				return nil, &GFileMux.StorageError{Backend: "fs", Op: "Upload", Err: err}
+			}
+		}
+	}
+
+	if err := s.fsys.WriteFile(name, data); err != nil {
+		return nil, &GFileMux.StorageError{Backend: "fs", Op: "Upload", Err: err}
+	}
+
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: options.Bucket,
+		Size:              int64(len(data)),
+		Key:               options.FileName,
+	}, nil
+}
+
+// Get returns the raw bytes stored for the given bucket+key pair.
+func (s *FSStorage) Get(bucket, key string) ([]byte, error) {
+	name, err := fsName(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.fsys.ReadFile(name)
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "fs", Op: "Get", Err: err}
+	}
+	return data, nil
+}
+
+// Open returns a reader over the stored file. The content type is sniffed from
+// the content, falling back to the file's extension.
+func (s *FSStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := s.Get(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bytes.NewReader(data)
+	contentType, err := detectContentType(key, r)
+	if err != nil {
+		return nil, nil, &GFileMux.StorageError{Backend: "fs", Op: "Open", Err: err}
+	}
+	return io.NopCloser(r), &GFileMux.UploadedFileMetadata{
+		FolderDestination: bucket,
+		Key:               key,
+		Size:              int64(len(data)),
+		ContentType:       contentType,
+	}, nil
+}
+
+// Path returns the slash-separated name of the file within the FileSystem.
+func (s *FSStorage) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
+	return fsName(options.Bucket, options.Key)
+}
+
+// Delete removes the file when the FileSystem supports Remove.
+func (s *FSStorage) Delete(ctx context.Context, bucket, key string) error {
+	name, err := fsName(bucket, key)
+	if err != nil {
+		return err
+	}
+	rm, ok := s.fsys.(interface{ Remove(name string) error })
+	if !ok {
+		return &GFileMux.StorageError{Backend: "fs", Op: "Delete", Err: fmt.Errorf("file system does not support Remove")}
+	}
+	if err := rm.Remove(name); err != nil {
+		return &GFileMux.StorageError{Backend: "fs", Op: "Delete", Err: err}
+	}
+	return nil
+}
+
+// Close is a no-op for FSStorage.
+func (s *FSStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+
+	GFileMux "github.com/ghulamazad/GFileMux"
+)
+
+// mapFS is a minimal in-memory FileSystem.
+type mapFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *mapFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = make(map[string][]byte)
+	}
+	m.files[name] = data
+	return nil
+}
+
+func (m *mapFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+// removableFS adds Remove to mapFS.
+type removableFS struct {
+	mapFS
+}
+
+func (m *removableFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func TestFSStorage_UploadAndGet(t *testing.T) {
+	fsys := &mapFS{}
+	s, err := NewFSStorage(fsys)
+	if err != nil {
+		t.Fatalf("NewFSStorage: %v", err)
+	}
+
+	content := []byte("hello, fs")
+	meta, err := s.Upload(context.Background(), bytes.NewReader(content), &GFileMux.UploadFileOptions{
+		FileName: "a.txt",
+		Bucket:   "docs",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if meta.Key != "a.txt" || meta.Size != int64(len(content)) || meta.FolderDestination != "docs" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if _, ok := fsys.files["docs/a.txt"]; !ok {
+		t.Fatalf("expected file at docs/a.txt, have %v", fsys.files)
+	}
+
+	data, err := s.Get("docs", "a.txt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("expected %q, got %q", content, data)
+	}
+}
+
+func TestFSStorage_RejectsInvalidNames(t *testing.T) {
+	s, _ := NewFSStorage(&mapFS{})
+	for _, name := range []string{"../secret", "/etc/passwd", "a/../../b", ""} {
+		_, err := s.Upload(context.Background(), bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{FileName: name})
+		if err == nil {
+			t.Errorf("expected error for file name %q", name)
+		}
+	}
+}
+
+func TestFSStorage_Delete(t *testing.T) {
+	fsys := &removableFS{}
+	s, _ := NewFSStorage(fsys)
+	s.Upload(context.Background(), bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{FileName: "a.txt", Bucket: "b"})
+
+	if err := s.Delete(context.Background(), "b", "a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("b", "a.txt"); err == nil {
+		t.Fatal("expected file to be deleted")
+	}
+}
+
+func TestFSStorage_Delete_Unsupported(t *testing.T) {
+	s, _ := NewFSStorage(&mapFS{})
+	if err := s.Delete(context.Background(), "b", "a.txt"); err == nil {
+		t.Fatal("expected error when the file system has no Remove method")
+	}
+}
+
+func TestFSStorage_Open(t *testing.T) {
+	s, _ := NewFSStorage(&mapFS{})
+	s.Upload(context.Background(), bytes.NewReader([]byte("{}")), &GFileMux.UploadFileOptions{FileName: "a.json", Bucket: "b"})
+
+	rc, meta, err := s.Open(context.Background(), "b", "a.json")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "{}" || meta.Size != 2 {
+		t.Errorf("unexpected content %q / metadata %+v", data, meta)
+	}
+	// "{}" sniffs as text/plain; only unclassified content falls back to the extension.
+	if meta.ContentType != "text/plain" {
+		t.Errorf("expected text/plain, got %q", meta.ContentType)
+	}
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/ghulamazad/GFileMux"
+)
+
+// MaxSignedURLExpiry is the longest lifetime Google Cloud Storage accepts for
+// a V4 signed URL.
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+// GCSOptions holds configuration options for interacting with Google Cloud
+// Storage.
+type GCSOptions struct {
+	// DebugMode enables store logging to slog.Default() when Logger is nil.
+	DebugMode bool
+
+	// Logger receives debug-level logs of each upload's start and finish and
+	// of Close. Nil disables them unless DebugMode is set. log/slog is the
+	// integration point, as for the handler's WithLogger: route the logs to
+	// another logging library, such as zap or zerolog, through its
+	// slog.Handler rather than a GFileMux-specific interface.
+	Logger *slog.Logger
+
+	// GoogleAccessID and PrivateKey sign the URLs returned by Path for secure
+	// requests: the service account email and its PEM or PKCS #12 private key.
+	// When both are empty, signing falls back to the client's credentials,
+	// which works for service account keys and on GCE, Cloud Run and GKE with
+	// the IAM Credentials API enabled.
+	GoogleAccessID string
+	PrivateKey     []byte
+
+	// SignedURLExpiry is the lifetime of signed URLs returned by Path when
+	// PathOptions.ExpirationTime is zero. It defaults to DefaultPresignExpiry
+	// and is capped at MaxSignedURLExpiry.
+	SignedURLExpiry time.Duration
+}
+
+// GCSStore is a Storage backend for Google Cloud Storage.
+type GCSStore struct {
+	client  *gcs.Client
+	options GCSOptions
+}
+
+// NewGCSFromClient initializes a GCSStore from an existing client. Close
+// closes the client.
+func NewGCSFromClient(client *gcs.Client, options GCSOptions) (*GCSStore, error) {
+	if client == nil {
+		return nil, errors.New("a GCS client is required")
+	}
+	return &GCSStore{client: client, options: options}, nil
+}
+
+// NewGCSFromEnvironment initializes a GCSStore using Application Default
+// Credentials.
+func NewGCSFromEnvironment(options GCSOptions) (*GCSStore, error) {
+	client, err := gcs.NewClient(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	return NewGCSFromClient(client, options)
+}
+
+// gcsNotFoundError marks a missing bucket or object as fs.ErrNotExist.
+func gcsNotFoundError(err error) error {
+	if errors.Is(err, gcs.ErrObjectNotExist) || errors.Is(err, gcs.ErrBucketNotExist) {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+// Upload streams a file to Google Cloud Storage with an object writer.
+func (s *GCSStore) Upload(ctx context.Context, r io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, err
+	}
+	if options.Bucket == "" {
+		return nil, errors.New("please provide a valid GCS bucket")
+	}
+
+	// Cancelling the writer's context is the only way to abandon an upload
+	// without committing a partial object.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.client.Bucket(options.Bucket).Object(options.FileName).NewWriter(ctx)
+	w.ContentType = options.ContentType
+	w.Metadata = GFileMux.MergeMetadata(options.Metadata)
+
+	s.debug(ctx, "GCS upload started", "bucket", options.Bucket, "key", options.FileName)
+	n, err := io.Copy(w, r)
+	if err != nil {
+		cancel()
+		w.Close()
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		s.debug(ctx, "GCS upload failed", "bucket", options.Bucket, "key", options.FileName, "error", err)
+		return nil, &GFileMux.StorageError{Backend: "gcs", Op: "Upload", Err: err}
+	}
+	s.debug(ctx, "GCS upload finished", "bucket", options.Bucket, "key", options.FileName, "size", n)
+
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: options.Bucket,
+		Size:              n,
+		Key:               options.FileName,
+	}, nil
+}
+
+// Capabilities reports that every GCS upload must name a bucket.
+func (s *GCSStore) Capabilities() GFileMux.StorageCapabilities {
+	return GFileMux.StorageCapabilities{RequiresBucket: true}
+}
+
+// Open streams an object from Google Cloud Storage.
+func (s *GCSStore) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bucket == "" {
+		return nil, nil, fmt.Errorf("bucket is required")
+	}
+	obj := s.client.Bucket(bucket).Object(key)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, nil, &GFileMux.StorageError{Backend: "gcs", Op: "Open", Err: gcsNotFoundError(err)}
+	}
+	// Pin the generation so the content matches the attributes just read.
+	rc, err := obj.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, nil, &GFileMux.StorageError{Backend: "gcs", Op: "Open", Err: gcsNotFoundError(err)}
+	}
+	return rc, gcsMetadata(attrs), nil
+}
+
+// Stat returns an object's size, content type and user metadata.
+func (s *GCSStore) Stat(ctx context.Context, bucket, key string) (*GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	attrs, err := s.client.Bucket(bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "gcs", Op: "Stat", Err: gcsNotFoundError(err)}
+	}
+	return gcsMetadata(attrs), nil
+}
+
+// Exists reports whether an object is stored under key.
+func (s *GCSStore) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	return statExists(s.Stat(ctx, bucket, key))
+}
+
+// gcsMetadata describes a stored object for Open and Stat.
+func gcsMetadata(attrs *gcs.ObjectAttrs) *GFileMux.UploadedFileMetadata {
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: attrs.Bucket,
+		Key:               attrs.Name,
+		Size:              attrs.Size,
+		ContentType:       attrs.ContentType,
+		Metadata:          attrs.Metadata,
+		ModTime:           attrs.Updated,
+	}
+}
+
+// signedURLExpiry resolves the lifetime of a signed URL: the requested one,
+// or the store default when requested is zero.
+func (s *GCSStore) signedURLExpiry(requested time.Duration) (time.Duration, error) {
+	switch {
+	case requested < 0:
+		return 0, fmt.Errorf("signed URL expiration %s must be positive", requested)
+	case requested > MaxSignedURLExpiry:
+		return 0, fmt.Errorf("signed URL expiration %s exceeds the GCS maximum of %s", requested, MaxSignedURLExpiry)
+	case requested > 0:
+		return requested, nil
+	}
+	expiry := s.options.SignedURLExpiry
+	if expiry <= 0 {
+		expiry = DefaultPresignExpiry
+	}
+	return min(expiry, MaxSignedURLExpiry), nil
+}
+
+// Path generates a URL to access a file in Google Cloud Storage: a V4 signed
+// URL when options.IsSecure is set, and a public URL otherwise.
+func (s *GCSStore) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return "", err
+	}
+	if !options.IsSecure {
+		return fmt.Sprintf("https://storage.googleapis.com/%s/%s", options.Bucket, escapeKeyPath(options.Key)), nil
+	}
+
+	expiry, err := s.signedURLExpiry(options.ExpirationTime)
+	if err != nil {
+		return "", err
+	}
+	opts := &gcs.SignedURLOptions{
+		Scheme:  gcs.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expiry),
+	}
+	var url string
+	if s.options.GoogleAccessID != "" || len(s.options.PrivateKey) > 0 {
+		opts.GoogleAccessID = s.options.GoogleAccessID
+		opts.PrivateKey = s.options.PrivateKey
+		url, err = gcs.SignedURL(options.Bucket, options.Key, opts)
+	} else {
+		url, err = s.client.Bucket(options.Bucket).SignedURL(options.Key, opts)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signed URL: %w", err)
+	}
+	return url, nil
+}
+
+// Delete removes an object from Google Cloud Storage.
+func (s *GCSStore) Delete(ctx context.Context, bucket, key string) error {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return err
+	}
+	if bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if err := s.client.Bucket(bucket).Object(key).Delete(ctx); err != nil {
+		return &GFileMux.StorageError{Backend: "gcs", Op: "Delete", Err: gcsNotFoundError(err)}
+	}
+	return nil
+}
+
+// Close closes the underlying GCS client.
+func (s *GCSStore) Close() error {
+	s.debug(context.Background(), "GCS store is being closed")
+	return s.client.Close()
+}
+
+// debug logs through the store's Logger; see debugLog.
+func (s *GCSStore) debug(ctx context.Context, msg string, args ...any) {
+	debugLog(ctx, s.options.Logger, s.options.DebugMode, msg, args...)
+}
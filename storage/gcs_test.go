@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	GFileMux "github.com/ghulamazad/GFileMux"
+	"google.golang.org/api/option"
+)
+
+// fakeGCSObject is an object held by fakeGCSServer.
+type fakeGCSObject struct {
+	Bucket      string            `json:"bucket"`
+	Name        string            `json:"name"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Size        string            `json:"size"`
+	Generation  string            `json:"generation"`
+	Updated     string            `json:"updated"`
+	data        []byte
+}
+
+// fakeGCSServer implements the parts of the GCS JSON API that GCSStore uses.
+type fakeGCSServer struct {
+	mu      sync.Mutex
+	objects map[string]*fakeGCSObject
+}
+
+func (f *fakeGCSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		bucket, _ := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/o"))
+		obj, err := readGCSUpload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		obj.Bucket = bucket
+		f.objects[bucket+"/"+obj.Name] = obj
+		json.NewEncoder(w).Encode(obj)
+
+	case strings.HasPrefix(path, "/storage/v1/b/"):
+		bucket, rest, _ := strings.Cut(strings.TrimPrefix(path, "/storage/v1/b/"), "/o/")
+		name, _ := url.PathUnescape(rest)
+		obj, ok := f.objects[bucket+"/"+name]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"Not Found"}}`, http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == http.MethodDelete:
+			delete(f.objects, bucket+"/"+name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			json.NewEncoder(w).Encode(obj)
+		}
+
+	case r.Method == http.MethodGet:
+		// Object reads use the XML API: GET /<bucket>/<object>.
+		name, _ := url.PathUnescape(strings.TrimPrefix(path, "/"))
+		obj, ok := f.objects[name]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.ContentType)
+		w.Header().Set("X-Goog-Generation", obj.Generation)
+		w.Write(obj.data)
+
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+path, http.StatusBadRequest)
+	}
+}
+
+// readGCSUpload decodes a multipart/related upload: the object's JSON
+// resource followed by its content.
+func readGCSUpload(r *http.Request) (*fakeGCSObject, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	obj := new(fakeGCSObject)
+	if err := json.NewDecoder(part).Decode(obj); err != nil {
+		return nil, err
+	}
+	if part, err = mr.NextPart(); err != nil {
+		return nil, err
+	}
+	if obj.data, err = io.ReadAll(part); err != nil {
+		return nil, err
+	}
+	obj.Size = strconv.Itoa(len(obj.data))
+	obj.Generation = "1"
+	obj.Updated = time.Now().UTC().Format(time.RFC3339Nano)
+	return obj, nil
+}
+
+// newFakeGCSStore returns a GCSStore whose client talks to a fakeGCSServer.
+func newFakeGCSStore(t *testing.T, options GCSOptions) *GCSStore {
+	t.Helper()
+	srv := httptest.NewServer(&fakeGCSServer{objects: make(map[string]*fakeGCSObject)})
+	t.Cleanup(srv.Close)
+
+	client, err := gcs.NewClient(context.Background(),
+		option.WithEndpoint(srv.URL+"/storage/v1/"),
+		option.WithoutAuthentication(),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	store, err := NewGCSFromClient(client, options)
+	if err != nil {
+		t.Fatalf("NewGCSFromClient: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestGCSStore_UploadOpenDelete(t *testing.T) {
+	store := newFakeGCSStore(t, GCSOptions{})
+	ctx := context.Background()
+
+	meta, err := store.Upload(ctx, io.MultiReader(strings.NewReader("hello, gcs")), &GFileMux.UploadFileOptions{
+		Bucket:      "bucket",
+		FileName:    "docs/a.txt",
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"owner": "alice"},
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if meta.Key != "docs/a.txt" || meta.FolderDestination != "bucket" || meta.Size != 10 {
+		t.Errorf("unexpected upload metadata %+v", meta)
+	}
+
+	rc, opened, err := store.Open(ctx, "bucket", "docs/a.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(data) != "hello, gcs" {
+		t.Errorf("Open read %q, %v", data, err)
+	}
+	if opened.ContentType != "text/plain" || opened.Size != 10 || opened.Metadata["owner"] != "alice" || opened.ModTime.IsZero() {
+		t.Errorf("unexpected opened metadata %+v", opened)
+	}
+
+	if err := store.Delete(ctx, "bucket", "docs/a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, "bucket", "docs/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat after Delete: expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestGCSStore_Upload_RequiresBucket(t *testing.T) {
+	store := newFakeGCSStore(t, GCSOptions{})
+	_, err := store.Upload(context.Background(), strings.NewReader("x"), &GFileMux.UploadFileOptions{FileName: "a.txt"})
+	if err == nil {
+		t.Fatal("expected an error for an empty bucket")
+	}
+	if !store.Capabilities().RequiresBucket {
+		t.Error("expected GCSStore to report RequiresBucket")
+	}
+}
+
+func TestGCSStore_Path_Public(t *testing.T) {
+	store := newFakeGCSStore(t, GCSOptions{})
+	path, err := store.Path(context.Background(), GFileMux.PathOptions{Bucket: "bucket", Key: "dir/my file#1.txt"})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if want := "https://storage.googleapis.com/bucket/dir/my%20file%231.txt"; path != want {
+		t.Errorf("Path = %q, want %q", path, want)
+	}
+}
+
+func TestGCSStore_Path_Signed(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	store := newFakeGCSStore(t, GCSOptions{GoogleAccessID: "uploader@project.iam.gserviceaccount.com", PrivateKey: pemKey})
+
+	path, err := store.Path(context.Background(), GFileMux.PathOptions{
+		Bucket:         "bucket",
+		Key:            "a.txt",
+		IsSecure:       true,
+		ExpirationTime: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		t.Fatalf("returned URL does not parse: %v", err)
+	}
+	q := u.Query()
+	// Expires is an absolute time, so a second may pass before signing.
+	if expires, _ := strconv.Atoi(q.Get("X-Goog-Expires")); expires < 590 || expires > 600 {
+		t.Errorf("X-Goog-Expires = %q, want about 600", q.Get("X-Goog-Expires"))
+	}
+	if q.Get("X-Goog-Signature") == "" {
+		t.Errorf("signed URL has no signature: %q", path)
+	}
+	if !strings.HasSuffix(u.Path, "/bucket/a.txt") {
+		t.Errorf("unexpected signed URL path %q", u.Path)
+	}
+
+	if _, err := store.Path(context.Background(), GFileMux.PathOptions{
+		Bucket:         "bucket",
+		Key:            "a.txt",
+		IsSecure:       true,
+		ExpirationTime: 8 * 24 * time.Hour,
+	}); err == nil {
+		t.Error("expected an error for an expiration past the GCS maximum")
+	}
+}
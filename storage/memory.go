@@ -3,10 +3,16 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ghulamazad/GFileMux"
 )
@@ -16,13 +22,21 @@ import (
 // "<bucket>/<filename>". This backend is primarily intended for testing.
 type MemoryStorage struct {
 	mu    sync.RWMutex
-	store map[string][]byte // key → file bytes
+	store map[string]memoryObject // key → stored file
+}
+
+// memoryObject is a file held by MemoryStorage.
+type memoryObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+	modTime     time.Time
 }
 
 // NewMemoryStorage initializes a new MemoryStorage.
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		store: make(map[string][]byte),
+		store: make(map[string]memoryObject),
 	}
 }
 
@@ -36,12 +50,13 @@ func storeKey(bucket, fileName string) string {
 
 // Upload reads the file into memory and stores it by bucket+filename key.
 func (ms *MemoryStorage) Upload(ctx context.Context, r io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
-	if options == nil || len(strings.TrimSpace(options.FileName)) == 0 {
-		return nil, fmt.Errorf("file name is required")
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, err
 	}
 
 	var buf bytes.Buffer
-	n, err := io.Copy(&buf, r)
+	n, err := io.Copy(&buf, contextReader{ctx, r})
 	if err != nil {
 		return nil, &GFileMux.StorageError{Backend: "memory", Op: "Upload", Err: err}
 	}
@@ -49,7 +64,12 @@ func (ms *MemoryStorage) Upload(ctx context.Context, r io.Reader, options *GFile
 	key := storeKey(options.Bucket, options.FileName)
 
 	ms.mu.Lock()
-	ms.store[key] = buf.Bytes()
+	ms.store[key] = memoryObject{
+		data:        buf.Bytes(),
+		contentType: options.ContentType,
+		metadata:    GFileMux.MergeMetadata(options.Metadata),
+		modTime:     time.Now(),
+	}
 	ms.mu.Unlock()
 
 	folder := "memory"
@@ -66,22 +86,160 @@ func (ms *MemoryStorage) Upload(ctx context.Context, r io.Reader, options *GFile
 // Get returns the raw bytes stored for the given bucket+key pair.
 // Returns an error if the file was not found.
 func (ms *MemoryStorage) Get(bucket, key string) ([]byte, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, err
+	}
 	ms.mu.RLock()
-	data, ok := ms.store[storeKey(bucket, key)]
+	obj, ok := ms.store[storeKey(bucket, key)]
 	ms.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("file not found: %s", storeKey(bucket, key))
 	}
-	return data, nil
+	return obj.data, nil
+}
+
+// Read returns a copy of the bytes stored under key, the "<bucket>/<filename>"
+// form used internally (just the filename when there is no bucket), and
+// whether such a file exists.
+func (ms *MemoryStorage) Read(key string) ([]byte, bool) {
+	ms.mu.RLock()
+	obj, ok := ms.store[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(obj.data), true
+}
+
+// Open returns a reader over the stored file together with its metadata.
+func (ms *MemoryStorage) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *GFileMux.UploadedFileMetadata, error) {
+	obj, meta, err := ms.lookup("Open", bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), meta, nil
+}
+
+// Stat returns the stored file's size, content type and user metadata.
+func (ms *MemoryStorage) Stat(ctx context.Context, bucket, key string) (*GFileMux.UploadedFileMetadata, error) {
+	_, meta, err := ms.lookup("Stat", bucket, key)
+	return meta, err
+}
+
+// Exists reports whether a file is stored under key in bucket.
+func (ms *MemoryStorage) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	return statExists(ms.Stat(ctx, bucket, key))
+}
+
+// lookup fetches a stored object and describes it for Open and Stat.
+func (ms *MemoryStorage) lookup(op, bucket, key string) (memoryObject, *GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return memoryObject{}, nil, err
+	}
+	k := storeKey(bucket, key)
+	ms.mu.RLock()
+	obj, ok := ms.store[k]
+	ms.mu.RUnlock()
+	if !ok {
+		return memoryObject{}, nil, &GFileMux.StorageError{Backend: "memory", Op: op, Err: fmt.Errorf("file not found: %s: %w", k, fs.ErrNotExist)}
+	}
+	folder := "memory"
+	if bucket != "" {
+		folder = "memory/" + bucket
+	}
+	return obj, &GFileMux.UploadedFileMetadata{
+		FolderDestination: folder,
+		Key:               key,
+		Size:              int64(len(obj.data)),
+		ContentType:       obj.contentType,
+		Metadata:          maps.Clone(obj.metadata),
+		ModTime:           obj.modTime,
+	}, nil
+}
+
+// List returns the stored files in options.Bucket whose names start with
+// options.Prefix. With an empty bucket every file is listed, keyed as
+// "<bucket>/<filename>".
+func (ms *MemoryStorage) List(ctx context.Context, options GFileMux.ListOptions) ([]GFileMux.UploadedFileMetadata, error) {
+	bucket := strings.TrimSpace(options.Bucket)
+	folder, scope := "memory", ""
+	if bucket != "" {
+		folder, scope = "memory/"+bucket, bucket+"/"
+	}
+
+	ms.mu.RLock()
+	var files []GFileMux.UploadedFileMetadata
+	for k, obj := range ms.store {
+		key, ok := strings.CutPrefix(k, scope)
+		if !ok || !strings.HasPrefix(key, options.Prefix) {
+			continue
+		}
+		files = append(files, GFileMux.UploadedFileMetadata{
+			FolderDestination: folder,
+			Key:               key,
+			Size:              int64(len(obj.data)),
+			ContentType:       obj.contentType,
+			Metadata:          maps.Clone(obj.metadata),
+			ModTime:           obj.modTime,
+		})
+	}
+	ms.mu.RUnlock()
+
+	return limitFiles(files, options.Limit), nil
+}
+
+// debugLog logs msg at debug level through logger. Without a logger it falls
+// back to slog.Default() at info level when debugMode is set, as the default
+// handler drops debug records, and does nothing otherwise.
+func debugLog(ctx context.Context, logger *slog.Logger, debugMode bool, msg string, args ...any) {
+	level := slog.LevelDebug
+	if logger == nil {
+		if !debugMode {
+			return
+		}
+		logger, level = slog.Default(), slog.LevelInfo
+	}
+	logger.Log(ctx, level, msg, args...)
+}
+
+// statExists turns the result of a Stat into the result of Exists: a missing
+// file is reported as false rather than as an error.
+func statExists(_ *GFileMux.UploadedFileMetadata, err error) (bool, error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// limitFiles sorts files by key and keeps at most limit of them (all when
+// limit is 0).
+func limitFiles(files []GFileMux.UploadedFileMetadata, limit int) []GFileMux.UploadedFileMetadata {
+	slices.SortFunc(files, func(a, b GFileMux.UploadedFileMetadata) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+	return files
 }
 
 // Path returns a descriptive URI for the stored file (not a real filesystem path).
 func (ms *MemoryStorage) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return "", err
+	}
 	return fmt.Sprintf("memory://%s/%s", options.Bucket, options.Key), nil
 }
 
 // Delete removes the stored file identified by bucket and key.
 func (ms *MemoryStorage) Delete(ctx context.Context, bucket, key string) error {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return err
+	}
 	k := storeKey(bucket, key)
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
@@ -3,6 +3,9 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"io/fs"
 	"sync"
 	"testing"
 
@@ -54,6 +57,70 @@ func TestMemoryStorage_Get_NotFound(t *testing.T) {
 	}
 }
 
+func TestMemoryStorage_Read(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.Upload(context.Background(), bytes.NewReader([]byte("cached")), &GFileMux.UploadFileOptions{
+		FileName: "file.txt",
+		Bucket:   "b",
+	})
+
+	data, ok := ms.Read("b/file.txt")
+	if !ok || string(data) != "cached" {
+		t.Fatalf("Read = %q, %v; want %q, true", data, ok, "cached")
+	}
+	data[0] = 'X'
+	if again, _ := ms.Read("b/file.txt"); string(again) != "cached" {
+		t.Errorf("Read should return a copy, stored bytes became %q", again)
+	}
+	if _, ok := ms.Read("b/missing.txt"); ok {
+		t.Error("expected ok=false for a missing key")
+	}
+}
+
+func TestMemoryStorage_TrimsBucketAndKey(t *testing.T) {
+	ms := NewMemoryStorage()
+	ctx := context.Background()
+	if _, err := ms.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "b ", FileName: "file.txt\n"}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if _, err := ms.Get(" b", " file.txt"); err != nil {
+		t.Errorf("expected padded names to address the same file, got %v", err)
+	}
+	if _, err := ms.Upload(ctx, bytes.NewReader(nil), &GFileMux.UploadFileOptions{FileName: "  "}); !errors.Is(err, GFileMux.ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey for a blank file name, got %v", err)
+	}
+	if err := ms.Delete(ctx, "b", " "); !errors.Is(err, GFileMux.ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey for a blank key, got %v", err)
+	}
+}
+
+func TestMemoryStorage_List(t *testing.T) {
+	ms := NewMemoryStorage()
+	ctx := context.Background()
+	for _, name := range []string{"users/2/c.txt", "users/1/a.txt", "users/1/b.txt"} {
+		ms.Upload(ctx, bytes.NewReader([]byte(name)), &GFileMux.UploadFileOptions{Bucket: "b", FileName: name})
+	}
+	ms.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "other", FileName: "users/1/z.txt"})
+
+	files, err := ms.List(ctx, GFileMux.ListOptions{Bucket: "b", Prefix: "users/1/"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 || files[0].Key != "users/1/a.txt" || files[1].Key != "users/1/b.txt" {
+		t.Fatalf("unexpected listing %+v", files)
+	}
+	if files[0].Size != int64(len("users/1/a.txt")) || files[0].FolderDestination != "memory/b" {
+		t.Errorf("unexpected metadata %+v", files[0])
+	}
+
+	if files, _ := ms.List(ctx, GFileMux.ListOptions{Bucket: "b", Limit: 1}); len(files) != 1 || files[0].Key != "users/1/a.txt" {
+		t.Errorf("expected the first key only, got %+v", files)
+	}
+	if files, _ := ms.List(ctx, GFileMux.ListOptions{}); len(files) != 4 {
+		t.Errorf("expected every file without a bucket, got %d", len(files))
+	}
+}
+
 func TestMemoryStorage_Delete(t *testing.T) {
 	ms := NewMemoryStorage()
 	ms.Upload(context.Background(), bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
@@ -94,3 +161,48 @@ func TestMemoryStorage_ConcurrentUploads(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestMemoryStorage_Open(t *testing.T) {
+	ms := NewMemoryStorage()
+	ctx := context.Background()
+	ms.Upload(ctx, bytes.NewReader([]byte("hello")), &GFileMux.UploadFileOptions{
+		FileName:    "a.txt",
+		Bucket:      "b",
+		ContentType: "text/plain",
+	})
+
+	rc, meta, err := ms.Open(ctx, "b", "a.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "hello" || meta.Size != 5 || meta.ContentType != "text/plain" {
+		t.Errorf("unexpected content %q / metadata %+v", data, meta)
+	}
+	if meta.ModTime.IsZero() {
+		t.Error("expected the upload time as ModTime")
+	}
+
+	if _, _, err := ms.Open(ctx, "b", "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for a missing file, got %v", err)
+	}
+}
+
+func TestMemoryStorage_Stat(t *testing.T) {
+	ms := NewMemoryStorage()
+	ctx := context.Background()
+	ms.Upload(ctx, bytes.NewReader([]byte("hello")), &GFileMux.UploadFileOptions{
+		FileName: "a.txt",
+		Bucket:   "b",
+		Metadata: map[string]string{"Owner": "alice"},
+	})
+
+	meta, err := ms.Stat(ctx, "b", "a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if meta.Size != 5 || meta.Metadata["owner"] != "alice" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
@@ -1,44 +1,220 @@
 package storage
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/ghulamazad/GFileMux"
-	"github.com/ghulamazad/GFileMux/utils"
+)
+
+const (
+	// DefaultPresignExpiry is the presigned URL lifetime used when neither
+	// PathOptions.ExpirationTime nor S3Options.PresignExpiry is set.
+	DefaultPresignExpiry = 15 * time.Minute
+
+	// MaxPresignExpiry is the longest lifetime S3 accepts for a SigV4
+	// presigned URL.
+	MaxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Visibility ties an S3Store's object ACL to the kind of URL Path returns.
+type S3Visibility int
+
+const (
+	// S3VisibilityDefault leaves the ACL as configured and lets
+	// PathOptions.IsSecure choose between direct and presigned URLs.
+	S3VisibilityDefault S3Visibility = iota
+	// S3VisibilityPublic uploads objects public-read and makes Path return
+	// direct URLs unless IsSecure asks for a presigned one.
+	S3VisibilityPublic
+	// S3VisibilityPrivate uploads objects private and makes Path always return
+	// presigned URLs, since a direct URL would not be readable.
+	S3VisibilityPrivate
 )
 
 // S3Options holds configuration options for interacting with an S3 store.
 type S3Options struct {
+	// DebugMode enables the AWS SDK's request logging, and store logging to
+	// slog.Default() when Logger is nil.
 	DebugMode    bool
 	UsePathStyle bool
 	ACL          types.ObjectCannedACL
+
+	// Endpoint is the base URL of an S3-compatible service such as MinIO,
+	// Ceph or Wasabi, e.g. "http://localhost:9000". Such services usually
+	// also need UsePathStyle. Direct URLs from Path are built on it instead
+	// of amazonaws.com. Empty means AWS.
+	Endpoint string
+
+	// Region overrides the region from the AWS configuration. S3-compatible
+	// services often accept any value, such as "us-east-1".
+	Region string
+
+	// Logger receives debug-level logs of each upload's start and finish and
+	// of Close. Nil disables them unless DebugMode is set. log/slog is the
+	// integration point, as for the handler's WithLogger: route the logs to
+	// another logging library, such as zap or zerolog, through its
+	// slog.Handler rather than a GFileMux-specific interface.
+	Logger *slog.Logger
+
+	// PresignExpiry is the lifetime of presigned URLs returned by Path when
+	// PathOptions.ExpirationTime is zero. It defaults to DefaultPresignExpiry
+	// and is capped at MaxPresignExpiry.
+	PresignExpiry time.Duration
+
+	// BucketProfiles holds per-bucket upload defaults, keyed by bucket name.
+	// A profile's ACL takes precedence over ACL and Visibility for its bucket.
+	BucketProfiles map[string]BucketProfile
+
+	// Visibility sets the default ACL (when ACL is empty) and the URL style
+	// returned by Path. See S3Visibility.
+	Visibility S3Visibility
+
+	// SanitizeKeys strips characters that are unsafe in URLs (spaces, '+', '#',
+	// '?', non-ASCII, ...) from object keys at upload time. Whitespace is
+	// replaced with '-'. The sanitized key is returned in UploadedFileMetadata.Key.
+	SanitizeKeys bool
+
+	// RequestPayer confirms that the requester pays for requests against
+	// requester-pays buckets (use types.RequestPayerRequester). It is sent on
+	// uploads, deletes and presigned downloads; without it those calls fail
+	// with 403 on such buckets.
+	RequestPayer types.RequestPayer
+
+	// PartSize is the size of each part of a multipart upload, and the
+	// largest body sent with a single PutObject. Each in-flight part is
+	// buffered in memory. It defaults to manager.DefaultUploadPartSize (5 MiB),
+	// which is also the minimum S3 accepts.
+	PartSize int64
+
+	// Concurrency is how many parts of one file are uploaded in parallel.
+	// It defaults to manager.DefaultUploadConcurrency.
+	Concurrency int
+
+	// ServerSideEncryption, SSEKMSKeyID and StorageClass are applied to every
+	// upload; a BucketProfile's non-empty values take precedence. Setting
+	// SSEKMSKeyID alone selects aws:kms encryption.
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	StorageClass         types.StorageClass
+}
+
+// BucketProfile holds upload defaults applied to every object written to one
+// bucket. Empty fields are left unset. Metadata is merged with the upload's own
+// metadata, with the upload's values winning on conflicting keys.
+type BucketProfile struct {
+	ACL                  types.ObjectCannedACL
+	StorageClass         types.StorageClass
+	ServerSideEncryption types.ServerSideEncryption
+	// SSEKMSKeyID selects the KMS key, implying aws:kms when
+	// ServerSideEncryption is empty.
+	SSEKMSKeyID  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+// s3API is the subset of the S3 client used by S3Store. It is satisfied by
+// *s3.Client and lets tests substitute a fake. Uploads go through the
+// multipart upload manager, which needs manager.UploadAPIClient.
+type s3API interface {
+	manager.UploadAPIClient
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 }
 
 // S3Store is a structure that represents the S3 storage client.
 type S3Store struct {
-	client  *s3.Client
-	options S3Options
+	client    s3API
+	uploader  *manager.Uploader
+	presigner *s3.PresignClient
+	options   S3Options
 }
 
-// NewS3FromConfig initializes an S3Store using an AWS configuration.
+// newS3Store wires an S3Store around a concrete S3 client.
+func newS3Store(client *s3.Client, options S3Options) *S3Store {
+	return &S3Store{
+		client:    client,
+		uploader:  newUploader(client, options),
+		presigner: s3.NewPresignClient(client),
+		options:   options,
+	}
+}
+
+// newUploader returns the multipart upload manager used by Upload, tuned by
+// the store's PartSize and Concurrency.
+func newUploader(client manager.UploadAPIClient, options S3Options) *manager.Uploader {
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = options.PartSize
+		u.Concurrency = options.Concurrency
+	})
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// acl returns the canned ACL for uploads: the configured ACL, or the one
+// implied by the store's visibility.
+func (s *S3Store) acl() types.ObjectCannedACL {
+	if s.options.ACL != "" {
+		return s.options.ACL
+	}
+	switch s.options.Visibility {
+	case S3VisibilityPublic:
+		return types.ObjectCannedACLPublicRead
+	case S3VisibilityPrivate:
+		return types.ObjectCannedACLPrivate
+	}
+	return ""
+}
+
+// NewS3FromConfig initializes an S3Store using an AWS configuration, applying
+// the Endpoint and Region of options when set.
 func NewS3FromConfig(cfg aws.Config, options S3Options) (*S3Store, error) {
+	if err := validateEndpoint(options.Endpoint); err != nil {
+		return nil, err
+	}
 	client := s3.NewFromConfig(cfg, func(opt *s3.Options) {
 		opt.UsePathStyle = options.UsePathStyle
+		if options.Endpoint != "" {
+			opt.BaseEndpoint = aws.String(options.Endpoint)
+		}
+		if options.Region != "" {
+			opt.Region = options.Region
+		}
 		if options.DebugMode {
 			opt.ClientLogMode = aws.LogSigning | aws.LogRequest | aws.LogResponseWithBody
 		}
 	})
-	return &S3Store{client, options}, nil
+	return newS3Store(client, options), nil
 }
 
 // NewS3FromEnvironment initializes an S3Store from the environment configuration.
@@ -50,54 +226,319 @@ func NewS3FromEnvironment(options S3Options) (*S3Store, error) {
 	return NewS3FromConfig(cfg, options)
 }
 
-// NewS3FromClient initializes an S3Store from an existing S3 client.
+// NewS3FromClient initializes an S3Store from an existing S3 client. The
+// client's own endpoint and region are used for requests; set
+// options.Endpoint to match a custom endpoint so Path builds URLs on it.
 func NewS3FromClient(client *s3.Client, options S3Options) (*S3Store, error) {
-	return &S3Store{client, options}, nil
+	if err := validateEndpoint(options.Endpoint); err != nil {
+		return nil, err
+	}
+	return newS3Store(client, options), nil
+}
+
+// validateEndpoint checks that a non-empty S3Options.Endpoint is an absolute
+// URL.
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid S3 endpoint %q: an absolute URL is required", endpoint)
+	}
+	return nil
+}
+
+// sanitizeS3Key removes characters that would have to be percent-encoded in a
+// URL. Whitespace becomes '-', and everything outside the S3 "safe characters"
+// set (ASCII letters and digits plus / ! - _ . * ' ( and )) is dropped.
+func sanitizeS3Key(key string) string {
+	var b strings.Builder
+	b.Grow(len(key))
+	for _, r := range key {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteByte('-')
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case strings.ContainsRune("/!-_.*'()", r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// applyBucketProfile fills input with the defaults from profile, keeping any
+// metadata already set on input.
+func applyBucketProfile(input *s3.PutObjectInput, profile BucketProfile) {
+	if profile.ACL != "" {
+		input.ACL = profile.ACL
+	}
+	applyStorageSettings(input, profile.StorageClass, profile.ServerSideEncryption, profile.SSEKMSKeyID)
+	if profile.CacheControl != "" {
+		input.CacheControl = aws.String(profile.CacheControl)
+	}
+	input.Metadata = GFileMux.MergeMetadata(profile.Metadata, input.Metadata)
+}
+
+// applyStorageSettings sets the storage class and server-side encryption of
+// input, keeping its current values for empty arguments. A KMS key ID without
+// an encryption mode selects aws:kms.
+func applyStorageSettings(input *s3.PutObjectInput, class types.StorageClass, sse types.ServerSideEncryption, kmsKeyID string) {
+	if class != "" {
+		input.StorageClass = class
+	}
+	if kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(kmsKeyID)
+		if sse == "" {
+			sse = types.ServerSideEncryptionAwsKms
+		}
+	}
+	if sse != "" {
+		input.ServerSideEncryption = sse
+		if kmsKeyID == "" && sse == types.ServerSideEncryptionAes256 {
+			input.SSEKMSKeyId = nil // an inherited key is invalid without KMS
+		}
+	}
+}
+
+// isMissingObjectLock reports whether err is S3's rejection of an object-lock
+// upload to a bucket without Object Lock configured.
+func isMissingObjectLock(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "InvalidRequest" &&
+		strings.Contains(apiErr.ErrorMessage(), "Object Lock")
+}
+
+// notFoundError wraps err with fs.ErrNotExist when S3 reports that the object
+// does not exist, so callers can detect it without depending on smithy.
+func notFoundError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+// escapeKeyPath percent-encodes each "/"-separated segment of key so it can be
+// embedded in a URL path while keeping the separators intact.
+func escapeKeyPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
 }
 
 // Upload uploads a file to S3 with the given options.
 func (s *S3Store) Upload(ctx context.Context, r io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
-	if options == nil {
-		return nil, errors.New("upload options are required")
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, err
 	}
-	if len(strings.TrimSpace(options.Bucket)) == 0 {
+	if options.Bucket == "" {
 		return nil, errors.New("please provide a valid S3 bucket")
 	}
+	if (options.ObjectLockMode == "") != (options.RetainUntil == nil) {
+		return nil, errors.New("ObjectLockMode and RetainUntil must be set together")
+	}
+	if options.RetainUntil != nil && !options.RetainUntil.After(time.Now()) {
+		return nil, fmt.Errorf("RetainUntil %s is not in the future", options.RetainUntil.Format(time.RFC3339))
+	}
 
-	// Buffer the reader so we can compute the size and seek back for upload.
-	b := new(bytes.Buffer)
-	r = io.TeeReader(r, b)
-	n, err := io.Copy(io.Discard, r)
-	if err != nil {
-		return nil, err
+	// The upload manager streams the body: small files go up with a single
+	// PutObject and larger ones as a multipart upload, holding only the parts
+	// in flight in memory. The size is counted as the body is read, and a
+	// known size is sent as the ContentLength of single-part uploads.
+	body := &countingReader{r: r}
+
+	key := options.FileName
+	if s.options.SanitizeKeys {
+		key = sanitizeS3Key(key)
+		if key == "" {
+			return nil, fmt.Errorf("file name %q is empty after sanitization", options.FileName)
+		}
 	}
 
-	seeker, err := utils.ReaderToSeeker(b)
-	if err != nil {
-		return nil, err
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(options.Bucket),
+		Metadata:     GFileMux.MergeMetadata(options.Metadata),
+		Key:          aws.String(key),
+		ACL:          s.acl(),
+		Body:         body,
+		RequestPayer: s.options.RequestPayer,
+	}
+	applyStorageSettings(input, s.options.StorageClass, s.options.ServerSideEncryption, s.options.SSEKMSKeyID)
+	if profile, ok := s.options.BucketProfiles[options.Bucket]; ok {
+		applyBucketProfile(input, profile)
+	}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+	if options.Size > 0 {
+		input.ContentLength = aws.Int64(options.Size)
+	}
+	if options.ObjectLockMode != "" {
+		input.ObjectLockMode = types.ObjectLockMode(options.ObjectLockMode)
+		input.ObjectLockRetainUntilDate = options.RetainUntil
 	}
 
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:   aws.String(options.Bucket),
-		Metadata: options.Metadata,
-		Key:      aws.String(options.FileName),
-		ACL:      s.options.ACL,
-		Body:     seeker,
-	})
+	s.debug(ctx, "S3 upload started", "bucket", options.Bucket, "key", key)
+	_, err = s.uploader.Upload(ctx, input)
 	if err != nil {
+		if options.ObjectLockMode != "" && isMissingObjectLock(err) {
+			err = fmt.Errorf("bucket %q does not have S3 Object Lock enabled: %w", options.Bucket, err)
+		}
+		s.debug(ctx, "S3 upload failed", "bucket", options.Bucket, "key", key, "error", err)
 		return nil, &GFileMux.StorageError{Backend: "s3", Op: "Upload", Err: err}
 	}
+	s.debug(ctx, "S3 upload finished", "bucket", options.Bucket, "key", key, "size", body.n)
 
 	return &GFileMux.UploadedFileMetadata{
 		FolderDestination: options.Bucket,
-		Size:              n,
-		Key:               options.FileName,
+		Size:              body.n,
+		Key:               key,
 	}, nil
 }
 
+// Capabilities reports that every S3 upload must name a bucket.
+func (s *S3Store) Capabilities() GFileMux.StorageCapabilities {
+	return GFileMux.StorageCapabilities{RequiresBucket: true}
+}
+
+// Open streams an object from S3. The content type and size come from the
+// GetObject response.
+func (s *S3Store) Open(ctx context.Context, bucket, key string) (io.ReadCloser, *GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bucket == "" {
+		return nil, nil, fmt.Errorf("bucket is required")
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		RequestPayer: s.options.RequestPayer,
+	})
+	if err != nil {
+		return nil, nil, &GFileMux.StorageError{Backend: "s3", Op: "Open", Err: notFoundError(err)}
+	}
+	return out.Body, &GFileMux.UploadedFileMetadata{
+		FolderDestination: bucket,
+		Key:               key,
+		Size:              aws.ToInt64(out.ContentLength),
+		ContentType:       aws.ToString(out.ContentType),
+		Metadata:          out.Metadata,
+		ModTime:           aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// List returns the objects in options.Bucket whose keys start with
+// options.Prefix via ListObjectsV2, following continuation tokens until
+// options.Limit objects are found or the listing ends.
+func (s *S3Store) List(ctx context.Context, options GFileMux.ListOptions) ([]GFileMux.UploadedFileMetadata, error) {
+	bucket := strings.TrimSpace(options.Bucket)
+	if bucket == "" {
+		return nil, errors.New("please provide a valid S3 bucket")
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:       aws.String(bucket),
+		RequestPayer: s.options.RequestPayer,
+	}
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	var files []GFileMux.UploadedFileMetadata
+	for {
+		if options.Limit > 0 {
+			// S3 caps each page at 1000 keys whatever is asked for.
+			input.MaxKeys = aws.Int32(int32(min(options.Limit-len(files), 1000)))
+		}
+		page, err := s.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, &GFileMux.StorageError{Backend: "s3", Op: "List", Err: err}
+		}
+		for _, obj := range page.Contents {
+			files = append(files, GFileMux.UploadedFileMetadata{
+				FolderDestination: bucket,
+				Key:               aws.ToString(obj.Key),
+				Size:              aws.ToInt64(obj.Size),
+				ModTime:           aws.ToTime(obj.LastModified),
+			})
+		}
+		if options.Limit > 0 && len(files) >= options.Limit {
+			return files[:options.Limit], nil
+		}
+		if !aws.ToBool(page.IsTruncated) || aws.ToString(page.NextContinuationToken) == "" {
+			return files, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// Stat returns an object's size, content type and user metadata via HeadObject.
+func (s *S3Store) Stat(ctx context.Context, bucket, key string) (*GFileMux.UploadedFileMetadata, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		RequestPayer: s.options.RequestPayer,
+	})
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "s3", Op: "Stat", Err: notFoundError(err)}
+	}
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: bucket,
+		Key:               key,
+		Size:              aws.ToInt64(out.ContentLength),
+		ContentType:       aws.ToString(out.ContentType),
+		Metadata:          out.Metadata,
+		ModTime:           aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// Exists reports whether an object is stored under key, via HeadObject.
+func (s *S3Store) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	return statExists(s.Stat(ctx, bucket, key))
+}
+
+// presignExpiry resolves the lifetime of a presigned URL: the requested one,
+// or the store default when requested is zero.
+func (s *S3Store) presignExpiry(requested time.Duration) (time.Duration, error) {
+	switch {
+	case requested < 0:
+		return 0, fmt.Errorf("presign expiration %s must be positive", requested)
+	case requested > MaxPresignExpiry:
+		return 0, fmt.Errorf("presign expiration %s exceeds the S3 maximum of %s", requested, MaxPresignExpiry)
+	case requested > 0:
+		return requested, nil
+	}
+	expiry := s.options.PresignExpiry
+	if expiry <= 0 {
+		expiry = DefaultPresignExpiry
+	}
+	return min(expiry, MaxPresignExpiry), nil
+}
+
 // Path generates a URL to access a file in S3, either a presigned URL or a direct URL.
+// Private stores always presign; otherwise options.IsSecure requests a presigned URL.
 func (s *S3Store) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
-	if !options.IsSecure {
+	options, err := options.Normalized()
+	if err != nil {
+		return "", err
+	}
+	if !options.IsSecure && s.options.Visibility != S3VisibilityPrivate {
+		if s.options.Endpoint != "" {
+			return s.endpointURL(options.Bucket, options.Key), nil
+		}
 		resp, err := s.client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
 			Bucket: &options.Bucket,
 		})
@@ -105,33 +546,144 @@ func (s *S3Store) Path(ctx context.Context, options GFileMux.PathOptions) (strin
 			return "", fmt.Errorf("failed to get bucket location: %w", err)
 		}
 
-		region := string(resp.LocationConstraint)
-		if region == "" {
-			region = "us-east-1"
-		}
-		url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", options.Bucket, region, options.Key)
-		return url, nil
+		return s.awsURL(options.Bucket, bucketRegion(resp.LocationConstraint), options.Key), nil
 	}
 
-	presignClient := s3.NewPresignClient(s.client)
-	presignRequest, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: &options.Bucket,
-		Key:    &options.Key,
-	}, s3.WithPresignExpires(options.ExpirationTime))
+	expiry, err := s.presignExpiry(options.ExpirationTime)
+	if err != nil {
+		return "", err
+	}
+	presignRequest, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:       &options.Bucket,
+		Key:          &options.Key,
+		RequestPayer: s.options.RequestPayer,
+	}, s3.WithPresignExpires(expiry))
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
 	return presignRequest.URL, nil
 }
 
+// bucketRegion maps a GetBucketLocation constraint to its region: buckets in
+// us-east-1 report none, and old eu-west-1 buckets report "EU".
+func bucketRegion(constraint types.BucketLocationConstraint) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	}
+	return string(constraint)
+}
+
+// awsURL returns the direct URL of key in bucket on AWS, path-style or
+// virtual-hosted as UsePathStyle says. China regions live under the
+// amazonaws.com.cn domain.
+func (s *S3Store) awsURL(bucket, region, key string) string {
+	host := "s3." + region + ".amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		host += ".cn"
+	}
+	if s.options.UsePathStyle {
+		return fmt.Sprintf("https://%s/%s/%s", host, bucket, escapeKeyPath(key))
+	}
+	return fmt.Sprintf("https://%s.%s/%s", bucket, host, escapeKeyPath(key))
+}
+
+// PresignUpload returns a presigned PUT URL that lets a client upload
+// options.Key to options.Bucket directly, valid for options.ExpirationTime or
+// PresignExpiry, and the headers the client must send with it. The object gets
+// the store's ACL, encryption and storage class, and the bucket's profile, as
+// an Upload would; SanitizeKeys applies to the key.
+func (s *S3Store) PresignUpload(ctx context.Context, options GFileMux.PresignUploadOptions) (string, http.Header, error) {
+	bucket, key, err := GFileMux.NormalizeLocation(options.Bucket, options.Key)
+	if err != nil {
+		return "", nil, err
+	}
+	if bucket == "" {
+		return "", nil, errors.New("please provide a valid S3 bucket")
+	}
+	if s.options.SanitizeKeys {
+		if key = sanitizeS3Key(key); key == "" {
+			return "", nil, fmt.Errorf("key %q is empty after sanitization", options.Key)
+		}
+	}
+	expiry, err := s.presignExpiry(options.ExpirationTime)
+	if err != nil {
+		return "", nil, err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		Metadata:     GFileMux.MergeMetadata(options.Metadata),
+		ACL:          s.acl(),
+		RequestPayer: s.options.RequestPayer,
+	}
+	applyStorageSettings(input, s.options.StorageClass, s.options.ServerSideEncryption, s.options.SSEKMSKeyID)
+	if profile, ok := s.options.BucketProfiles[bucket]; ok {
+		applyBucketProfile(input, profile)
+	}
+	if options.ContentType != "" {
+		input.ContentType = aws.String(options.ContentType)
+	}
+
+	req, err := s.presigner.PresignPutObject(ctx, input, s3.WithPresignExpires(expiry), signContentType(options.ContentType))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate presigned upload URL: %w", err)
+	}
+	header := req.SignedHeader.Clone()
+	header.Del("Host") // set by the client from the URL
+	return req.URL, header, nil
+}
+
+// signContentType puts contentType back on a presigned PutObject request
+// before it is signed. The SDK drops Content-Type from requests without a
+// body, which would let the client upload any type under the URL.
+func signContentType(contentType string) func(*s3.PresignOptions) {
+	return func(o *s3.PresignOptions) {
+		if contentType == "" {
+			return
+		}
+		o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Build.Add(middleware.BuildMiddlewareFunc("SignContentType", func(
+					ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+				) (middleware.BuildOutput, middleware.Metadata, error) {
+					if req, ok := in.Request.(*smithyhttp.Request); ok {
+						req.Header.Set("Content-Type", contentType)
+					}
+					return next.HandleBuild(ctx, in)
+				}), middleware.After)
+			})
+		})
+	}
+}
+
+// endpointURL returns the direct URL of key in bucket on the custom Endpoint,
+// path-style or virtual-hosted as UsePathStyle says.
+func (s *S3Store) endpointURL(bucket, key string) string {
+	u, _ := url.Parse(s.options.Endpoint) // checked by validateEndpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.options.UsePathStyle {
+		return fmt.Sprintf("%s://%s%s/%s/%s", u.Scheme, u.Host, base, bucket, escapeKeyPath(key))
+	}
+	return fmt.Sprintf("%s://%s.%s%s/%s", u.Scheme, bucket, u.Host, base, escapeKeyPath(key))
+}
+
 // Delete removes an object from S3 identified by bucket and key.
 func (s *S3Store) Delete(ctx context.Context, bucket, key string) error {
-	if bucket == "" || key == "" {
-		return fmt.Errorf("bucket and key are required")
+	bucket, key, err := GFileMux.NormalizeLocation(bucket, key)
+	if err != nil {
+		return err
+	}
+	if bucket == "" {
+		return fmt.Errorf("bucket is required")
 	}
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		RequestPayer: s.options.RequestPayer,
 	})
 	if err != nil {
 		return &GFileMux.StorageError{Backend: "s3", Op: "Delete", Err: err}
@@ -141,8 +693,11 @@ func (s *S3Store) Delete(ctx context.Context, bucket, key string) error {
 
 // Close closes the S3 store (no-op; AWS SDK manages its own connections).
 func (s *S3Store) Close() error {
-	if s.options.DebugMode {
-		log.Println("S3 store is being closed.")
-	}
+	s.debug(context.Background(), "S3 store is being closed")
 	return nil
 }
+
+// debug logs through the store's Logger; see debugLog.
+func (s *S3Store) debug(ctx context.Context, msg string, args ...any) {
+	debugLog(ctx, s.options.Logger, s.options.DebugMode, msg, args...)
+}
@@ -0,0 +1,891 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	GFileMux "github.com/ghulamazad/GFileMux"
+)
+
+// fakeS3Client is an in-memory stand-in for the S3 API used by S3Store.
+type fakeS3Client struct {
+	mu      sync.Mutex
+	region  types.BucketLocationConstraint
+	putObjs []*s3.PutObjectInput
+	delObjs []*s3.DeleteObjectInput
+	bodies  map[string][]byte
+	putErr  error
+
+	// uploads holds in-progress multipart uploads by upload ID.
+	uploads map[string]*fakeMultipartUpload
+	// partSizes records the size of each part uploaded, in order.
+	partSizes []int
+	// listCalls counts ListObjectsV2 requests; pageSize, when set, caps
+	// their pages below S3's 1000 keys.
+	listCalls int
+	pageSize  int
+}
+
+// fakeMultipartUpload is a multipart upload that has not been completed.
+type fakeMultipartUpload struct {
+	input *s3.CreateMultipartUploadInput
+	parts map[int32][]byte
+}
+
+func (f *fakeS3Client) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+	if f.bodies == nil {
+		f.bodies = make(map[string][]byte)
+	}
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.putObjs = append(f.putObjs, in)
+	f.bodies[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+// HeadObject mimics S3 by returning user metadata keys in lowercase.
+func (f *fakeS3Client) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	key := aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key)
+	for i := len(f.putObjs) - 1; i >= 0; i-- {
+		put := f.putObjs[i]
+		if aws.ToString(put.Bucket)+"/"+aws.ToString(put.Key) != key {
+			continue
+		}
+		meta := make(map[string]string, len(put.Metadata))
+		for k, v := range put.Metadata {
+			meta[strings.ToLower(k)] = v
+		}
+		return &s3.HeadObjectOutput{
+			ContentLength: aws.Int64(int64(len(f.bodies[key]))),
+			ContentType:   put.ContentType,
+			Metadata:      meta,
+		}, nil
+	}
+	return nil, &smithy.GenericAPIError{Code: "NotFound", Message: key}
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	key := aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key)
+	data, ok := f.bodies[key]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchKey", Message: key}
+	}
+	var contentType *string
+	for _, put := range f.putObjs {
+		if aws.ToString(put.Bucket)+"/"+aws.ToString(put.Key) == key {
+			contentType = put.ContentType
+		}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   contentType,
+	}, nil
+}
+
+func (f *fakeS3Client) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.delObjs = append(f.delObjs, in)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if f.putErr != nil {
+		return nil, f.putErr
+	}
+	if f.uploads == nil {
+		f.uploads = make(map[string]*fakeMultipartUpload)
+	}
+	id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[id] = &fakeMultipartUpload{input: in, parts: make(map[int32][]byte)}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3Client) UploadPart(ctx context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads[aws.ToString(in.UploadId)].parts[aws.ToInt32(in.PartNumber)] = data
+	f.partSizes = append(f.partSizes, len(data))
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", aws.ToInt32(in.PartNumber)))}, nil
+}
+
+// CompleteMultipartUpload assembles the parts and records the object as if it
+// had been sent with PutObject, so HeadObject and GetObject can find it.
+func (f *fakeS3Client) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	upload := f.uploads[aws.ToString(in.UploadId)]
+	delete(f.uploads, aws.ToString(in.UploadId))
+	var data []byte
+	for _, part := range in.MultipartUpload.Parts {
+		data = append(data, upload.parts[aws.ToInt32(part.PartNumber)]...)
+	}
+	if f.bodies == nil {
+		f.bodies = make(map[string][]byte)
+	}
+	f.putObjs = append(f.putObjs, &s3.PutObjectInput{
+		Bucket:       upload.input.Bucket,
+		Key:          upload.input.Key,
+		ACL:          upload.input.ACL,
+		ContentType:  upload.input.ContentType,
+		Metadata:     upload.input.Metadata,
+		StorageClass: upload.input.StorageClass,
+		CacheControl: upload.input.CacheControl,
+
+		ServerSideEncryption: upload.input.ServerSideEncryption,
+		SSEKMSKeyId:          upload.input.SSEKMSKeyId,
+	})
+	f.bodies[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = data
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3Client) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	delete(f.uploads, aws.ToString(in.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3Client) GetBucketLocation(ctx context.Context, in *s3.GetBucketLocationInput, _ ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	return &s3.GetBucketLocationOutput{LocationConstraint: f.region}, nil
+}
+
+// newFakeS3Store returns an S3Store backed by a fakeS3Client. Presigning uses a
+// real client with static credentials, which works without network access.
+// ListObjectsV2 pages through stored objects in key order, using the last key
+// of a page as its continuation token.
+func (f *fakeS3Client) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.listCalls++
+	scope := aws.ToString(in.Bucket) + "/"
+	var keys []string
+	for k := range f.bodies {
+		key, ok := strings.CutPrefix(k, scope)
+		if ok && strings.HasPrefix(key, aws.ToString(in.Prefix)) && key > aws.ToString(in.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	maxKeys := int(aws.ToInt32(in.MaxKeys))
+	if maxKeys == 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+	if f.pageSize > 0 {
+		maxKeys = min(maxKeys, f.pageSize)
+	}
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > maxKeys)}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		out.NextContinuationToken = aws.String(keys[maxKeys-1])
+	}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, types.Object{
+			Key:  aws.String(key),
+			Size: aws.Int64(int64(len(f.bodies[scope+key]))),
+		})
+	}
+	return out, nil
+}
+
+func newFakeS3Store(t *testing.T, options S3Options) (*S3Store, *fakeS3Client) {
+	t.Helper()
+	client := s3.New(s3.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	})
+	fake := &fakeS3Client{}
+	return &S3Store{
+		client:    fake,
+		uploader:  newUploader(fake, options),
+		presigner: s3.NewPresignClient(client),
+		options:   options,
+	}, fake
+}
+
+func TestS3Store_Path_EscapesKey(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+
+	path, err := store.Path(context.Background(), GFileMux.PathOptions{
+		Bucket: "bucket",
+		Key:    "dir/my file+1#2 résumé.pdf",
+	})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		t.Fatalf("returned URL does not parse: %v", err)
+	}
+	if u.Fragment != "" || u.RawQuery != "" {
+		t.Fatalf("key leaked into fragment/query: %q", path)
+	}
+	if u.Path != "/dir/my file+1#2 résumé.pdf" {
+		t.Errorf("unexpected decoded path %q", u.Path)
+	}
+	if !strings.HasPrefix(path, "https://bucket.s3.us-east-1.amazonaws.com/dir/") {
+		t.Errorf("separator should not be escaped: %q", path)
+	}
+}
+
+func TestS3Store_Path_DirectURL(t *testing.T) {
+	cases := []struct {
+		region    types.BucketLocationConstraint
+		pathStyle bool
+		want      string
+	}{
+		{"", false, "https://bucket.s3.us-east-1.amazonaws.com/a/b.txt"},
+		{"", true, "https://s3.us-east-1.amazonaws.com/bucket/a/b.txt"},
+		{"EU", false, "https://bucket.s3.eu-west-1.amazonaws.com/a/b.txt"},
+		{"us-gov-west-1", false, "https://bucket.s3.us-gov-west-1.amazonaws.com/a/b.txt"},
+		{"cn-north-1", false, "https://bucket.s3.cn-north-1.amazonaws.com.cn/a/b.txt"},
+		{"cn-northwest-1", true, "https://s3.cn-northwest-1.amazonaws.com.cn/bucket/a/b.txt"},
+	}
+	for _, tc := range cases {
+		store, fake := newFakeS3Store(t, S3Options{UsePathStyle: tc.pathStyle})
+		fake.region = tc.region
+		got, err := store.Path(context.Background(), GFileMux.PathOptions{Bucket: "bucket", Key: "a/b.txt"})
+		if err != nil {
+			t.Fatalf("Path: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("region %q, path-style %v: got %q, want %q", tc.region, tc.pathStyle, got, tc.want)
+		}
+	}
+}
+
+func TestS3Store_CustomEndpoint(t *testing.T) {
+	cfg := aws.Config{
+		Region:      "eu-central-1",
+		Credentials: credentials.NewStaticCredentialsProvider("minioadmin", "minioadmin", ""),
+	}
+	ctx := context.Background()
+	opts := GFileMux.PathOptions{Bucket: "uploads", Key: "dir/my file.txt"}
+
+	store, err := NewS3FromConfig(cfg, S3Options{Endpoint: "http://localhost:9000", Region: "us-east-1", UsePathStyle: true})
+	if err != nil {
+		t.Fatalf("NewS3FromConfig: %v", err)
+	}
+	if got, _ := store.Path(ctx, opts); got != "http://localhost:9000/uploads/dir/my%20file.txt" {
+		t.Errorf("path-style URL = %q", got)
+	}
+	secure := opts
+	secure.IsSecure = true
+	presigned, err := store.Path(ctx, secure)
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if !strings.HasPrefix(presigned, "http://localhost:9000/uploads/dir/my%20file.txt?") || !strings.Contains(presigned, "us-east-1") {
+		t.Errorf("expected a URL presigned on the endpoint in us-east-1, got %q", presigned)
+	}
+
+	store, _ = NewS3FromConfig(cfg, S3Options{Endpoint: "https://s3.wasabisys.com/"})
+	if got, _ := store.Path(ctx, opts); got != "https://uploads.s3.wasabisys.com/dir/my%20file.txt" {
+		t.Errorf("virtual-hosted URL = %q", got)
+	}
+
+	for _, endpoint := range []string{"localhost:9000", "/relative", "http://"} {
+		if _, err := NewS3FromConfig(cfg, S3Options{Endpoint: endpoint}); err == nil {
+			t.Errorf("expected endpoint %q to be rejected", endpoint)
+		}
+	}
+}
+
+func TestS3Store_PresignUpload(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{
+		ACL:         types.ObjectCannedACLPublicRead,
+		SSEKMSKeyID: "key-1",
+	})
+	var _ GFileMux.UploadPresigner = store
+
+	u, header, err := store.PresignUpload(context.Background(), GFileMux.PresignUploadOptions{
+		Bucket:         "uploads",
+		Key:            "videos/clip.mp4",
+		ContentType:    "video/mp4",
+		Metadata:       map[string]string{"owner": "42"},
+		ExpirationTime: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("PresignUpload: %v", err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("returned URL does not parse: %v", err)
+	}
+	if parsed.Path != "/uploads/videos/clip.mp4" && parsed.Path != "/videos/clip.mp4" {
+		t.Errorf("unexpected URL path %q", parsed.Path)
+	}
+	if q := parsed.Query(); q.Get("X-Amz-Expires") != "600" || q.Get("X-Amz-Signature") == "" {
+		t.Errorf("expected a URL signed for 600s, got %q", u)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":                 "video/mp4",
+		"X-Amz-Acl":                    "public-read",
+		"X-Amz-Meta-Owner":             "42",
+		"X-Amz-Server-Side-Encryption": "aws:kms",
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "key-1",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+	if header.Get("Host") != "" {
+		t.Error("the Host header should be left to the client")
+	}
+	// A signed Content-Type keeps the client from storing another type.
+	if signed := parsed.Query().Get("X-Amz-SignedHeaders"); !strings.Contains(signed, "content-type") {
+		t.Errorf("expected Content-Type to be signed, got %q", signed)
+	}
+
+	if _, _, err := store.PresignUpload(context.Background(), GFileMux.PresignUploadOptions{Key: "a"}); err == nil {
+		t.Error("expected an error without a bucket")
+	}
+}
+
+func TestS3Store_Path_PresignedEscapesKey(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+
+	path, err := store.Path(context.Background(), GFileMux.PathOptions{
+		Bucket:         "bucket",
+		Key:            "my file #1 ünïcode.txt",
+		IsSecure:       true,
+		ExpirationTime: 15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		t.Fatalf("presigned URL does not parse: %v", err)
+	}
+	if u.Fragment != "" {
+		t.Fatalf("key leaked into fragment: %q", path)
+	}
+	if u.Path != "/my file #1 ünïcode.txt" {
+		t.Errorf("unexpected decoded path %q", u.Path)
+	}
+}
+
+func TestS3Store_Upload_SanitizeKeys(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{SanitizeKeys: true})
+
+	meta, err := store.Upload(context.Background(), bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "my report+v2#final résumé.pdf",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	const want = "my-reportv2final-rsum.pdf"
+	if meta.Key != want {
+		t.Errorf("expected sanitized key %q, got %q", want, meta.Key)
+	}
+	if got := aws.ToString(fake.putObjs[0].Key); got != want {
+		t.Errorf("expected PutObject key %q, got %q", want, got)
+	}
+}
+
+func TestS3Store_Upload_KeepsKeyByDefault(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+
+	meta, err := store.Upload(context.Background(), bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "my file.txt",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if meta.Key != "my file.txt" {
+		t.Errorf("expected key to be left untouched, got %q", meta.Key)
+	}
+}
+
+func TestS3Store_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	store, _ := newFakeS3Store(t, S3Options{Logger: logger})
+
+	if _, err := store.Upload(context.Background(), bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "a.txt",
+	}); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	store.Close()
+
+	out := buf.String()
+	for _, want := range []string{`msg="S3 upload started" bucket=bucket key=a.txt`, `msg="S3 upload finished" bucket=bucket key=a.txt size=4`, `msg="S3 store is being closed"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected log %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestS3Store_Upload_SetsContentType(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+
+	_, err := store.Upload(context.Background(), bytes.NewReader([]byte("a,b\n")), &GFileMux.UploadFileOptions{
+		Bucket:      "bucket",
+		FileName:    "data.csv",
+		ContentType: "text/csv",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if got := aws.ToString(fake.putObjs[0].ContentType); got != "text/csv" {
+		t.Errorf("expected ContentType text/csv, got %q", got)
+	}
+}
+
+func TestS3Store_RequestPayer(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{RequestPayer: types.RequestPayerRequester})
+	ctx := context.Background()
+
+	_, err := store.Upload(ctx, bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "a.txt",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if got := fake.putObjs[0].RequestPayer; got != types.RequestPayerRequester {
+		t.Errorf("PutObject RequestPayer = %q, want requester", got)
+	}
+
+	if err := store.Delete(ctx, "bucket", "a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := fake.delObjs[0].RequestPayer; got != types.RequestPayerRequester {
+		t.Errorf("DeleteObject RequestPayer = %q, want requester", got)
+	}
+
+	path, err := store.Path(ctx, GFileMux.PathOptions{
+		Bucket:         "bucket",
+		Key:            "a.txt",
+		IsSecure:       true,
+		ExpirationTime: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if !strings.Contains(path, "x-amz-request-payer") {
+		t.Errorf("presigned URL should sign the request-payer header: %s", path)
+	}
+}
+
+func TestS3Store_Upload_ObjectLock(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+	until := time.Now().Add(24 * time.Hour)
+
+	_, err := store.Upload(context.Background(), bytes.NewReader([]byte("data")), &GFileMux.UploadFileOptions{
+		Bucket:         "bucket",
+		FileName:       "record.pdf",
+		ObjectLockMode: GFileMux.ObjectLockCompliance,
+		RetainUntil:    &until,
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	in := fake.putObjs[0]
+	if in.ObjectLockMode != types.ObjectLockModeCompliance {
+		t.Errorf("ObjectLockMode = %q, want COMPLIANCE", in.ObjectLockMode)
+	}
+	if in.ObjectLockRetainUntilDate == nil || !in.ObjectLockRetainUntilDate.Equal(until) {
+		t.Errorf("ObjectLockRetainUntilDate = %v, want %v", in.ObjectLockRetainUntilDate, until)
+	}
+}
+
+func TestS3Store_Upload_ObjectLockValidation(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	cases := map[string]*GFileMux.UploadFileOptions{
+		"mode without date": {Bucket: "b", FileName: "a", ObjectLockMode: GFileMux.ObjectLockGovernance},
+		"date without mode": {Bucket: "b", FileName: "a", RetainUntil: &future},
+		"date in the past":  {Bucket: "b", FileName: "a", ObjectLockMode: GFileMux.ObjectLockGovernance, RetainUntil: &past},
+	}
+	for name, opts := range cases {
+		if _, err := store.Upload(context.Background(), bytes.NewReader([]byte("x")), opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestS3Store_Upload_ObjectLockNotEnabled(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+	fake.putErr = &smithy.GenericAPIError{
+		Code:    "InvalidRequest",
+		Message: "Bucket is missing Object Lock Configuration",
+	}
+	until := time.Now().Add(time.Hour)
+
+	_, err := store.Upload(context.Background(), bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{
+		Bucket:         "plain-bucket",
+		FileName:       "a.txt",
+		ObjectLockMode: GFileMux.ObjectLockGovernance,
+		RetainUntil:    &until,
+	})
+	var se *GFileMux.StorageError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *StorageError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "does not have S3 Object Lock enabled") {
+		t.Errorf("expected a clear object-lock error, got %v", err)
+	}
+}
+
+func TestS3Store_Visibility(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name      string
+		options   S3Options
+		wantACL   types.ObjectCannedACL
+		presigned bool
+	}{
+		{"default", S3Options{}, "", false},
+		{"public", S3Options{Visibility: S3VisibilityPublic}, types.ObjectCannedACLPublicRead, false},
+		{"private", S3Options{Visibility: S3VisibilityPrivate}, types.ObjectCannedACLPrivate, true},
+		{"explicit ACL wins", S3Options{Visibility: S3VisibilityPublic, ACL: types.ObjectCannedACLAuthenticatedRead}, types.ObjectCannedACLAuthenticatedRead, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, fake := newFakeS3Store(t, tc.options)
+			_, err := store.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "bucket", FileName: "a.txt"})
+			if err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+			if got := fake.putObjs[0].ACL; got != tc.wantACL {
+				t.Errorf("ACL = %q, want %q", got, tc.wantACL)
+			}
+
+			path, err := store.Path(ctx, GFileMux.PathOptions{Bucket: "bucket", Key: "a.txt", ExpirationTime: time.Minute})
+			if err != nil {
+				t.Fatalf("Path: %v", err)
+			}
+			if got := strings.Contains(path, "X-Amz-Signature"); got != tc.presigned {
+				t.Errorf("presigned = %v, want %v: %s", got, tc.presigned, path)
+			}
+		})
+	}
+}
+
+func TestS3Store_Open(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+	ctx := context.Background()
+	_, err := store.Upload(ctx, bytes.NewReader([]byte("a,b\n")), &GFileMux.UploadFileOptions{
+		Bucket:      "bucket",
+		FileName:    "data.csv",
+		ContentType: "text/csv",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	rc, meta, err := store.Open(ctx, "bucket", "data.csv")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "a,b\n" || meta.Size != 4 || meta.ContentType != "text/csv" {
+		t.Errorf("unexpected content %q / metadata %+v", data, meta)
+	}
+
+	if _, _, err := store.Open(ctx, "bucket", "missing.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for a missing object, got %v", err)
+	}
+	if _, err := store.Stat(ctx, "bucket", "missing.csv"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist from Stat, got %v", err)
+	}
+}
+
+func TestS3Store_Upload_BucketProfile(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{
+		ACL: types.ObjectCannedACLPrivate,
+		BucketProfiles: map[string]BucketProfile{
+			"assets": {
+				ACL:                  types.ObjectCannedACLPublicRead,
+				StorageClass:         types.StorageClassStandardIa,
+				ServerSideEncryption: types.ServerSideEncryptionAes256,
+				CacheControl:         "public, max-age=31536000",
+				Metadata:             map[string]string{"team": "web", "tier": "cold"},
+			},
+		},
+	})
+	ctx := context.Background()
+
+	_, err := store.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{
+		Bucket:   "assets",
+		FileName: "logo.png",
+		Metadata: map[string]string{"tier": "hot"},
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	in := fake.putObjs[0]
+	if in.ACL != types.ObjectCannedACLPublicRead || in.StorageClass != types.StorageClassStandardIa ||
+		in.ServerSideEncryption != types.ServerSideEncryptionAes256 ||
+		aws.ToString(in.CacheControl) != "public, max-age=31536000" {
+		t.Errorf("profile not applied: %+v", in)
+	}
+	if in.Metadata["team"] != "web" || in.Metadata["tier"] != "hot" {
+		t.Errorf("expected merged metadata with upload values winning, got %v", in.Metadata)
+	}
+
+	// Buckets without a profile keep the store defaults.
+	store.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "other", FileName: "a"})
+	if in := fake.putObjs[1]; in.ACL != types.ObjectCannedACLPrivate || in.StorageClass != "" || in.CacheControl != nil {
+		t.Errorf("unexpected defaults for unprofiled bucket: %+v", in)
+	}
+}
+
+func TestS3Store_Upload_EncryptionAndStorageClass(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{
+		SSEKMSKeyID:  "arn:aws:kms:eu-west-1:111122223333:key/abc",
+		StorageClass: types.StorageClassIntelligentTiering,
+		PartSize:     5 << 20,
+		BucketProfiles: map[string]BucketProfile{
+			"public": {ServerSideEncryption: types.ServerSideEncryptionAes256},
+		},
+	})
+	ctx := context.Background()
+
+	// A single PutObject and a multipart upload both carry the settings.
+	for _, size := range []int{1, 6 << 20} {
+		if _, err := store.Upload(ctx, bytes.NewReader(make([]byte, size)), &GFileMux.UploadFileOptions{Bucket: "records", FileName: "a"}); err != nil {
+			t.Fatalf("Upload of %d bytes: %v", size, err)
+		}
+		in := fake.putObjs[len(fake.putObjs)-1]
+		if in.ServerSideEncryption != types.ServerSideEncryptionAwsKms ||
+			aws.ToString(in.SSEKMSKeyId) != "arn:aws:kms:eu-west-1:111122223333:key/abc" ||
+			in.StorageClass != types.StorageClassIntelligentTiering {
+			t.Errorf("%d bytes: expected aws:kms with the key and INTELLIGENT_TIERING, got %q %q %q",
+				size, in.ServerSideEncryption, aws.ToString(in.SSEKMSKeyId), in.StorageClass)
+		}
+	}
+
+	// A profile's encryption wins, and drops the store's KMS key.
+	store.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{Bucket: "public", FileName: "a"})
+	in := fake.putObjs[len(fake.putObjs)-1]
+	if in.ServerSideEncryption != types.ServerSideEncryptionAes256 || in.SSEKMSKeyId != nil ||
+		in.StorageClass != types.StorageClassIntelligentTiering {
+		t.Errorf("expected AES256 without a KMS key and the store's storage class, got %+v", in)
+	}
+}
+
+func TestS3Store_Upload_CountsSize(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+
+	// A reader with no Len, and no size hint, as from a streamed part.
+	src := io.MultiReader(strings.NewReader("stre"), strings.NewReader("amed"))
+	meta, err := store.Upload(context.Background(), src, &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "a.txt",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if meta.Size != 8 {
+		t.Errorf("Size = %d, want 8", meta.Size)
+	}
+	if got := string(fake.bodies["bucket/a.txt"]); got != "streamed" {
+		t.Errorf("unexpected body %q", got)
+	}
+}
+
+func TestS3Store_Upload_SendsKnownSize(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+
+	src := io.MultiReader(strings.NewReader("stre"), strings.NewReader("amed"))
+	_, err := store.Upload(context.Background(), src, &GFileMux.UploadFileOptions{
+		Bucket:   "bucket",
+		FileName: "a.txt",
+		Size:     8,
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if got := aws.ToInt64(fake.putObjs[0].ContentLength); got != 8 {
+		t.Errorf("expected ContentLength 8, got %d", got)
+	}
+}
+
+func TestS3Store_Upload_Multipart(t *testing.T) {
+	const partSize = 5 << 20 // the S3 minimum
+	store, fake := newFakeS3Store(t, S3Options{PartSize: partSize, Concurrency: 2})
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*partSize+partSize/2)/16)
+	meta, err := store.Upload(context.Background(), io.MultiReader(bytes.NewReader(data)), &GFileMux.UploadFileOptions{
+		Bucket:      "bucket",
+		FileName:    "big.bin",
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if meta.Size != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", meta.Size, len(data))
+	}
+	if len(fake.partSizes) != 3 {
+		t.Errorf("uploaded %d parts, want 3", len(fake.partSizes))
+	}
+	if !bytes.Equal(fake.bodies["bucket/big.bin"], data) {
+		t.Error("assembled object does not match the uploaded data")
+	}
+	if got := aws.ToString(fake.putObjs[0].ContentType); got != "application/octet-stream" {
+		t.Errorf("ContentType = %q", got)
+	}
+}
+
+func TestS3Store_Path_PresignExpiry(t *testing.T) {
+	ctx := context.Background()
+	expires := func(t *testing.T, path string) string {
+		t.Helper()
+		u, err := url.Parse(path)
+		if err != nil {
+			t.Fatalf("presigned URL does not parse: %v", err)
+		}
+		return u.Query().Get("X-Amz-Expires")
+	}
+
+	cases := []struct {
+		name      string
+		storeTTL  time.Duration
+		requested time.Duration
+		want      string
+		wantErr   bool
+	}{
+		{"zero uses default", 0, 0, "900", false},
+		{"zero uses store default", time.Hour, 0, "3600", false},
+		{"store default is clamped", 30 * 24 * time.Hour, 0, "604800", false},
+		{"normal", 0, 5 * time.Minute, "300", false},
+		{"over max", 0, 8 * 24 * time.Hour, "", true},
+		{"negative", 0, -time.Minute, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, _ := newFakeS3Store(t, S3Options{PresignExpiry: tc.storeTTL})
+			path, err := store.Path(ctx, GFileMux.PathOptions{
+				Bucket:         "bucket",
+				Key:            "a.txt",
+				IsSecure:       true,
+				ExpirationTime: tc.requested,
+			})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Path: %v", err)
+			}
+			if got := expires(t, path); got != tc.want {
+				t.Errorf("X-Amz-Expires = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestS3Store_MetadataRoundTrip(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{
+		BucketProfiles: map[string]BucketProfile{
+			"docs": {Metadata: map[string]string{"Team": "web", "retention": "1y"}},
+		},
+	})
+	ctx := context.Background()
+
+	_, err := store.Upload(ctx, bytes.NewReader([]byte("x")), &GFileMux.UploadFileOptions{
+		Bucket:   "docs",
+		FileName: "a.txt",
+		Metadata: map[string]string{"Original-Name": "A.txt", "team": "platform"},
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	meta, err := store.Stat(ctx, "docs", "a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	want := map[string]string{"team": "platform", "retention": "1y", "original-name": "A.txt"}
+	if len(meta.Metadata) != len(want) {
+		t.Fatalf("expected %v, got %v", want, meta.Metadata)
+	}
+	for k, v := range want {
+		if meta.Metadata[k] != v {
+			t.Errorf("metadata[%q] = %q, want %q", k, meta.Metadata[k], v)
+		}
+	}
+	if meta.Size != 1 {
+		t.Errorf("expected size 1, got %d", meta.Size)
+	}
+
+	if _, err := store.Stat(ctx, "docs", "missing.txt"); err == nil {
+		t.Error("expected error for a missing object")
+	}
+}
+
+func TestS3Store_Capabilities(t *testing.T) {
+	store, _ := newFakeS3Store(t, S3Options{})
+	if !store.Capabilities().RequiresBucket {
+		t.Error("expected S3 to require a bucket")
+	}
+}
+
+func TestS3Store_List(t *testing.T) {
+	store, fake := newFakeS3Store(t, S3Options{})
+	fake.bodies = map[string][]byte{
+		"docs/users/1/a.txt":  []byte("a"),
+		"docs/users/1/b.txt":  []byte("bb"),
+		"docs/users/2/c.txt":  []byte("ccc"),
+		"other/users/1/d.txt": []byte("d"),
+	}
+
+	files, err := store.List(context.Background(), GFileMux.ListOptions{Bucket: "docs", Prefix: "users/1/"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 2 || files[0].Key != "users/1/a.txt" || files[1].Size != 2 || files[1].FolderDestination != "docs" {
+		t.Errorf("unexpected listing %+v", files)
+	}
+
+	fake.listCalls = 0
+	files, err = store.List(context.Background(), GFileMux.ListOptions{Bucket: "docs", Limit: 2})
+	if err != nil || len(files) != 2 {
+		t.Fatalf("List with Limit: %+v, %v", files, err)
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("expected the limit to be sent as MaxKeys, got %d requests", fake.listCalls)
+	}
+
+	fake.listCalls, fake.pageSize = 0, 1
+	files, err = store.List(context.Background(), GFileMux.ListOptions{Bucket: "docs"})
+	if err != nil || len(files) != 3 || fake.listCalls != 3 {
+		t.Errorf("expected 3 files over 3 pages, got %d files in %d requests, %v", len(files), fake.listCalls, err)
+	}
+
+	if _, err := store.List(context.Background(), GFileMux.ListOptions{}); err == nil {
+		t.Error("expected an error without a bucket")
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ghulamazad/GFileMux"
+)
+
+// WriterFactory returns the destination for one upload, described by options.
+// The writer is closed once the file has been copied to it; an error from
+// Close fails the upload, so writers that commit on Close can report it.
+type WriterFactory func(ctx context.Context, options GFileMux.UploadFileOptions) (io.WriteCloser, error)
+
+// WriterStorage is a generic sink that writes each upload to a writer obtained
+// from a WriterFactory, e.g. a message queue producer, a log, or a transform
+// feeding another system. Files cannot be read back: Path and Delete return an
+// error wrapping errors.ErrUnsupported, and WriterStorage does not implement
+// Opener.
+type WriterStorage struct {
+	factory WriterFactory
+}
+
+// NewWriterStorage wraps factory as a Storage backend.
+func NewWriterStorage(factory WriterFactory) (*WriterStorage, error) {
+	if factory == nil {
+		return nil, fmt.Errorf("writer factory is required")
+	}
+	return &WriterStorage{factory: factory}, nil
+}
+
+// Upload copies the file to a new writer from the factory and closes it.
+func (s *WriterStorage) Upload(ctx context.Context, r io.Reader, options *GFileMux.UploadFileOptions) (*GFileMux.UploadedFileMetadata, error) {
+	options, err := options.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := s.factory(ctx, *options)
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "writer", Op: "Upload", Err: err}
+	}
+	n, err := io.Copy(w, contextReader{ctx, r})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, &GFileMux.StorageError{Backend: "writer", Op: "Upload", Err: err}
+	}
+
+	return &GFileMux.UploadedFileMetadata{
+		FolderDestination: options.Bucket,
+		Size:              n,
+		Key:               options.FileName,
+	}, nil
+}
+
+// Path is not supported: written files have no location to return.
+func (s *WriterStorage) Path(ctx context.Context, options GFileMux.PathOptions) (string, error) {
+	return "", &GFileMux.StorageError{Backend: "writer", Op: "Path", Err: errors.ErrUnsupported}
+}
+
+// Delete is not supported: written files cannot be recalled.
+func (s *WriterStorage) Delete(ctx context.Context, bucket, key string) error {
+	return &GFileMux.StorageError{Backend: "writer", Op: "Delete", Err: errors.ErrUnsupported}
+}
+
+// Close is a no-op for WriterStorage.
+func (s *WriterStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	GFileMux "github.com/ghulamazad/GFileMux"
+)
+
+// bufferCloser is an in-memory WriteCloser that can fail on Close.
+type bufferCloser struct {
+	bytes.Buffer
+	closed   bool
+	closeErr error
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return b.closeErr
+}
+
+func TestWriterStorage_Upload(t *testing.T) {
+	var (
+		sink *bufferCloser
+		got  GFileMux.UploadFileOptions
+	)
+	store, err := NewWriterStorage(func(ctx context.Context, options GFileMux.UploadFileOptions) (io.WriteCloser, error) {
+		got = options
+		sink = &bufferCloser{}
+		return sink, nil
+	})
+	if err != nil {
+		t.Fatalf("NewWriterStorage: %v", err)
+	}
+
+	meta, err := store.Upload(context.Background(), strings.NewReader("payload"), &GFileMux.UploadFileOptions{
+		Bucket:      "events",
+		FileName:    "a.json",
+		ContentType: "application/json",
+	})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if sink.String() != "payload" || !sink.closed {
+		t.Errorf("expected the payload written and the writer closed, got %q closed=%v", sink.String(), sink.closed)
+	}
+	if got.FileName != "a.json" || got.ContentType != "application/json" {
+		t.Errorf("factory received unexpected options %+v", got)
+	}
+	if meta.Key != "a.json" || meta.FolderDestination != "events" || meta.Size != 7 {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+
+	if _, err := store.Path(context.Background(), GFileMux.PathOptions{Key: "a.json"}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Path: expected errors.ErrUnsupported, got %v", err)
+	}
+}
+
+func TestWriterStorage_Upload_CloseError(t *testing.T) {
+	closeErr := errors.New("commit failed")
+	store, _ := NewWriterStorage(func(ctx context.Context, options GFileMux.UploadFileOptions) (io.WriteCloser, error) {
+		return &bufferCloser{closeErr: closeErr}, nil
+	})
+
+	_, err := store.Upload(context.Background(), strings.NewReader("payload"), &GFileMux.UploadFileOptions{FileName: "a.json"})
+	var se *GFileMux.StorageError
+	if !errors.As(err, &se) || !errors.Is(err, closeErr) {
+		t.Fatalf("expected a StorageError wrapping the Close error, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package GFileMux
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	got := MergeMetadata(
+		map[string]string{"Team": "web", "tier": "cold"},
+		nil,
+		map[string]string{"team": "platform"},
+	)
+	if len(got) != 2 || got["team"] != "platform" || got["tier"] != "cold" {
+		t.Errorf("unexpected merge result %v", got)
+	}
+	if MergeMetadata(nil, map[string]string{}) != nil {
+		t.Error("expected nil when there is nothing to merge")
+	}
+}
+
+func TestNormalizeLocation(t *testing.T) {
+	bucket, key, err := NormalizeLocation(" avatars\n", "\tphoto.png ")
+	if err != nil || bucket != "avatars" || key != "photo.png" {
+		t.Errorf("NormalizeLocation = %q, %q, %v; want %q, %q, nil", bucket, key, err, "avatars", "photo.png")
+	}
+	if _, _, err := NormalizeLocation("avatars", "  "); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey for a blank key, got %v", err)
+	}
+
+	opts := &UploadFileOptions{Bucket: "b ", FileName: " a.txt", ContentType: "text/plain"}
+	n, err := opts.Normalized()
+	if err != nil || n.Bucket != "b" || n.FileName != "a.txt" || n.ContentType != "text/plain" {
+		t.Errorf("Normalized = %+v, %v", n, err)
+	}
+	if opts.FileName != " a.txt" {
+		t.Error("Normalized should not modify the receiver")
+	}
+	if _, err := (*UploadFileOptions)(nil).Normalized(); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("expected ErrEmptyKey for nil options, got %v", err)
+	}
+}
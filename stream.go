@@ -0,0 +1,282 @@
+package GFileMux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// spoolReason explains why streamed parts must be buffered to a temporary file
+// before they are stored, or returns "" when they can go to storage directly.
+func (gfm *GFileMux) spoolReason() string {
+	switch {
+	case storageCapabilities(gfm.storage).RequiresSeekableReader:
+		return "storage backend requires a seekable reader"
+	case gfm.hasContentValidation() && !gfm.postStoreValidation:
+		return "content validators read files before they are stored"
+	case gfm.needsChecksum():
+		return "checksums are computed before files are stored"
+	case gfm.contentTypeDetector != nil:
+		return "the content type detector needs a seekable reader"
+	}
+	return ""
+}
+
+// headerSize returns the bytes h takes on the wire, one "Key: value\r\n" line
+// per value.
+func headerSize(h textproto.MIMEHeader) int {
+	n := 0
+	for key, values := range h {
+		for _, v := range values {
+			n += len(key) + len(": ") + len(v) + len("\r\n")
+		}
+	}
+	return n
+}
+
+// streamUpload reads the multipart body part by part and uploads each file
+// under keys as soon as it arrives. Parts that are not files are kept as form
+// values; the populated r.MultipartForm, r.PostForm and r.Form expose them to
+// the next handler just as ParseMultipartForm would. A positive maxFiles caps
+// the files per key.
+func (gfm *GFileMux) streamUpload(ctx context.Context, r *http.Request, bucket string, keys []string, maxSize int64, maxFiles int) (_ Files, err error) {
+	// parts records each part as it is read, for WithDebugUploads.
+	var parts []partSummary
+	if gfm.debugUploads {
+		defer func() { gfm.logUploadDebug(ctx, r, parts, err) }()
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+
+	var (
+		spool    = gfm.spoolReason() != ""
+		existing = getFilesFromContext(r.Context())
+		values   = make(url.Values)
+		uploaded = make(Files)
+		// matched records the submitted field name for each key, to reject
+		// names that differ only by case under WithCaseInsensitiveFields.
+		matched = make(map[string]string)
+		// stored mirrors the files uploaded so far for checkContextLimits.
+		stored []fileSource
+	)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, gfm.streamError(ctx, r, err, true)
+		}
+		parts = append(parts, partSummary{
+			field:       part.FormName(),
+			file:        part.FileName() != "",
+			contentType: part.Header.Get("Content-Type"),
+			size:        -1,
+		})
+		summary := &parts[len(parts)-1]
+		if size := headerSize(part.Header); gfm.maxPartHeaderBytes > 0 && size > gfm.maxPartHeaderBytes {
+			part.Close()
+			return nil, &HeaderSizeError{Field: part.FormName(), Size: size, MaxSize: gfm.maxPartHeaderBytes}
+		}
+
+		name := part.FormName()
+		key, ok := gfm.matchKey(keys, name)
+		if ok {
+			if prev, seen := matched[key]; seen && prev != name {
+				part.Close()
+				return nil, &ValidationError{
+					Field:   key,
+					Message: fmt.Sprintf("ambiguous field: %q and %q differ only by case", prev, name),
+				}
+			}
+			matched[key] = name
+		}
+
+		if part.FileName() == "" {
+			if ok && gfm.requireFilename {
+				part.Close()
+				return nil, &ValidationError{Field: key, Message: "file part has no filename in its Content-Disposition header"}
+			}
+			value, err := io.ReadAll(part)
+			part.Close()
+			if err != nil {
+				return nil, gfm.streamError(ctx, r, err, true)
+			}
+			summary.size = int64(len(value))
+			values[name] = append(values[name], string(value))
+			continue
+		}
+		if !ok {
+			// Not a requested field; drain it so the next part can be read.
+			n, err := io.Copy(io.Discard, part)
+			part.Close()
+			if err != nil {
+				return nil, gfm.streamError(ctx, r, err, true)
+			}
+			summary.size = n
+			continue
+		}
+
+		if maxFiles > 0 && len(uploaded[key]) >= maxFiles {
+			part.Close()
+			return nil, &MaxFilesError{Field: key, Got: len(uploaded[key]) + 1, MaxFiles: maxFiles}
+		}
+		if err := gfm.checkTotalFiles(key, uploaded.Count()+1); err != nil {
+			part.Close()
+			return nil, err
+		}
+		// A part's size is unknown until it is read, so its field limit and
+		// the total limit are enforced as it streams.
+		var body io.Reader = &sizeLimitedReader{r: part, field: key, limit: gfm.fieldMaxSize(key, maxSize)}
+		if gfm.maxTotalSize > 0 {
+			var used int64
+			for _, f := range stored {
+				used = addSizes(used, f.size)
+			}
+			body = &sizeLimitedReader{r: body, field: key, limit: gfm.maxTotalSize, n: used, total: true}
+		}
+		src := gfm.partSource(key, body, part, spool)
+		// The checksum must be sent before the file it describes.
+		if src.expectedSHA256, err = gfm.expectedChecksum(values, key, len(uploaded[key])); err != nil {
+			part.Close()
+			return nil, err
+		}
+		if err := gfm.checkContextLimits(existing, []fieldSources{{field: key, sources: append(stored, src)}}); err != nil {
+			part.Close()
+			return nil, err
+		}
+		if gfm.quotaChecker != nil {
+			var size int64
+			for _, f := range stored {
+				size = addSizes(size, f.size)
+			}
+			if err := gfm.checkQuota(ctx, r, size, len(stored)+1); err != nil {
+				part.Close()
+				return nil, err
+			}
+		}
+
+		fileData, err := gfm.uploadFile(ctx, bucket, src)
+		part.Close()
+		if err != nil {
+			return nil, gfm.streamError(ctx, r, err, false)
+		}
+		summary.size = fileData.Size
+		uploaded[key] = append(uploaded[key], fileData)
+
+		// Recheck with the stored size, which a stream only learns now.
+		stored = append(stored, fileSource{size: fileData.Size})
+		if err := gfm.checkContextLimits(existing, []fieldSources{{field: key, sources: stored}}); err != nil {
+			return nil, err
+		}
+	}
+
+	if !gfm.ignoreNonExistentKeys {
+		var missing []string
+		for _, key := range keys {
+			if _, ok := uploaded[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, noFilesError(missing)
+		}
+	}
+
+	if gfm.detectDuplicates {
+		results := make([][]File, 0, len(keys))
+		for _, key := range keys {
+			if files, ok := uploaded[key]; ok {
+				results = append(results, files)
+			}
+		}
+		markDuplicates(results)
+	}
+
+	r.MultipartForm = &multipart.Form{Value: values, File: make(map[string][]*multipart.FileHeader)}
+	r.PostForm = values
+	if r.Form == nil {
+		r.Form = make(url.Values)
+	}
+	for k, v := range values {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	return uploaded, nil
+}
+
+// matchKey returns the key that the submitted field name selects, honoring
+// WithCaseInsensitiveFields. An exact match wins over a case-insensitive one.
+func (gfm *GFileMux) matchKey(keys []string, name string) (string, bool) {
+	for _, key := range keys {
+		if key == name {
+			return key, true
+		}
+	}
+	if gfm.caseInsensitiveFields {
+		for _, key := range keys {
+			if strings.EqualFold(key, name) {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// streamError classifies an error hit while reading the multipart stream: an
+// oversized body becomes a *SizeError, and a disconnect or expired deadline is
+// attributed as by requestError. Remaining errors from the multipart framing
+// itself (parsing is true) are reported as a *ParseError.
+func (gfm *GFileMux) streamError(ctx context.Context, r *http.Request, err error, parsing bool) error {
+	if se, ok := bodySizeError(r, err); ok {
+		return se
+	}
+	if classified := gfm.requestError(ctx, r, err); classified != err || !parsing {
+		return classified
+	}
+	return &ParseError{Err: err}
+}
+
+// partSource adapts a streamed multipart part, whose content is read through
+// body, to a fileSource. With spool set, the content is copied to a temporary
+// file, or memory under WithSpoolMemoryThreshold, when opened so that it can be
+// read more than once; otherwise it is passed on as a forward-only stream.
+func (gfm *GFileMux) partSource(key string, body io.Reader, part *multipart.Part, spool bool) fileSource {
+	src := fileSource{field: key, name: part.FileName(), size: -1, declaredType: part.Header.Get("Content-Type")}
+	src.header = &multipart.FileHeader{Filename: src.name, Header: part.Header, Size: -1}
+	if !spool {
+		src.stream = body
+		return src
+	}
+	src.open = func() (io.ReadSeekCloser, error) {
+		return gfm.spool(body)
+	}
+	return src
+}
+
+// sizeLimitedReader fails with a *SizeError naming field once more than limit
+// bytes have been read from r, counting from n. With total set, the error
+// reports the WithMaxTotalUploadSize limit.
+type sizeLimitedReader struct {
+	r     io.Reader
+	field string
+	limit int64
+	n     int64
+	total bool
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n, &SizeError{Field: l.field, Size: l.n, MaxSize: l.limit, Total: l.total}
+	}
+	return n, err
+}
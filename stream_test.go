@@ -0,0 +1,280 @@
+package GFileMux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// readerKindStorage records whether each upload was handed a seekable reader.
+type readerKindStorage struct {
+	recordingStorage
+	requireSeek   bool
+	requireBucket bool
+	seekable      []bool
+}
+
+func (s *readerKindStorage) Upload(ctx context.Context, reader io.Reader, options *UploadFileOptions) (*UploadedFileMetadata, error) {
+	_, ok := reader.(io.ReadSeeker)
+	s.mu.Lock()
+	s.seekable = append(s.seekable, ok)
+	s.mu.Unlock()
+	return s.recordingStorage.Upload(ctx, reader, options)
+}
+
+func (s *readerKindStorage) Capabilities() StorageCapabilities {
+	return StorageCapabilities{RequiresSeekableReader: s.requireSeek, RequiresBucket: s.requireBucket}
+}
+
+func TestGFileMux_Streaming(t *testing.T) {
+	store := &readerKindStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithStreaming(true),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("title", "holiday")
+	for _, p := range []formPart{
+		{"photos", "a.txt", []byte("first")},
+		{"skipped", "x.txt", []byte("ignored")},
+		{"photos", "b.txt", []byte("second file")},
+	} {
+		part, _ := mw.CreateFormFile(p.field, p.filename)
+		part.Write(p.content)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	var (
+		files Files
+		title string
+	)
+	handler.Upload("bucket", "photos")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+		title = r.FormValue("title")
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	got := files["photos"]
+	if len(got) != 2 || got[0].OriginalName != "a.txt" || got[1].OriginalName != "b.txt" {
+		t.Fatalf("expected a.txt then b.txt, got %+v", got)
+	}
+	if got[1].Size != int64(len("second file")) {
+		t.Errorf("expected the stored size to be filled in, got %d", got[1].Size)
+	}
+	if string(store.files["b.txt"]) != "second file" {
+		t.Errorf("unexpected stored content %q", store.files["b.txt"])
+	}
+	if _, ok := store.files["x.txt"]; ok {
+		t.Error("a part outside the requested fields should not be stored")
+	}
+	for i, seekable := range store.seekable {
+		if seekable {
+			t.Errorf("upload %d: expected a forward-only reader", i)
+		}
+	}
+	if title != "holiday" {
+		t.Errorf("expected form values to stay available, got title %q", title)
+	}
+}
+
+func TestGFileMux_Streaming_SeekableBackend(t *testing.T) {
+	store := &readerKindStorage{requireSeek: true}
+	handler := newTestHandler(t, WithStorage(store), WithStreaming(true))
+
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("content"))
+	rr := httptest.NewRecorder()
+	var files Files
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files, _ = GetUploadedFilesFromContext(r)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body)
+	}
+
+	if len(store.seekable) != 1 || !store.seekable[0] {
+		t.Errorf("expected the backend to receive a seekable reader, got %v", store.seekable)
+	}
+	if files["file"][0].Size != int64(len("content")) {
+		t.Errorf("expected size %d, got %d", len("content"), files["file"][0].Size)
+	}
+}
+
+func TestGFileMux_Streaming_MaxFiles(t *testing.T) {
+	store := &MockStorage{}
+	handler := newTestHandler(t, WithStorage(store), WithStreaming(true), WithMaxFiles(1))
+
+	req := buildMultipartRequestParts(t,
+		formPart{"file", "a.txt", []byte("a")},
+		formPart{"file", "b.txt", []byte("b")},
+	)
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called")
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+	if len(store.uploadedFiles) != 1 {
+		t.Errorf("expected the first file to be stored before the limit was hit, got %d", len(store.uploadedFiles))
+	}
+}
+
+// deletingStorage records the keys passed to Delete.
+type deletingStorage struct {
+	recordingStorage
+	deleted []string
+}
+
+func (s *deletingStorage) Delete(ctx context.Context, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestGFileMux_Streaming_ChecksumMismatch(t *testing.T) {
+	store := &deletingStorage{}
+	handler := newTestHandler(t,
+		WithStorage(store),
+		WithStreaming(true),
+		WithChecksumFieldSuffix("_sha256"),
+		WithFileNameGeneratorFunc(func(s string) string { return s }),
+	)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("doc_sha256", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+	part, _ := mw.CreateFormFile("doc", "a.txt")
+	part.Write([]byte("hello world"))
+	mw.WriteField("doc_sha256", strings.Repeat("0", 64))
+	part, _ = mw.CreateFormFile("doc", "b.txt")
+	part.Write([]byte("tampered"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "doc")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rr.Code, rr.Body)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "b.txt" {
+		t.Errorf("expected only the mismatching file to be deleted, got %v", store.deleted)
+	}
+}
+
+func TestGFileMux_Streaming_FieldMaxFileSize(t *testing.T) {
+	handler := newTestHandler(t,
+		WithStorage(&recordingStorage{}),
+		WithStreaming(true),
+		WithFieldMaxFileSize(map[string]int64{"avatar": 4}),
+	)
+
+	req := buildMultipartRequestParts(t, formPart{"avatar", "a.png", []byte("12345")})
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "avatar")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rr.Code, rr.Body)
+	}
+	if !strings.Contains(rr.Body.String(), `\"avatar\"`) {
+		t.Errorf("expected the error to name the field, got %s", rr.Body)
+	}
+}
+
+func TestGFileMux_Streaming_FileHeaderSizeLimit(t *testing.T) {
+	build := func(padding int) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="file"; filename="a.txt"`)
+		h.Set("X-Padding", strings.Repeat("x", padding))
+		part, _ := mw.CreatePart(h)
+		part.Write([]byte("content"))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	for _, tc := range []struct {
+		padding  int
+		wantCode int
+	}{
+		{10, http.StatusOK},
+		{4 << 10, http.StatusRequestEntityTooLarge},
+	} {
+		var gotErr error
+		store := &recordingStorage{}
+		handler := newTestHandler(t,
+			WithStorage(store),
+			WithStreaming(true),
+			WithFileHeaderSizeLimit(1<<10),
+			WithUploadErrorHandlerFunc(captureErrorHandler(&gotErr)),
+		)
+		rr := httptest.NewRecorder()
+		handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, build(tc.padding))
+		if rr.Code != tc.wantCode {
+			t.Fatalf("padding %d: expected %d, got %d: %s", tc.padding, tc.wantCode, rr.Code, rr.Body)
+		}
+		if tc.wantCode == http.StatusOK {
+			continue
+		}
+		var hse *HeaderSizeError
+		if !errors.As(gotErr, &hse) || hse.Field != "file" || hse.MaxSize != 1<<10 {
+			t.Errorf("expected a HeaderSizeError for field file, got %v", gotErr)
+		}
+		if len(store.files) != 0 {
+			t.Errorf("the part should be rejected before it is stored, got %v", store.files)
+		}
+	}
+}
+
+func TestGFileMux_SpoolMemoryThreshold(t *testing.T) {
+	handler := newTestHandler(t, WithSpoolMemoryThreshold(8))
+	for content, wantFile := range map[string]bool{"small": false, "exactly8": false, "larger than eight": true} {
+		rs, err := handler.spool(iotest.OneByteReader(strings.NewReader(content)))
+		if err != nil {
+			t.Fatalf("spool(%q): %v", content, err)
+		}
+		sf, isFile := rs.(spooledFile)
+		if isFile != wantFile {
+			t.Errorf("spool(%q): temporary file = %v, want %v", content, isFile, wantFile)
+		}
+		rs.Seek(2, io.SeekStart)
+		rs.Seek(0, io.SeekStart)
+		if got, _ := io.ReadAll(rs); string(got) != content {
+			t.Errorf("spool(%q) read back %q", content, got)
+		}
+		rs.Close()
+		if isFile {
+			if _, err := os.Stat(sf.Name()); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected the temporary file to be removed on close, got %v", err)
+			}
+		}
+	}
+
+	if rs, _ := newTestHandler(t).spool(strings.NewReader("small")); rs != nil {
+		defer rs.Close()
+		if _, ok := rs.(spooledFile); !ok {
+			t.Error("expected a temporary file without a threshold")
+		}
+	}
+}
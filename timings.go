@@ -0,0 +1,100 @@
+package GFileMux
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UploadTimings breaks down where an Upload request spent its time. It is
+// recorded when WithUploadTimings is enabled.
+type UploadTimings struct {
+	// Parse is the time spent reading and parsing the multipart body before any
+	// file was processed. It is zero with WithStreaming, where parsing is
+	// interleaved with storage.
+	Parse time.Duration `json:"parse"`
+
+	// Files holds one entry per stored file, in the order they completed.
+	Files []FileTimings `json:"files"`
+}
+
+// FileTimings breaks down the processing time of a single file.
+type FileTimings struct {
+	FieldName    string `json:"field_name"`
+	OriginalName string `json:"original_name"`
+
+	// MimeDetection covers sniffing the content type.
+	MimeDetection time.Duration `json:"mime_detection"`
+	// Validation covers the metadata, content and remote validators and the
+	// checksum, everything between detection and the storage write.
+	Validation time.Duration `json:"validation"`
+	// Storage covers the storage backend's Upload call.
+	Storage time.Duration `json:"storage"`
+}
+
+// timingsContextKey is the context key for the request's *timingRecorder.
+type timingsContextKey struct{}
+
+// timingRecorder collects the timings of one request; files are processed
+// concurrently, so appends happen under mu.
+type timingRecorder struct {
+	mu      sync.Mutex
+	timings UploadTimings
+}
+
+// withTimingRecorder attaches a fresh recorder to ctx.
+func withTimingRecorder(ctx context.Context) (context.Context, *timingRecorder) {
+	rec := &timingRecorder{}
+	return context.WithValue(ctx, timingsContextKey{}, rec), rec
+}
+
+// setParse records the parse phase of the request in ctx, if it is recorded.
+func setParse(ctx context.Context, d time.Duration) {
+	if rec, ok := ctx.Value(timingsContextKey{}).(*timingRecorder); ok {
+		rec.mu.Lock()
+		rec.timings.Parse = d
+		rec.mu.Unlock()
+	}
+}
+
+// recordFileTimings logs ft and adds it to the request in ctx, when
+// WithUploadTimings is enabled.
+func (gfm *GFileMux) recordFileTimings(ctx context.Context, ft FileTimings) {
+	rec, ok := ctx.Value(timingsContextKey{}).(*timingRecorder)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	rec.timings.Files = append(rec.timings.Files, ft)
+	rec.mu.Unlock()
+	gfm.log(ctx, slog.LevelDebug, "file timings",
+		"field", ft.FieldName,
+		"file", ft.OriginalName,
+		"mime_detection", ft.MimeDetection,
+		"validation", ft.Validation,
+		"storage", ft.Storage,
+	)
+}
+
+// snapshot returns a copy of the recorded timings.
+func (rec *timingRecorder) snapshot() UploadTimings {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	timings := rec.timings
+	timings.Files = append([]FileTimings(nil), rec.timings.Files...)
+	return timings
+}
+
+// timingsKey is the context key under which Upload stores UploadTimings for
+// the next handler.
+type timingsKey struct{}
+
+// GetUploadTimingsFromContext returns the timings recorded for the request's
+// most recent Upload middleware, and whether any were recorded. Timings are
+// only recorded with WithUploadTimings.
+func GetUploadTimingsFromContext(r *http.Request) (UploadTimings, bool) {
+	timings, ok := r.Context().Value(timingsKey{}).(UploadTimings)
+	return timings, ok
+}
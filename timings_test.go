@@ -0,0 +1,51 @@
+package GFileMux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGFileMux_UploadTimings(t *testing.T) {
+	store := &latencyStorage{delays: map[string]time.Duration{"slow.txt": 20 * time.Millisecond}}
+	handler := newTestHandler(t, WithStorage(store), WithUploadTimings(true))
+
+	req := buildMultipartRequest(t, "file", "slow.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+	var (
+		timings UploadTimings
+		ok      bool
+	)
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timings, ok = GetUploadTimingsFromContext(r)
+	})).ServeHTTP(rr, req)
+
+	if !ok {
+		t.Fatal("expected timings in the request context")
+	}
+	if timings.Parse <= 0 {
+		t.Errorf("expected a parse duration, got %s", timings.Parse)
+	}
+	if len(timings.Files) != 1 {
+		t.Fatalf("expected timings for 1 file, got %d", len(timings.Files))
+	}
+	ft := timings.Files[0]
+	if ft.FieldName != "file" || ft.OriginalName != "slow.txt" {
+		t.Errorf("unexpected file identity %+v", ft)
+	}
+	if ft.Storage < 20*time.Millisecond {
+		t.Errorf("expected the storage phase to include the backend delay, got %s", ft.Storage)
+	}
+}
+
+func TestGFileMux_UploadTimings_Disabled(t *testing.T) {
+	handler := newTestHandler(t)
+	req := buildMultipartRequest(t, "file", "a.txt", []byte("data"))
+	rr := httptest.NewRecorder()
+	handler.Upload("bucket", "file")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetUploadTimingsFromContext(r); ok {
+			t.Error("expected no timings without WithUploadTimings")
+		}
+	})).ServeHTTP(rr, req)
+}
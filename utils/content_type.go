@@ -1,12 +1,39 @@
 package utils
 
 import (
+	"bytes"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
-// FetchContentType detects the MIME type of a file based on its first 512 bytes.
+// EmptyContentType is returned by FetchContentType for zero-byte content, which
+// http.DetectContentType would otherwise report as "text/plain".
+const EmptyContentType = "application/x-empty"
+
+// Sniffer detects a MIME type from the leading bytes of some content, up to
+// 512 of them. It reports ok = false for content it does not recognize.
+type Sniffer func(header []byte) (mime string, ok bool)
+
+var (
+	sniffersMu sync.RWMutex
+	sniffers   []Sniffer
+)
+
+// RegisterSniffer adds a sniffer for formats http.DetectContentType cannot
+// identify, such as proprietary file formats. Registered sniffers are
+// consulted in registration order before the standard detection, and the
+// first match wins. RegisterSniffer is usually called from an init function
+// and is safe for concurrent use.
+func RegisterSniffer(sniffer Sniffer) {
+	sniffersMu.Lock()
+	defer sniffersMu.Unlock()
+	sniffers = append(sniffers, sniffer)
+}
+
+// FetchContentType detects the MIME type of a file based on its first 512 bytes,
+// using any sniffers added with RegisterSniffer before http.DetectContentType.
 // It reads the initial portion of the file to determine its type, resets the file
 // pointer back to the beginning after detection, and returns the MIME type without
 // any charset information (e.g., "text/plain" instead of "text/plain; charset=utf-8").
@@ -17,7 +44,8 @@ import (
 //	both reading and seeking.
 //
 // Returns:
-//   - A string containing the MIME type (e.g., "text/plain", "image/jpeg").
+//   - A string containing the MIME type (e.g., "text/plain", "image/jpeg"), or
+//     EmptyContentType when the content is empty.
 //   - An error if there is an issue with reading or seeking the file.
 func FetchContentType(f io.ReadSeeker) (string, error) {
 	// Allocate a buffer to read the first 512 bytes
@@ -28,27 +56,56 @@ func FetchContentType(f io.ReadSeeker) (string, error) {
 		return "", err
 	}
 
-	// Read the first 512 bytes
-	bytesRead, err := f.Read(buffer)
-	if err != nil && err != io.EOF {
+	// Read up to the first 512 bytes; files shorter than that end early
+	bytesRead, err := io.ReadFull(f, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", err
 	}
 
-	// Trim the buffer to the actual number of bytes read
-	buffer = buffer[:bytesRead]
-
-	// Detect the MIME type based on the first few bytes
-	contentType := http.DetectContentType(buffer)
-
 	// Reset the file pointer to the beginning after detection
 	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		return "", err
 	}
 
+	return sniffContentType(buffer[:bytesRead]), nil
+}
+
+// PeekContentType detects the MIME type of a forward-only stream, like
+// FetchContentType, by reading up to its first 512 bytes. Because those bytes
+// cannot be unread, it returns a reader that yields them followed by the rest
+// of r; callers must use it in place of r.
+func PeekContentType(r io.Reader) (string, io.Reader, error) {
+	buffer := make([]byte, 512)
+	bytesRead, err := io.ReadFull(r, buffer)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	buffer = buffer[:bytesRead]
+	return sniffContentType(buffer), io.MultiReader(bytes.NewReader(buffer), r), nil
+}
+
+// sniffContentType classifies the leading bytes of some content, reporting
+// EmptyContentType for no content and dropping any charset parameter.
+func sniffContentType(head []byte) string {
+	if len(head) == 0 {
+		return EmptyContentType
+	}
+
+	sniffersMu.RLock()
+	registered := sniffers
+	sniffersMu.RUnlock()
+	for _, sniff := range registered {
+		if contentType, ok := sniff(head); ok {
+			return contentType
+		}
+	}
+
+	// Detect the MIME type based on the first few bytes
+	contentType := http.DetectContentType(head)
+
 	// Handle potential charset in the MIME type, e.g., "text/plain; charset=utf-8"
 	if mimeParts := strings.Split(contentType, ";"); len(mimeParts) > 1 {
 		contentType = mimeParts[0] // Keep only the MIME type, not the charset
 	}
-
-	return contentType, nil
+	return contentType
 }
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// shortReader returns at most n bytes per Read call.
+type shortReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (s shortReader) Read(p []byte) (int, error) {
+	if len(p) > s.n {
+		p = p[:s.n]
+	}
+	return s.Reader.Read(p)
+}
+
+func TestFetchContentType(t *testing.T) {
+	cases := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"empty", nil, EmptyContentType},
+		{"tiny text", []byte("hi"), "text/plain"},
+		{"png header", []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bytes.NewReader(tc.content)
+			got, err := FetchContentType(r)
+			if err != nil {
+				t.Fatalf("FetchContentType: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("expected reader rewound to 0, got %d", pos)
+			}
+		})
+	}
+}
+
+func TestFetchContentType_ShortReads(t *testing.T) {
+	// "%PDF-" only sniffs as a PDF if the first Read is not cut short.
+	r := shortReader{Reader: bytes.NewReader([]byte("%PDF-1.7 trailing data")), n: 2}
+	got, err := FetchContentType(r)
+	if err != nil {
+		t.Fatalf("FetchContentType: %v", err)
+	}
+	if got != "application/pdf" {
+		t.Errorf("expected application/pdf, got %q", got)
+	}
+}
+
+func TestRegisterSniffer(t *testing.T) {
+	saved := sniffers
+	t.Cleanup(func() { sniffers = saved })
+
+	RegisterSniffer(func(header []byte) (string, bool) {
+		return "application/x-acme", bytes.HasPrefix(header, []byte("ACME"))
+	})
+	RegisterSniffer(func(header []byte) (string, bool) {
+		return "application/x-second", bytes.HasPrefix(header, []byte("AC"))
+	})
+
+	cases := []struct {
+		content string
+		want    string
+	}{
+		{"ACME\x00\x01", "application/x-acme"}, // first match wins
+		{"AC\x00\x01", "application/x-second"},
+		{"%PDF-1.7", "application/pdf"}, // falls back to standard detection
+	}
+	for _, tc := range cases {
+		got, err := FetchContentType(bytes.NewReader([]byte(tc.content)))
+		if err != nil {
+			t.Fatalf("FetchContentType: %v", err)
+		}
+		if got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.content, tc.want, got)
+		}
+	}
+}
+
+func TestPeekContentType(t *testing.T) {
+	content := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("x"), 1000)...)
+	cases := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"empty", nil, EmptyContentType},
+		{"shorter than the peek", []byte("hi"), "text/plain"},
+		{"longer than the peek", content, "application/pdf"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A forward-only reader with short reads, like a multipart part.
+			src := io.MultiReader(shortReader{Reader: bytes.NewReader(tc.content), n: 3})
+			got, body, err := PeekContentType(src)
+			if err != nil {
+				t.Fatalf("PeekContentType: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			replayed, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if !bytes.Equal(replayed, tc.content) {
+				t.Errorf("expected the body to replay all %d bytes, got %d", len(tc.content), len(replayed))
+			}
+		})
+	}
+}
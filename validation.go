@@ -1,10 +1,20 @@
 package GFileMux
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"  // register the GIF decoder for the image validators
+	_ "image/jpeg" // register the JPEG decoder for the image validators
+	_ "image/png"  // register the PNG decoder for the image validators
+	"io"
+	"mime"
 	"path/filepath"
 	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // ValidateMimeType returns a FileValidatorFunc that checks if a file's MIME type
@@ -33,39 +43,86 @@ func ValidateMimeType(validMimeTypes ...string) FileValidatorFunc {
 }
 
 // ValidateFileExtension returns a FileValidatorFunc that checks whether the
-// uploaded file's original name has one of the allowed extensions.
-// Extensions are matched case-insensitively and must include the leading dot
-// (e.g. ".pdf", ".jpg").
+// uploaded file's original name has one of the allowed extensions. Extensions
+// are matched case-insensitively, with or without the leading dot (".pdf" and
+// "pdf" are equivalent). Multi-part extensions are supported: "archive.tar.gz"
+// is accepted by either ".gz" or ".tar.gz". Names without an extension,
+// including dotfiles such as ".env" and names ending in ".", are rejected.
+//
+// The check uses File.OriginalName, the name the client sent, because
+// UploadedFileName comes from the configured generator and may not keep the
+// extension (or may be derived from it). Pair it with ValidateMimeType when the
+// content itself must be trusted: an extension is only a claim by the client.
 //
 // Example:
 //
 //	GFileMux.ValidateFileExtension(".jpg", ".jpeg", ".png")
 func ValidateFileExtension(allowedExts ...string) FileValidatorFunc {
-	lower := make([]string, len(allowedExts))
-	for i, e := range allowedExts {
-		lower[i] = strings.ToLower(strings.TrimSpace(e))
+	allowed := make(map[string]bool, len(allowedExts))
+	for _, e := range allowedExts {
+		allowed[normalizeExtension(e)] = true
 	}
 
 	return func(file File) error {
-		ext := strings.ToLower(filepath.Ext(file.OriginalName))
-		if slices.Contains(lower, ext) {
-			return nil
+		exts := fileExtensions(file.OriginalName)
+		if len(exts) == 0 {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("file %q has no extension; allowed: %s", file.OriginalName, strings.Join(allowedExts, ", ")),
+			}
+		}
+		for _, ext := range exts {
+			if allowed[ext] {
+				return nil
+			}
 		}
 		return &ValidationError{
 			Field:   file.FieldName,
-			Message: fmt.Sprintf("file extension %q is not allowed; allowed: %s", ext, strings.Join(allowedExts, ", ")),
+			Message: fmt.Sprintf("file extension %q is not allowed; allowed: %s", exts[len(exts)-1], strings.Join(allowedExts, ", ")),
+		}
+	}
+}
+
+// normalizeExtension lowercases ext and gives it exactly one leading dot.
+func normalizeExtension(ext string) string {
+	return "." + strings.TrimLeft(strings.ToLower(strings.TrimSpace(ext)), ".")
+}
+
+// fileExtensions returns the lowercase extensions of name's base name, from
+// the longest to the shortest: "a.tar.gz" yields ".tar.gz" and ".gz". A
+// leading dot marks a hidden file rather than an extension, and a trailing
+// dot is not an extension.
+func fileExtensions(name string) []string {
+	base := strings.ToLower(filepath.Base(filepath.ToSlash(name)))
+	base = strings.TrimLeft(base, ".")
+	if strings.HasSuffix(base, ".") {
+		return nil
+	}
+	var exts []string
+	for i, c := range base {
+		if c == '.' {
+			exts = append(exts, base[i:])
 		}
 	}
+	return exts
 }
 
 // ValidateMinFileSize returns a FileValidatorFunc that rejects files smaller
 // than minBytes bytes. Useful for preventing zero-byte or near-empty uploads.
+// Files whose size is not yet known (streamed with WithStreaming) are rejected,
+// since their size cannot be checked before they are stored.
 //
 // Example:
 //
 //	GFileMux.ValidateMinFileSize(1024) // at least 1 KB
 func ValidateMinFileSize(minBytes int64) FileValidatorFunc {
 	return func(file File) error {
+		if file.Size < 0 {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: "file size is unknown before storage",
+			}
+		}
 		if file.Size < minBytes {
 			return &ValidationError{
 				Field:   file.FieldName,
@@ -76,6 +133,182 @@ func ValidateMinFileSize(minBytes int64) FileValidatorFunc {
 	}
 }
 
+// ValidateFileSize returns a FileValidatorFunc that rejects files whose size is
+// outside the inclusive range [minBytes, maxBytes]. Pass -1 for either bound to
+// disable it; ValidateFileSize(1, -1) rejects only zero-byte files. Unlike the
+// body limit set by WithMaxFileSize, the bounds apply to each file. Files whose
+// size is not yet known (streamed with WithStreaming) are rejected, since their
+// size cannot be checked before they are stored.
+//
+// Example:
+//
+//	GFileMux.ValidateFileSize(1, 5<<20) // 1 byte to 5 MB
+func ValidateFileSize(minBytes, maxBytes int64) FileValidatorFunc {
+	return func(file File) error {
+		if file.Size < 0 {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: "file size is unknown before storage",
+			}
+		}
+		if minBytes >= 0 && file.Size < minBytes {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("file is too small: got %d bytes, minimum is %d bytes", file.Size, minBytes),
+			}
+		}
+		if maxBytes >= 0 && file.Size > maxBytes {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("file is too large: got %d bytes, maximum is %d bytes", file.Size, maxBytes),
+			}
+		}
+		return nil
+	}
+}
+
+// ValidateDeclaredMatchesDetected returns a FileValidatorFunc that rejects
+// files whose declared Content-Type (File.DeclaredMimeType) differs from the
+// type detected from their content (File.MimeType), catching clients that
+// spoof a file's type. Files without a declared type, or declared as the
+// generic "application/octet-stream" that clients send for unknown types, are
+// accepted.
+//
+// Example:
+//
+//	GFileMux.ValidateDeclaredMatchesDetected()
+func ValidateDeclaredMatchesDetected() FileValidatorFunc {
+	return func(file File) error {
+		declared := file.DeclaredMimeType
+		if declared == "" || declared == "application/octet-stream" {
+			return nil
+		}
+		if strings.EqualFold(declared, strings.TrimSpace(file.MimeType)) {
+			return nil
+		}
+		return &ValidationError{
+			Field:   file.FieldName,
+			Message: fmt.Sprintf("declared content type %q does not match detected type %q", declared, file.MimeType),
+		}
+	}
+}
+
+// ValidateContentMatchesExtension returns a FileValidatorFunc that rejects
+// files whose sniffed MIME type (File.MimeType) contradicts the type implied by
+// the extension of their original name, per mime.TypeByExtension, catching
+// e.g. an executable renamed to ".jpg". Names without an extension, or with
+// one that has no registered type, are accepted. The comparison ignores
+// parameters such as charset and allows for the limits of content sniffing:
+//   - text/plain content matches any text type and JSON, JavaScript and XML;
+//   - text/xml content matches any XML type, such as image/svg+xml;
+//   - application/zip content matches zip-based formats such as .docx, .odt
+//     and .jar;
+//   - "x-" prefixed subtypes match their standard names (application/x-gzip
+//     and application/gzip);
+//   - application/octet-stream, reported for content that cannot be
+//     classified, matches every type except those sniffing recognizes (images,
+//     audio, video, text formats, PDF and archives), which would have been
+//     detected.
+//
+// The check is meaningless with WithFallbackMimeFromExtension or
+// WithMimeOverrides, which derive File.MimeType from the extension.
+//
+// Example:
+//
+//	GFileMux.ValidateContentMatchesExtension()
+func ValidateContentMatchesExtension() FileValidatorFunc {
+	return func(file File) error {
+		ext := strings.ToLower(filepath.Ext(file.OriginalName))
+		if ext == "" {
+			return nil
+		}
+		expected := baseMediaType(mime.TypeByExtension(ext))
+		if expected == "" {
+			return nil
+		}
+		detected := baseMediaType(file.MimeType)
+		if contentMatchesType(detected, expected) {
+			return nil
+		}
+		return &ValidationError{
+			Field:   file.FieldName,
+			Message: fmt.Sprintf("file %q has extension %q, implying %s, but its content was detected as %s", file.OriginalName, ext, expected, detected),
+		}
+	}
+}
+
+// baseMediaType returns the lowercased media type of a MIME type, without
+// parameters.
+func baseMediaType(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// sniffedTypePrefixes lists the types http.DetectContentType recognizes, so a
+// file claiming one of them cannot legitimately sniff as
+// application/octet-stream.
+var sniffedTypePrefixes = []string{
+	"image/", "audio/", "video/", "text/", "font/",
+	"application/pdf", "application/zip", "application/gzip", "application/x-gzip",
+	"application/x-rar-compressed", "application/vnd.rar", "application/wasm", "application/ogg",
+	"application/postscript",
+}
+
+// contentMatchesType reports whether content sniffed as detected can be a
+// file of type expected. See ValidateContentMatchesExtension.
+func contentMatchesType(detected, expected string) bool {
+	unalias := func(t string) string {
+		typ, sub, _ := strings.Cut(t, "/")
+		return typ + "/" + strings.TrimPrefix(sub, "x-")
+	}
+	if unalias(detected) == unalias(expected) {
+		return true
+	}
+	isXML := strings.HasSuffix(expected, "/xml") || strings.HasSuffix(expected, "+xml")
+	switch detected {
+	case "application/octet-stream":
+		// Text formats, such as JSON and SVG, are sniffed as text.
+		return !contentMatchesType("text/plain", expected) && !slices.ContainsFunc(sniffedTypePrefixes, func(p string) bool {
+			return strings.HasPrefix(expected, p)
+		})
+	case "text/plain":
+		return strings.HasPrefix(expected, "text/") || isXML ||
+			expected == "application/json" || strings.HasSuffix(expected, "+json") || expected == "application/javascript"
+	case "text/xml":
+		return isXML
+	case "application/zip":
+		return strings.HasSuffix(expected, "+zip") || strings.Contains(expected, "openxmlformats") ||
+			strings.Contains(expected, "opendocument") || expected == "application/java-archive"
+	}
+	return false
+}
+
+// ValidateFilenameControlChars returns a FileValidatorFunc that rejects files
+// whose original name contains a null byte or any other control character
+// (C0, DEL and C1), which can corrupt logs and headers and are mishandled by
+// some filesystems. The runes in extra are rejected too, e.g. the right-to-left
+// override U+202E used to disguise a file's extension. Unlike
+// FilenamePolicySanitize it never rewrites a name.
+//
+// Example:
+//
+//	GFileMux.ValidateFilenameControlChars('\u202e')
+func ValidateFilenameControlChars(extra ...rune) FileValidatorFunc {
+	return func(file File) error {
+		i := strings.IndexFunc(file.OriginalName, func(r rune) bool {
+			return unicode.IsControl(r) || slices.Contains(extra, r)
+		})
+		if i < 0 {
+			return nil
+		}
+		r, _ := utf8.DecodeRuneInString(file.OriginalName[i:])
+		return &ValidationError{
+			Field:   file.FieldName,
+			Message: fmt.Sprintf("file name %q contains the forbidden character %U at byte %d", file.OriginalName, r, i),
+		}
+	}
+}
+
 // ChainValidators returns a FileValidatorFunc that applies multiple validation
 // functions sequentially. The first error encountered is immediately returned.
 //
@@ -96,3 +329,185 @@ func ChainValidators(validators ...FileValidatorFunc) FileValidatorFunc {
 		return nil
 	}
 }
+
+// validateContent runs v against rs positioned at the start of the file, and
+// rewinds rs again afterward so later stages see the full content.
+func validateContent(v FileContentValidatorFunc, file File, rs io.ReadSeeker) error {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := v(file, rs); err != nil {
+		return err
+	}
+	_, err := rs.Seek(0, io.SeekStart)
+	return err
+}
+
+// ChainContentValidators returns a FileContentValidatorFunc that applies
+// multiple content validators sequentially, rewinding the reader before each
+// one. The first error encountered is immediately returned.
+//
+// Example:
+//
+//	GFileMux.ChainContentValidators(
+//	    GFileMux.RejectShebangScripts(),
+//	    myVirusScanner,
+//	)
+func ChainContentValidators(validators ...FileContentValidatorFunc) FileContentValidatorFunc {
+	return func(file File, rs io.ReadSeeker) error {
+		for _, v := range validators {
+			if err := validateContent(v, file, rs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// RejectShebangScripts returns a FileContentValidatorFunc that rejects files
+// whose content begins with "#!", i.e. shell, Python and other interpreter
+// scripts. http.DetectContentType classifies such files as plain text, so a
+// MIME allowlist alone does not catch them.
+//
+// Example:
+//
+//	GFileMux.WithContentValidatorFunc(GFileMux.RejectShebangScripts())
+func RejectShebangScripts() FileContentValidatorFunc {
+	shebang := []byte("#!")
+	return func(file File, rs io.ReadSeeker) error {
+		head := make([]byte, len(shebang))
+		n, err := io.ReadFull(rs, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if bytes.Equal(head[:n], shebang) {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("file %q is an executable script (starts with #!)", file.OriginalName),
+			}
+		}
+		return nil
+	}
+}
+
+// ValidateImageIntegrity returns a FileContentValidatorFunc that fully decodes
+// files of the given MIME types and rejects those that fail to decode, catching
+// truncated or corrupt images whose headers still pass MIME sniffing. Files of
+// other types are accepted unchecked. With no types given it checks
+// "image/jpeg", "image/png" and "image/gif", the formats whose decoders are
+// registered by this package; other formats need their decoder registered,
+// e.g. by importing golang.org/x/image/webp. Decoding reads the whole image
+// into memory, so it is opt-in. The reader is rewound afterward.
+//
+// Example:
+//
+//	GFileMux.WithContentValidatorFunc(GFileMux.ValidateImageIntegrity())
+func ValidateImageIntegrity(mimeTypes ...string) FileContentValidatorFunc {
+	if len(mimeTypes) == 0 {
+		mimeTypes = []string{"image/jpeg", "image/png", "image/gif"}
+	}
+	lower := make([]string, len(mimeTypes))
+	for i, m := range mimeTypes {
+		lower[i] = strings.ToLower(strings.TrimSpace(m))
+	}
+
+	return func(file File, rs io.ReadSeeker) error {
+		if !slices.Contains(lower, strings.ToLower(strings.TrimSpace(file.MimeType))) {
+			return nil
+		}
+		_, _, decodeErr := image.Decode(rs)
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if decodeErr != nil {
+			return &ValidationError{
+				Field:   file.FieldName,
+				Message: fmt.Sprintf("image %q is corrupt or truncated: %v", file.OriginalName, decodeErr),
+			}
+		}
+		return nil
+	}
+}
+
+// imageDimensions reads the width and height of an image from its header and
+// rewinds rs. ok is false for files that are not images and for image formats
+// without a registered decoder, which are not checked. An unreadable header is
+// reported as a *ValidationError.
+func imageDimensions(file File, rs io.ReadSeeker) (cfg image.Config, ok bool, err error) {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(file.MimeType)), "image/") {
+		return image.Config{}, false, nil
+	}
+	cfg, _, decodeErr := image.DecodeConfig(rs)
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return image.Config{}, false, err
+	}
+	if errors.Is(decodeErr, image.ErrFormat) {
+		return image.Config{}, false, nil
+	}
+	if decodeErr != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return image.Config{}, false, &ValidationError{
+			Field:   file.FieldName,
+			Message: fmt.Sprintf("could not read the dimensions of image %q", file.OriginalName),
+		}
+	}
+	return cfg, true, nil
+}
+
+// ValidateImageDimensions returns a FileContentValidatorFunc that rejects
+// images narrower than minWidth, shorter than minHeight, wider than maxWidth
+// or taller than maxHeight pixels, e.g. to keep profile pictures within a size
+// range. A bound of 0 or less is not enforced. Like ValidateAspectRatio it
+// reads only the image header, checks only files with an "image/" MIME type
+// (JPEG, PNG and GIF are decoded out of the box; register more with a blank
+// import such as golang.org/x/image/webp), and rewinds the reader afterward.
+//
+// Example:
+//
+//	GFileMux.WithContentValidatorFunc(GFileMux.ValidateImageDimensions(128, 128, 4096, 4096))
+func ValidateImageDimensions(minWidth, minHeight, maxWidth, maxHeight int) FileContentValidatorFunc {
+	return func(file File, rs io.ReadSeeker) error {
+		cfg, ok, err := imageDimensions(file, rs)
+		if !ok || err != nil {
+			return err
+		}
+		if (minWidth > 0 && cfg.Width < minWidth) || (minHeight > 0 && cfg.Height < minHeight) ||
+			(maxWidth > 0 && cfg.Width > maxWidth) || (maxHeight > 0 && cfg.Height > maxHeight) {
+			return &ValidationError{
+				Field: file.FieldName,
+				Message: fmt.Sprintf("image %q is %dx%d, outside the allowed range %dx%d to %dx%d",
+					file.OriginalName, cfg.Width, cfg.Height, minWidth, minHeight, maxWidth, maxHeight),
+			}
+		}
+		return nil
+	}
+}
+
+// ValidateAspectRatio returns a FileContentValidatorFunc that rejects images
+// whose width/height ratio falls outside [minRatio, maxRatio], such as
+// extreme banners that break layouts or hide decompression bombs. A bound of
+// 0 or less is not enforced. Only the image header is read, with
+// image.DecodeConfig, and only files with an "image/" MIME type are checked.
+// Images in formats without a registered decoder are accepted unchecked. The
+// reader is rewound afterward.
+//
+// Example:
+//
+//	GFileMux.WithContentValidatorFunc(GFileMux.ValidateAspectRatio(0.25, 4)) // at most 4:1 either way
+func ValidateAspectRatio(minRatio, maxRatio float64) FileContentValidatorFunc {
+	return func(file File, rs io.ReadSeeker) error {
+		cfg, ok, err := imageDimensions(file, rs)
+		if !ok || err != nil {
+			return err
+		}
+
+		ratio := float64(cfg.Width) / float64(cfg.Height)
+		if (minRatio > 0 && ratio < minRatio) || (maxRatio > 0 && ratio > maxRatio) {
+			return &ValidationError{
+				Field: file.FieldName,
+				Message: fmt.Sprintf("image %q is %dx%d, an aspect ratio of %.3g outside the allowed range [%g, %g]",
+					file.OriginalName, cfg.Width, cfg.Height, ratio, minRatio, maxRatio),
+			}
+		}
+		return nil
+	}
+}
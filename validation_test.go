@@ -1,6 +1,14 @@
 package GFileMux
 
 import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -49,6 +57,32 @@ func TestValidateFileExtension_Rejected(t *testing.T) {
 	}
 }
 
+func TestValidateFileExtension_Normalization(t *testing.T) {
+	validator := ValidateFileExtension("PDF", ".tar.gz", "..csv")
+	cases := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"report.pdf", false},
+		{"REPORT.Pdf", false},
+		{"data.csv", false},
+		{"archive.tar.gz", false},
+		{"backup.gz", true}, // only the full ".tar.gz" was allowed
+		{"my.report.pdf", false},
+		{"notes.pdf.exe", true},
+		{"README", true},
+		{".pdf", true}, // a dotfile, not an extension
+		{"report.", true},
+		{"dir/report.pdf", false},
+	}
+	for _, tc := range cases {
+		err := validator(File{FieldName: "doc", OriginalName: tc.name})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: got err %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
 func TestValidateMinFileSize_Allowed(t *testing.T) {
 	validator := ValidateMinFileSize(100)
 	file := File{FieldName: "doc", Size: 200}
@@ -65,6 +99,37 @@ func TestValidateMinFileSize_Rejected(t *testing.T) {
 	}
 }
 
+func TestValidateFileSize(t *testing.T) {
+	cases := []struct {
+		name     string
+		min, max int64
+		size     int64
+		wantErr  bool
+	}{
+		{"at min", 10, 20, 10, false},
+		{"at max", 10, 20, 20, false},
+		{"below min", 10, 20, 9, true},
+		{"above max", 10, 20, 21, true},
+		{"zero bytes rejected", 1, -1, 0, true},
+		{"min disabled", -1, 20, 0, false},
+		{"max disabled", 1, -1, 1 << 40, false},
+		{"both disabled", -1, -1, 0, false},
+		{"unknown size", -1, 20, -1, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFileSize(tc.min, tc.max)(File{FieldName: "doc", Size: tc.size})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("size %d in [%d, %d]: got err %v, wantErr %v", tc.size, tc.min, tc.max, err, tc.wantErr)
+			}
+			var ve *ValidationError
+			if err != nil && !errors.As(err, &ve) {
+				t.Errorf("expected a *ValidationError, got %T", err)
+			}
+		})
+	}
+}
+
 func TestChainValidators_AllPass(t *testing.T) {
 	chain := ChainValidators(
 		ValidateMimeType("image/jpeg"),
@@ -95,3 +160,273 @@ func isValidationError(err error, target **ValidationError) bool {
 	}
 	return false
 }
+
+func TestRejectShebangScripts(t *testing.T) {
+	validator := RejectShebangScripts()
+	cases := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"shell script", "#!/bin/sh\necho hi\n", true},
+		{"python script", "#!/usr/bin/env python3\n", true},
+		{"plain text", "hello world", false},
+		{"comment only", "# not a shebang", false},
+		{"single hash", "#", false},
+		{"empty", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validator(File{FieldName: "f", OriginalName: "x.txt"}, strings.NewReader(tc.content))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !isValidationError(err, &ve) {
+				t.Fatalf("expected *ValidationError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestChainContentValidators_RewindsBetweenValidators(t *testing.T) {
+	var seen []string
+	record := func(f File, r io.ReadSeeker) error {
+		data, err := io.ReadAll(r)
+		seen = append(seen, string(data))
+		return err
+	}
+	chain := ChainContentValidators(record, record)
+	if err := chain(File{}, strings.NewReader("content")); err != nil {
+		t.Fatalf("chain: %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "content" || seen[1] != "content" {
+		t.Fatalf("each validator should see the full content, got %q", seen)
+	}
+}
+
+func TestValidateImageIntegrity(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	valid := buf.Bytes()
+
+	validator := ValidateImageIntegrity()
+	cases := []struct {
+		name    string
+		mime    string
+		content []byte
+		wantErr bool
+	}{
+		{"valid png", "image/png", valid, false},
+		{"truncated png", "image/png", valid[:len(valid)/2], true},
+		{"unchecked type", "text/plain", []byte("not an image"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := bytes.NewReader(tc.content)
+			err := validator(File{FieldName: "img", OriginalName: "x.png", MimeType: tc.mime}, rs)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !isValidationError(err, &ve) {
+				t.Fatalf("expected *ValidationError, got %T", err)
+			}
+			if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("expected the reader to be rewound, at offset %d", pos)
+			}
+		})
+	}
+}
+
+func TestValidateDeclaredMatchesDetected(t *testing.T) {
+	validator := ValidateDeclaredMatchesDetected()
+	cases := []struct {
+		name               string
+		declared, detected string
+		wantErr            bool
+	}{
+		{"match", "image/png", "image/png", false},
+		{"spoofed", "image/png", "application/x-msdownload", true},
+		{"none declared", "", "text/plain", false},
+		{"generic declared", "application/octet-stream", "text/plain", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validator(File{FieldName: "f", DeclaredMimeType: tc.declared, MimeType: tc.detected})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateContentMatchesExtension(t *testing.T) {
+	mime.AddExtensionType(".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	var pngBytes bytes.Buffer
+	png.Encode(&pngBytes, image.NewGray(image.Rect(0, 0, 1, 1)))
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00")
+	zip := []byte("PK\x03\x04\x14\x00\x06\x00")
+
+	validator := ValidateContentMatchesExtension()
+	cases := []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr bool
+	}{
+		{"png as png", "photo.png", pngBytes.Bytes(), false},
+		{"uppercase extension", "PHOTO.PNG", pngBytes.Bytes(), false},
+		{"exe renamed to jpg", "cat.jpg", exe, true},
+		{"png renamed to jpg", "cat.jpg", pngBytes.Bytes(), true},
+		{"html renamed to png", "x.png", []byte("<html><script>alert(1)</script>"), true},
+		{"binary renamed to json", "data.json", exe, true},
+		{"text with charset", "notes.txt", []byte("hello"), false},
+		{"json sniffed as text", "data.json", []byte(`{"a":1}`), false},
+		{"svg sniffed as xml", "logo.svg", []byte(`<?xml version="1.0"?><svg/>`), false},
+		{"docx sniffed as zip", "report.docx", zip, false},
+		{"unclassifiable binary", "blob.bin", exe, false},
+		{"unknown extension", "data.zzz", exe, false},
+		{"no extension", "README", exe, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := File{FieldName: "f", OriginalName: tc.file, MimeType: http.DetectContentType(tc.content)}
+			err := validator(file)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("detected %s: wantErr=%v, got %v", file.MimeType, tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !errors.As(err, &ve) {
+				t.Errorf("expected a *ValidationError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestValidateFilenameControlChars(t *testing.T) {
+	validator := ValidateFilenameControlChars('\u202e')
+	cases := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{"plain", "report 2024.pdf", false},
+		{"unicode", "résumé.pdf", false},
+		{"null byte", "evil.php\x00.jpg", true},
+		{"newline", "a\nb.txt", true},
+		{"delete", "a\x7fb.txt", true},
+		{"c1 control", "a\u0085b.txt", true},
+		{"extra rune", "invoice\u202efdp.exe", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validator(File{FieldName: "f", OriginalName: tc.file})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !errors.As(err, &ve) {
+				t.Errorf("expected a *ValidationError, got %T", err)
+			}
+		})
+	}
+	if err := ValidateFilenameControlChars()(File{OriginalName: "invoice\u202efdp.exe"}); err != nil {
+		t.Errorf("U+202E is not a control character and should pass by default, got %v", err)
+	}
+}
+
+func TestValidateAspectRatio(t *testing.T) {
+	encode := func(w, h int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+			t.Fatalf("png.Encode: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	validator := ValidateAspectRatio(0.5, 4)
+	cases := []struct {
+		name    string
+		mime    string
+		content []byte
+		wantErr bool
+	}{
+		{"square", "image/png", encode(10, 10), false},
+		{"at the maximum", "image/png", encode(40, 10), false},
+		{"too wide", "image/png", encode(50, 10), true},
+		{"too tall", "image/png", encode(10, 30), true},
+		{"unregistered format", "image/webp", []byte("RIFF....WEBPVP8 "), false},
+		{"corrupt header", "image/png", encode(10, 10)[:12], true},
+		{"not an image", "text/plain", []byte("wide text"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := bytes.NewReader(tc.content)
+			err := validator(File{FieldName: "banner", OriginalName: "b.png", MimeType: tc.mime}, rs)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !errors.As(err, &ve) {
+				t.Fatalf("expected *ValidationError, got %T", err)
+			}
+			if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("expected the reader to be rewound, at offset %d", pos)
+			}
+		})
+	}
+
+	if err := ValidateAspectRatio(0, 2)(File{MimeType: "image/png"}, bytes.NewReader(encode(1, 100))); err != nil {
+		t.Errorf("a zero minimum should not be enforced, got %v", err)
+	}
+}
+
+func TestValidateImageDimensions(t *testing.T) {
+	encode := func(w, h int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+			t.Fatalf("png.Encode: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	validator := ValidateImageDimensions(16, 16, 64, 48)
+	cases := []struct {
+		name    string
+		mime    string
+		content []byte
+		wantErr bool
+	}{
+		{"within range", "image/png", encode(32, 32), false},
+		{"at the bounds", "image/png", encode(64, 48), false},
+		{"too narrow", "image/png", encode(15, 32), true},
+		{"too short", "image/png", encode(32, 10), true},
+		{"too wide", "image/png", encode(65, 32), true},
+		{"too tall", "image/png", encode(32, 49), true},
+		{"corrupt header", "image/png", encode(32, 32)[:12], true},
+		{"not an image", "text/plain", []byte("tiny"), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := bytes.NewReader(tc.content)
+			err := validator(File{FieldName: "avatar", OriginalName: "a.png", MimeType: tc.mime}, rs)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("wantErr=%v, got %v", tc.wantErr, err)
+			}
+			var ve *ValidationError
+			if tc.wantErr && !errors.As(err, &ve) {
+				t.Fatalf("expected *ValidationError, got %T", err)
+			}
+			if pos, _ := rs.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("expected the reader to be rewound, at offset %d", pos)
+			}
+		})
+	}
+
+	if err := ValidateImageDimensions(0, 0, 10, 0)(File{MimeType: "image/png"}, bytes.NewReader(encode(10, 1000))); err != nil {
+		t.Errorf("zero bounds should not be enforced, got %v", err)
+	}
+}